@@ -0,0 +1,297 @@
+﻿package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"cards/internal"
+	"cards/models"
+	"cards/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AdminAuth checks the bearer token of /admin/v1 requests against ADMIN_API_TOKEN
+type AdminAuth struct {
+	token []byte
+}
+
+func NewAdminAuth() *AdminAuth {
+	token := os.Getenv("ADMIN_API_TOKEN")
+	if token == "" {
+		log.Println("ADMIN_API_TOKEN not configured, admin requests will be rejected")
+	}
+
+	return &AdminAuth{
+		token: []byte(token),
+	}
+}
+
+// Middleware rejects requests without the admin bearer token
+func (a *AdminAuth) Middleware(c *gin.Context) {
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if len(a.token) == 0 || !found || subtle.ConstantTimeCompare([]byte(token), a.token) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid admin token"})
+		return
+	}
+
+	c.Next()
+}
+
+type AdminHandler struct {
+	userStore      internal.UserStore
+	cardStore      internal.CardStore
+	requestStore   internal.RequestStore
+	userRepository *internal.UserRepository
+	auditor        *internal.Auditor
+}
+
+func NewAdminHandler(userStore internal.UserStore, cardStore internal.CardStore, requestStore internal.RequestStore, userRepository *internal.UserRepository, auditor *internal.Auditor) *AdminHandler {
+	return &AdminHandler{
+		userStore:      userStore,
+		cardStore:      cardStore,
+		requestStore:   requestStore,
+		userRepository: userRepository,
+		auditor:        auditor,
+	}
+}
+
+// SearchUsers handles GET /admin/v1/users
+func (h *AdminHandler) SearchUsers(c *gin.Context) {
+	historyQuery, ok := parseHistoryQuery(c)
+	if !ok {
+		return
+	}
+
+	query := models.UserSearchQuery{
+		HistoryQuery: historyQuery,
+		Name:         strings.TrimSpace(c.Query("name")),
+		CitizenID:    validation.NormalizeCitizenID(c.Query("citizen_id")),
+		CountryCode:  c.Query("country_code"),
+		Deleted:      c.DefaultQuery("deleted", models.UserDeletedExclude),
+	}
+
+	switch query.Deleted {
+	case models.UserDeletedExclude, models.UserDeletedInclude, models.UserDeletedOnly:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Deleted must be exclude, include or only"})
+		return
+	}
+
+	page, err := h.userStore.SearchUsers(c.Request.Context(), query)
+	if err != nil {
+		log.Printf("Failed to search users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		return
+	}
+
+	userIDs := make([]string, 0, len(page.Users))
+	for _, user := range page.Users {
+		userIDs = append(userIDs, user.ID)
+	}
+
+	if !h.audit(c, models.AuditActionUsersSearched, "", nil, gin.H{"user_ids": userIDs}) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetUser handles GET /admin/v1/users/:user_id
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	userRecord, ok := h.getUser(c)
+	if !ok {
+		return
+	}
+
+	firstPage := models.HistoryQuery{Limit: defaultHistoryLimit}
+
+	cards, err := h.cardStore.GetCardsByUserID(c.Request.Context(), userRecord.ID, firstPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get cards"})
+		return
+	}
+
+	attempts, err := h.cardStore.GetFailedAttemptsByUserID(c.Request.Context(), userRecord.ID, firstPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get attempts"})
+		return
+	}
+
+	if !h.audit(c, models.AuditActionUserViewed, userRecord.ID, nil, nil) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.AdminUserDetails{
+		User:     models.NewAdminUser(*userRecord),
+		Cards:    *cards,
+		Attempts: *attempts,
+	})
+}
+
+// GetUserCards handles GET /admin/v1/users/:user_id/cards
+func (h *AdminHandler) GetUserCards(c *gin.Context) {
+	userRecord, ok := h.getUser(c)
+	if !ok {
+		return
+	}
+
+	listCards(c, h.cardStore, h.auditor, models.AuditActorAdmin, userRecord.ID)
+}
+
+// GetUserAttempts handles GET /admin/v1/users/:user_id/attempts
+func (h *AdminHandler) GetUserAttempts(c *gin.Context) {
+	userRecord, ok := h.getUser(c)
+	if !ok {
+		return
+	}
+
+	listFailedAttempts(c, h.cardStore, h.auditor, models.AuditActorAdmin, userRecord.ID)
+}
+
+// DeleteUser handles DELETE /admin/v1/users/:user_id
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	userRecord, ok := h.getUser(c)
+	if !ok {
+		return
+	}
+
+	if userRecord.DeletedAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already deleted"})
+		return
+	}
+
+	// The webhook and the reconciler need the user to settle a pending request
+	pending, err := h.requestStore.CountPendingCardRequests(c.Request.Context(), userRecord.UserToken, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check pending requests"})
+		return
+	}
+	if pending > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "User has pending card requests"})
+		return
+	}
+
+	if err := h.userStore.SoftDeleteUser(c.Request.Context(), userRecord.ID); err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			c.JSON(http.StatusConflict, gin.H{"error": "User is already deleted"})
+		} else {
+			log.Printf("Failed to delete user %s: %v", userRecord.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		}
+		return
+	}
+
+	log.Printf("User %s deleted by admin", userRecord.ID)
+	h.audit(c, models.AuditActionUserDeleted, userRecord.ID, gin.H{"deleted": false}, gin.H{"deleted": true})
+	h.expireSession(c.Request.Context(), userRecord)
+
+	h.respondWithUser(c, userRecord.ID)
+}
+
+// RestoreUser handles POST /admin/v1/users/:user_id/restore
+func (h *AdminHandler) RestoreUser(c *gin.Context) {
+	userRecord, ok := h.getUser(c)
+	if !ok {
+		return
+	}
+
+	if !userRecord.DeletedAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is not deleted"})
+		return
+	}
+	if userRecord.ErasedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User was erased and cannot be restored"})
+		return
+	}
+
+	if err := h.userStore.RestoreUser(c.Request.Context(), userRecord.ID); err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			c.JSON(http.StatusConflict, gin.H{"error": "User is not deleted"})
+		} else {
+			log.Printf("Failed to restore user %s: %v", userRecord.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore user"})
+		}
+		return
+	}
+
+	log.Printf("User %s restored by admin", userRecord.ID)
+	h.audit(c, models.AuditActionUserRestored, userRecord.ID, gin.H{"deleted": true}, gin.H{"deleted": false})
+	h.respondWithUser(c, userRecord.ID)
+}
+
+// ExpireSession handles POST /admin/v1/users/:user_id/expire-session
+func (h *AdminHandler) ExpireSession(c *gin.Context) {
+	userRecord, ok := h.getUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userRepository.Invalidate(c.Request.Context(), userRecord.UserToken); err != nil {
+		log.Printf("Failed to expire session of user %s: %v", userRecord.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to expire session"})
+		return
+	}
+
+	log.Printf("Session of user %s expired by admin", userRecord.ID)
+	h.audit(c, models.AuditActionUserSessionExpired, userRecord.ID, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"status": "session expired"})
+}
+
+// getUser loads the user in the path, including soft-deleted users
+func (h *AdminHandler) getUser(c *gin.Context) (*models.UserRecord, bool) {
+	userID := c.Param("user_id")
+	if _, err := uuid.Parse(userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+
+	userRecord, err := h.userStore.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		}
+		return nil, false
+	}
+
+	return userRecord, true
+}
+
+// expireSession drops the cached user, a failure is logged since the user is already stored
+func (h *AdminHandler) expireSession(ctx context.Context, userRecord *models.UserRecord) {
+	if err := h.userRepository.Invalidate(ctx, userRecord.UserToken); err != nil {
+		log.Printf("Failed to expire session of user %s: %v", userRecord.ID, err)
+	}
+}
+
+// audit records an admin action on a user, returning false when it could not be stored
+func (h *AdminHandler) audit(c *gin.Context, action, userID string, before, after interface{}) bool {
+	return recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       models.AuditActorAdmin,
+		Action:      action,
+		SubjectType: models.AuditSubjectUser,
+		SubjectID:   userID,
+		Before:      before,
+		After:       after,
+	}) == nil
+}
+
+func (h *AdminHandler) respondWithUser(c *gin.Context, userID string) {
+	userRecord, err := h.userStore.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewAdminUser(*userRecord))
+}
@@ -0,0 +1,132 @@
+﻿package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"cards/internal"
+	"cards/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+	maxRequestIDLen = 128
+)
+
+// RequestID tags every request with an ID, reusing the caller's X-Request-ID when it sent one,
+// so audit events and logs of the same request can be correlated
+func RequestID(c *gin.Context) {
+	requestID := c.GetHeader(requestIDHeader)
+	if requestID == "" || len(requestID) > maxRequestIDLen {
+		requestID = uuid.New().String()
+	}
+
+	c.Set(requestIDKey, requestID)
+	c.Header(requestIDHeader, requestID)
+	c.Next()
+}
+
+// recordAudit appends an event for the current request to the audit log, logging a failure.
+// State changes are already stored when they are audited, so callers only stop on an error for reads,
+// and the event is written even when the client went away in the meantime.
+func recordAudit(c *gin.Context, auditor *internal.Auditor, event internal.AuditEvent) error {
+	event.RequestID = c.GetString(requestIDKey)
+	if err := auditor.Record(context.WithoutCancel(c.Request.Context()), event); err != nil {
+		log.Printf("Failed to record audit event %s for %s %s: %v", event.Action, event.SubjectType, event.SubjectID, err)
+		return err
+	}
+
+	return nil
+}
+
+// AuditHandler serves the audit log to admins
+type AuditHandler struct {
+	auditStore internal.AuditStore
+	auditor    *internal.Auditor
+}
+
+func NewAuditHandler(auditStore internal.AuditStore, auditor *internal.Auditor) *AuditHandler {
+	return &AuditHandler{
+		auditStore: auditStore,
+		auditor:    auditor,
+	}
+}
+
+// QueryEvents handles GET /admin/v1/audit-events
+func (h *AuditHandler) QueryEvents(c *gin.Context) {
+	historyQuery, ok := parseHistoryQuery(c)
+	if !ok {
+		return
+	}
+
+	query := models.AuditEventQuery{
+		Actor:       c.Query("actor"),
+		Action:      c.Query("action"),
+		SubjectType: c.Query("subject_type"),
+		SubjectID:   c.Query("subject_id"),
+		RequestID:   c.Query("request_id"),
+		CreatedFrom: historyQuery.CreatedFrom,
+		CreatedTo:   historyQuery.CreatedTo,
+		Ascending:   historyQuery.Ascending,
+		Limit:       historyQuery.Limit,
+	}
+
+	// Audit pages are ordered by sequence, their cursor holds the last sequence of the previous page
+	if historyQuery.After != nil {
+		sequence, err := strconv.ParseInt(historyQuery.After.ID, 10, 64)
+		if err != nil || sequence < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		query.AfterSequence = sequence
+	}
+
+	page, err := h.auditStore.QueryAuditEvents(c.Request.Context(), query)
+	if err != nil {
+		log.Printf("Failed to query audit events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query audit events"})
+		return
+	}
+
+	if recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       models.AuditActorAdmin,
+		Action:      models.AuditActionAuditLogQueried,
+		SubjectType: models.AuditSubjectAuditLog,
+		After:       gin.H{"events": len(page.Events)},
+	}) != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// VerifyChain handles GET /admin/v1/audit-events/verify
+func (h *AuditHandler) VerifyChain(c *gin.Context) {
+	verification, err := h.auditor.Verify(c.Request.Context())
+	if err != nil {
+		log.Printf("Failed to verify audit chain: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify audit chain"})
+		return
+	}
+
+	if !verification.Valid {
+		log.Printf("Audit chain broken at sequence %d: %s", verification.BrokenAt, verification.Reason)
+	}
+
+	// The verification itself is recorded after the chain it checked
+	recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       models.AuditActorAdmin,
+		Action:      models.AuditActionAuditChainVerified,
+		SubjectType: models.AuditSubjectAuditLog,
+		After:       verification,
+	})
+
+	c.JSON(http.StatusOK, verification)
+}
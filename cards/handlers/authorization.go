@@ -0,0 +1,229 @@
+﻿package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"cards/internal"
+	"cards/models"
+	"cards/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// authorizationMessages explain the reason codes of declined authorizations
+var authorizationMessages = map[string]string{
+	models.AuthorizationReasonInvalidCard:          "Unknown card",
+	models.AuthorizationReasonInvalidExpiry:        "Expiry date does not match the card",
+	models.AuthorizationReasonInvalidCVV:           "CVV does not match the card",
+	models.AuthorizationReasonCardNotActive:        "Card is not active",
+	models.AuthorizationReasonExpiredCard:          "Card is expired",
+	models.AuthorizationReasonCurrencyNotSupported: "Currency is not supported by the card",
+	models.AuthorizationReasonInsufficientFunds:    "Insufficient funds on the prepaid balance",
+	models.AuthorizationReasonCreditLimitExceeded:  "Credit limit exceeded",
+	internal.ControlRuleOnlineDisabled:             "Online transactions are disabled for this card",
+	internal.ControlRuleATMDisabled:                "ATM use is disabled for this card",
+	internal.ControlRuleCountryNotAllowed:          "Merchant country is not allowed for this card",
+	internal.ControlRuleMCCBlocked:                 "Merchant category is blocked for this card",
+	internal.ControlRuleMCCNotAllowed:              "Merchant category is not allowed for this card",
+	internal.ControlRulePerTransactionLimit:        "Amount is above the per-transaction limit",
+	internal.ControlRuleDailyLimit:                 "Daily limit exceeded",
+	internal.ControlRuleMonthlyLimit:               "Monthly limit exceeded",
+}
+
+// NetworkAuth checks the bearer token of card network requests against NETWORK_API_TOKEN
+type NetworkAuth struct {
+	token []byte
+}
+
+func NewNetworkAuth() *NetworkAuth {
+	token := os.Getenv("NETWORK_API_TOKEN")
+	if token == "" {
+		log.Println("NETWORK_API_TOKEN not configured, authorization requests will be rejected")
+	}
+
+	return &NetworkAuth{
+		token: []byte(token),
+	}
+}
+
+// Middleware rejects requests without the network bearer token
+func (a *NetworkAuth) Middleware(c *gin.Context) {
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if len(a.token) == 0 || !found || subtle.ConstantTimeCompare([]byte(token), a.token) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid network token"})
+		return
+	}
+
+	c.Next()
+}
+
+type AuthorizationHandler struct {
+	authorizer *internal.Authorizer
+	prepaid    *internal.PrepaidAccounts
+	notifier   *internal.Notifier
+	auditor    *internal.Auditor
+}
+
+func NewAuthorizationHandler(authorizer *internal.Authorizer, prepaid *internal.PrepaidAccounts, notifier *internal.Notifier, auditor *internal.Auditor) *AuthorizationHandler {
+	return &AuthorizationHandler{
+		authorizer: authorizer,
+		prepaid:    prepaid,
+		notifier:   notifier,
+		auditor:    auditor,
+	}
+}
+
+// Authorize handles POST /v1/authorizations
+// Approved and declined transactions both answer 200, the decision is in the status and reason code
+func (h *AuthorizationHandler) Authorize(c *gin.Context) {
+	var req models.AuthorizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	credentials, transaction, errs := validation.Authorization(req)
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authorization request", "fields": errs})
+		return
+	}
+
+	authorization, card, err := h.authorizer.Authorize(c.Request.Context(), credentials, transaction)
+	if err != nil {
+		log.Printf("Failed to authorize transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authorize transaction"})
+		return
+	}
+
+	log.Printf("Authorization %s %s: %s", authorization.ID, authorization.Status, authorization.ReasonCode)
+
+	subjectType, subjectID := models.AuditSubjectAuthorization, authorization.ID
+	if card != nil {
+		subjectType, subjectID = models.AuditSubjectCard, card.ID
+	}
+	recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       models.AuditActorNetwork,
+		Action:      models.AuditActionCardAuthorized,
+		SubjectType: subjectType,
+		SubjectID:   subjectID,
+		After: gin.H{
+			"authorization_id": authorization.ID,
+			"status":           authorization.Status,
+			"reason_code":      authorization.ReasonCode,
+			"amount":           authorization.Amount,
+			"currency":         authorization.Currency,
+			"channel":          authorization.Channel,
+			"merchant_mcc":     authorization.MerchantMCC,
+		},
+	})
+
+	if card != nil {
+		h.notify(c.Request.Context(), card, authorization)
+
+		if authorization.Status == models.AuthorizationStatusApproved && card.CardType == models.CardTypePrepaid &&
+			h.prepaid.CrossedLowBalance(authorization.Amount, *authorization.AvailableBalance) {
+			notifyLowBalance(c.Request.Context(), h.notifier, card, *authorization.AvailableBalance, h.prepaid.LowBalanceThreshold(), authorization.Currency)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.AuthorizationResponse{
+		AuthorizationID:  authorization.ID,
+		Status:           authorization.Status,
+		ReasonCode:       authorization.ReasonCode,
+		Message:          authorizationMessages[authorization.ReasonCode],
+		Amount:           authorization.Amount,
+		Currency:         authorization.Currency,
+		AvailableBalance: authorization.AvailableBalance,
+	})
+}
+
+// Refund handles POST /v1/authorizations/:authorization_id/refund
+// Refunds of an authorization can add up to at most its amount, a prepaid card gets them back on its balance
+func (h *AuthorizationHandler) Refund(c *gin.Context) {
+	authorizationID := c.Param("authorization_id")
+	if _, err := uuid.Parse(authorizationID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Authorization not found"})
+		return
+	}
+
+	var req models.RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be greater than 0"})
+		return
+	}
+
+	refund, err := h.authorizer.Refund(c.Request.Context(), authorizationID, req.Amount)
+	switch {
+	case errors.Is(err, internal.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Authorization not found"})
+		return
+	case errors.Is(err, internal.ErrAuthorizationNotRefundable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only approved authorizations can be refunded"})
+		return
+	case errors.Is(err, internal.ErrRefundExceedsAuthorization):
+		c.JSON(http.StatusConflict, gin.H{"error": "Refunds cannot exceed the authorized amount"})
+		return
+	case errors.Is(err, internal.ErrPrepaidBalanceConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "Balance is being changed by another request, please retry"})
+		return
+	case err != nil:
+		log.Printf("Failed to refund authorization %s: %v", authorizationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refund authorization"})
+		return
+	}
+
+	log.Printf("Authorization %s refunded %d", authorizationID, req.Amount)
+	recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       models.AuditActorNetwork,
+		Action:      models.AuditActionCardRefunded,
+		SubjectType: models.AuditSubjectCard,
+		SubjectID:   refund.Transaction.CardID,
+		After: gin.H{
+			"authorization_id": authorizationID,
+			"transaction_id":   refund.Transaction.ID,
+			"amount":           refund.Transaction.Amount,
+			"currency":         refund.Transaction.Currency,
+		},
+	})
+
+	c.JSON(http.StatusOK, refund)
+}
+
+// notify tells the card owner about an authorization on their card, a failure is only logged
+func (h *AuthorizationHandler) notify(ctx context.Context, card *models.IssuedCardRecord, authorization *models.CardAuthorizationRecord) {
+	message := fmt.Sprintf("A %s payment of %s %s at %s with your card ending in %s was %s",
+		authorization.Channel, internal.FormatAmount(authorization.Amount), authorization.Currency,
+		authorization.MerchantName, card.PAN[max(len(card.PAN)-4, 0):], authorization.Status)
+	if authorization.Status == models.AuthorizationStatusDeclined {
+		message += ": " + authorizationMessages[authorization.ReasonCode]
+	}
+
+	event := models.NotificationEvent{
+		Type:    "card.authorization_" + authorization.Status,
+		Message: message,
+		Data: map[string]string{
+			"card_id":          card.ID,
+			"authorization_id": authorization.ID,
+			"reason_code":      authorization.ReasonCode,
+			"amount":           fmt.Sprint(authorization.Amount),
+			"currency":         authorization.Currency,
+			"merchant":         authorization.MerchantName,
+		},
+	}
+
+	if err := h.notifier.NotifyEvent(ctx, card.UserToken, event); err != nil {
+		log.Printf("Failed to notify authorization %s: %v", authorization.ID, err)
+	}
+}
@@ -1,39 +1,258 @@
 ﻿package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"cards/internal"
+	"cards/models"
+	"cards/validation"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type CardsHandler struct {
-	postgresService *internal.PostgresService
+	userStore internal.UserStore
+	cardStore internal.CardStore
+	auditor   *internal.Auditor
 }
 
-func NewCardsHandler(postgresService *internal.PostgresService) *CardsHandler {
+func NewCardsHandler(userStore internal.UserStore, cardStore internal.CardStore, auditor *internal.Auditor) *CardsHandler {
 	return &CardsHandler{
-		postgresService: postgresService,
+		userStore: userStore,
+		cardStore: cardStore,
+		auditor:   auditor,
 	}
 }
 
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
 // GetCardsByCitizenID handles GET /v1/:citizen_id/cards
 func (h *CardsHandler) GetCardsByCitizenID(c *gin.Context) {
-	citizenID := c.Param("citizen_id")
+	citizenID, ok := citizenIDParam(c)
+	if !ok {
+		return
+	}
+
+	userRecord, ok := h.getCitizen(c, citizenID)
+	if !ok {
+		return
+	}
+
+	listCards(c, h.cardStore, h.auditor, models.AuditActorAnonymous, userRecord.ID)
+}
+
+// GetAttemptsByCitizenID handles GET /v1/:citizen_id/attempts
+func (h *CardsHandler) GetAttemptsByCitizenID(c *gin.Context) {
+	citizenID, ok := citizenIDParam(c)
+	if !ok {
+		return
+	}
+
+	userRecord, ok := h.getCitizen(c, citizenID)
+	if !ok {
+		return
+	}
+
+	listFailedAttempts(c, h.cardStore, h.auditor, models.AuditActorAnonymous, userRecord.ID)
+}
+
+// citizenIDParam reads the citizen ID in the path in the form it is stored,
+// so it can be written with separators or in lower case
+func citizenIDParam(c *gin.Context) (string, bool) {
+	citizenID := validation.NormalizeCitizenID(c.Param("citizen_id"))
+	if !validation.IsCitizenID(citizenID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Citizen ID must contain only letters and digits"})
+		return "", false
+	}
 
-	// Validate that citizen_id contains only digits
-	if !isDigitsOnly(citizenID) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Citizen ID must contain only digits"})
+	return citizenID, true
+}
+
+func (h *CardsHandler) getCitizen(c *gin.Context, citizenID string) (*models.UserRecord, bool) {
+	userRecord, err := h.userStore.GetUserByCitizenID(c.Request.Context(), citizenID)
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Citizen not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get citizen"})
+		}
+		return nil, false
+	}
+
+	return userRecord, true
+}
+
+// listCards responds with the page of the user's cards selected by the query parameters,
+// once the actor reading them is audited
+func listCards(c *gin.Context, cardStore internal.CardStore, auditor *internal.Auditor, actor, userID string) {
+	query, ok := parseHistoryQuery(c)
+	if !ok {
+		return
+	}
+	query.CardType = c.Query("card_type")
+	query.Status = c.Query("status")
+	if query.Status != "" && !models.IsCardStatus(query.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown card status"})
 		return
 	}
 
-	// Get cards from database
-	fullCards, err := h.postgresService.GetCardsByCitizenID(citizenID)
+	page, err := cardStore.GetCardsByUserID(c.Request.Context(), userID, query)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Citizen not found or no cards available"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get cards"})
+		return
+	}
+
+	cardIDs := make([]string, 0, len(page.Cards))
+	for _, card := range page.Cards {
+		cardIDs = append(cardIDs, card.CardID)
+	}
+
+	if recordAudit(c, auditor, internal.AuditEvent{
+		Actor:       actor,
+		Action:      models.AuditActionCardsListed,
+		SubjectType: models.AuditSubjectUser,
+		SubjectID:   userID,
+		After:       gin.H{"card_ids": cardIDs},
+	}) != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// listFailedAttempts responds with the page of the user's failed attempts selected by the query parameters,
+// once the actor reading them is audited
+func listFailedAttempts(c *gin.Context, cardStore internal.CardStore, auditor *internal.Auditor, actor, userID string) {
+	query, ok := parseHistoryQuery(c)
+	if !ok {
 		return
 	}
+	query.CardType = c.Query("card_type")
+	query.Status = c.Query("status")
+
+	page, err := cardStore.GetFailedAttemptsByUserID(c.Request.Context(), userID, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get attempts"})
+		return
+	}
+
+	attemptIDs := make([]string, 0, len(page.Attempts))
+	for _, attempt := range page.Attempts {
+		attemptIDs = append(attemptIDs, attempt.AttemptID)
+	}
+
+	if recordAudit(c, auditor, internal.AuditEvent{
+		Actor:       actor,
+		Action:      models.AuditActionAttemptsListed,
+		SubjectType: models.AuditSubjectUser,
+		SubjectID:   userID,
+		After:       gin.H{"attempt_ids": attemptIDs},
+	}) != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// parseHistoryQuery reads the created_from, created_to, sort, limit and cursor
+// query parameters, responding with 400 when one is invalid
+func parseHistoryQuery(c *gin.Context) (models.HistoryQuery, bool) {
+	query := models.HistoryQuery{
+		Limit: defaultHistoryLimit,
+	}
+
+	switch c.DefaultQuery("sort", "desc") {
+	case "desc":
+	case "asc":
+		query.Ascending = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sort must be asc or desc"})
+		return query, false
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and " + strconv.Itoa(maxHistoryLimit)})
+			return query, false
+		}
+		query.Limit = limit
+	}
+
+	if value := c.Query("created_from"); value != "" {
+		createdFrom, err := parseHistoryTime(value, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "created_from must be a date or an RFC 3339 time"})
+			return query, false
+		}
+		query.CreatedFrom = &createdFrom
+	}
+
+	if value := c.Query("created_to"); value != "" {
+		createdTo, err := parseHistoryTime(value, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "created_to must be a date or an RFC 3339 time"})
+			return query, false
+		}
+		query.CreatedTo = &createdTo
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := models.DecodeHistoryCursor(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return query, false
+		}
+		query.After = cursor
+	}
+
+	return query, true
+}
+
+// parseHistoryTime accepts an RFC 3339 time or a YYYY-MM-DD date. A date used as the
+// end of a range covers the whole day, since the end of a range is exclusive.
+func parseHistoryTime(value string, endOfRange bool) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfRange {
+		parsed = parsed.AddDate(0, 0, 1)
+	}
+	return parsed, nil
+}
+
+// getOwnedCard loads the card in the path and checks it belongs to the user token.
+// Cards of a soft-deleted user are not found, so a deleted user cannot use or change them.
+func getOwnedCard(c *gin.Context, cardStore internal.CardStore, userToken string) (*models.IssuedCardRecord, bool) {
+	cardID := c.Param("card_id")
+	if _, err := uuid.Parse(cardID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Card not found"})
+		return nil, false
+	}
+
+	card, err := cardStore.GetOwnedCard(c.Request.Context(), cardID, userToken)
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Card not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get card"})
+		}
+		return nil, false
+	}
 
-	c.JSON(http.StatusOK, fullCards)
+	return card, true
 }
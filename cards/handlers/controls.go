@@ -0,0 +1,156 @@
+﻿package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"cards/internal"
+	"cards/models"
+	"cards/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ControlsHandler struct {
+	cardStore internal.CardStore
+	controls  *internal.SpendingControls
+	auditor   *internal.Auditor
+}
+
+func NewControlsHandler(cardStore internal.CardStore, controls *internal.SpendingControls, auditor *internal.Auditor) *ControlsHandler {
+	return &ControlsHandler{
+		cardStore: cardStore,
+		controls:  controls,
+		auditor:   auditor,
+	}
+}
+
+// Get handles GET /v1/cards/:card_id/controls?user_token=...
+// A card without controls reports the defaults, which do not restrict anything
+func (h *ControlsHandler) Get(c *gin.Context) {
+	userToken := c.Query("user_token")
+	if userToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_token is required"})
+		return
+	}
+
+	card, ok := getOwnedCard(c, h.cardStore, userToken)
+	if !ok {
+		return
+	}
+
+	controls, err := h.controls.Get(c.Request.Context(), card.ID)
+	if err != nil {
+		log.Printf("Failed to get controls of card %s: %v", card.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get card controls"})
+		return
+	}
+
+	c.JSON(http.StatusOK, controls)
+}
+
+// Put handles PUT /v1/cards/:card_id/controls
+// The request replaces every control of the card, omitted ones go back to their defaults
+func (h *ControlsHandler) Put(c *gin.Context) {
+	var req models.CardControlsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	card, ok := h.getControlledCard(c, req.UserToken)
+	if !ok {
+		return
+	}
+
+	controls, errs := validation.CardControls(card.ID, req)
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid card controls", "fields": errs})
+		return
+	}
+
+	before, err := h.controls.Get(c.Request.Context(), card.ID)
+	if err != nil {
+		log.Printf("Failed to get controls of card %s: %v", card.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get card controls"})
+		return
+	}
+
+	saved, err := h.cardStore.SaveCardControls(c.Request.Context(), controls)
+	if err != nil {
+		log.Printf("Failed to save controls of card %s: %v", card.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save card controls"})
+		return
+	}
+
+	log.Printf("Controls of card %s updated", card.ID)
+	h.audit(c, card, models.AuditActionCardControlsUpdated, before, saved)
+	c.JSON(http.StatusOK, saved)
+}
+
+// Delete handles DELETE /v1/cards/:card_id/controls?user_token=...
+// It removes every control of the card, which goes back to the defaults
+func (h *ControlsHandler) Delete(c *gin.Context) {
+	userToken := c.Query("user_token")
+	if userToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_token is required"})
+		return
+	}
+
+	card, ok := h.getControlledCard(c, userToken)
+	if !ok {
+		return
+	}
+
+	before, err := h.cardStore.GetCardControls(c.Request.Context(), card.ID)
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Card has no controls"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get card controls"})
+		}
+		return
+	}
+
+	if err := h.cardStore.DeleteCardControls(c.Request.Context(), card.ID); err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Card has no controls"})
+			return
+		}
+		log.Printf("Failed to delete controls of card %s: %v", card.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete card controls"})
+		return
+	}
+
+	log.Printf("Controls of card %s deleted", card.ID)
+	h.audit(c, card, models.AuditActionCardControlsDeleted, before, nil)
+	c.JSON(http.StatusOK, models.DefaultCardControls(card.ID))
+}
+
+// getControlledCard loads the card in the path for a controls change, which needs an active or blocked card
+func (h *ControlsHandler) getControlledCard(c *gin.Context, userToken string) (*models.IssuedCardRecord, bool) {
+	card, ok := getOwnedCard(c, h.cardStore, userToken)
+	if !ok {
+		return nil, false
+	}
+
+	if card.Status != models.CardStatusActive && card.Status != models.CardStatusBlocked {
+		c.JSON(http.StatusConflict, gin.H{"error": "Controls cannot be changed on a " + card.Status + " card", "status": card.Status})
+		return nil, false
+	}
+
+	return card, true
+}
+
+// audit records a controls change of the card owner, logging a failure
+func (h *ControlsHandler) audit(c *gin.Context, card *models.IssuedCardRecord, action string, before, after interface{}) {
+	recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       internal.UserActor(card.UserID),
+		Action:      action,
+		SubjectType: models.AuditSubjectCard,
+		SubjectID:   card.ID,
+		Before:      before,
+		After:       after,
+	})
+}
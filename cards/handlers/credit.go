@@ -0,0 +1,242 @@
+﻿package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"cards/internal"
+	"cards/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type CreditHandler struct {
+	cardStore internal.CardStore
+	credit    *internal.CreditLines
+	auditor   *internal.Auditor
+}
+
+func NewCreditHandler(cardStore internal.CardStore, credit *internal.CreditLines, auditor *internal.Auditor) *CreditHandler {
+	return &CreditHandler{
+		cardStore: cardStore,
+		credit:    credit,
+		auditor:   auditor,
+	}
+}
+
+// Credit handles GET /v1/cards/:card_id/credit?user_token=...
+func (h *CreditHandler) Credit(c *gin.Context) {
+	userToken := c.Query("user_token")
+	if userToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_token is required"})
+		return
+	}
+
+	card, ok := h.getCreditCard(c, userToken)
+	if !ok {
+		return
+	}
+
+	summary, err := h.credit.Get(c.Request.Context(), card.ID)
+	if err != nil {
+		log.Printf("Failed to get credit line of card %s: %v", card.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get credit line"})
+		return
+	}
+
+	if recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       internal.UserActor(card.UserID),
+		Action:      models.AuditActionBalanceViewed,
+		SubjectType: models.AuditSubjectCard,
+		SubjectID:   card.ID,
+	}) != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// Statements handles GET /v1/cards/:card_id/statements?user_token=...
+// It takes the paging parameters of the card history, newest first by default
+func (h *CreditHandler) Statements(c *gin.Context) {
+	userToken := c.Query("user_token")
+	if userToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_token is required"})
+		return
+	}
+
+	card, ok := h.getCreditCard(c, userToken)
+	if !ok {
+		return
+	}
+
+	query, ok := parseHistoryQuery(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.credit.Statements(c.Request.Context(), card.ID, query)
+	if err != nil {
+		log.Printf("Failed to get statements of card %s: %v", card.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get statements"})
+		return
+	}
+
+	if recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       internal.UserActor(card.UserID),
+		Action:      models.AuditActionStatementsListed,
+		SubjectType: models.AuditSubjectCard,
+		SubjectID:   card.ID,
+		After:       gin.H{"statements": len(page.Statements)},
+	}) != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// Statement handles GET /v1/cards/:card_id/statements/:statement_id?user_token=...&format=json|pdf
+// The statement is returned with the transactions of its billing cycle, as a PDF download when asked
+func (h *CreditHandler) Statement(c *gin.Context) {
+	userToken := c.Query("user_token")
+	if userToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_token is required"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be json or pdf"})
+		return
+	}
+
+	card, ok := h.getCreditCard(c, userToken)
+	if !ok {
+		return
+	}
+
+	statementID, ok := statementIDParam(c)
+	if !ok {
+		return
+	}
+
+	statement, err := h.credit.Statement(c.Request.Context(), card.ID, statementID)
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Statement not found"})
+		} else {
+			log.Printf("Failed to get statement %s: %v", statementID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get statement"})
+		}
+		return
+	}
+
+	if recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       internal.UserActor(card.UserID),
+		Action:      models.AuditActionStatementViewed,
+		SubjectType: models.AuditSubjectStatement,
+		SubjectID:   statement.ID,
+		After:       gin.H{"card_id": card.ID, "format": format},
+	}) != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	fileName := "statement-" + statement.PeriodEnd.UTC().Format("2006-01-02")
+
+	if format == "json" {
+		c.Header("Content-Disposition", `attachment; filename="`+fileName+`.json"`)
+		c.JSON(http.StatusOK, statement)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+fileName+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", internal.StatementPDF(*statement, card.PAN))
+}
+
+// Pay handles POST /v1/cards/:card_id/statements/:statement_id/payments
+// Only the latest statement of a card accepts payments, up to the balance the card owes
+func (h *CreditHandler) Pay(c *gin.Context) {
+	var req models.CreditPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be greater than 0"})
+		return
+	}
+
+	card, ok := h.getCreditCard(c, req.UserToken)
+	if !ok {
+		return
+	}
+
+	statementID, ok := statementIDParam(c)
+	if !ok {
+		return
+	}
+
+	payment, err := h.credit.Pay(c.Request.Context(), card.ID, statementID, req.Amount)
+	switch {
+	case errors.Is(err, internal.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Statement not found"})
+		return
+	case errors.Is(err, internal.ErrStatementNotPayable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only the latest statement accepts payments"})
+		return
+	case errors.Is(err, internal.ErrPaymentExceedsBalance):
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment exceeds the outstanding balance"})
+		return
+	case err != nil:
+		log.Printf("Failed to pay statement %s: %v", statementID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pay statement"})
+		return
+	}
+
+	log.Printf("Statement %s of card %s paid %d", statementID, card.ID, req.Amount)
+	recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       internal.UserActor(card.UserID),
+		Action:      models.AuditActionStatementPaid,
+		SubjectType: models.AuditSubjectStatement,
+		SubjectID:   statementID,
+		After: gin.H{
+			"card_id":        card.ID,
+			"amount":         req.Amount,
+			"paid_amount":    payment.Statement.PaidAmount,
+			"status":         payment.Statement.Status,
+			"transaction_id": payment.Transaction.ID,
+		},
+	})
+
+	c.JSON(http.StatusOK, payment)
+}
+
+// getCreditCard loads the card in the path for its owner, rejecting cards that are not credit cards
+func (h *CreditHandler) getCreditCard(c *gin.Context, userToken string) (*models.IssuedCardRecord, bool) {
+	card, ok := getOwnedCard(c, h.cardStore, userToken)
+	if !ok {
+		return nil, false
+	}
+
+	if card.CardType != models.CardTypeCredit {
+		c.JSON(http.StatusConflict, gin.H{"error": "Card is not a credit card", "card_type": card.CardType})
+		return nil, false
+	}
+
+	return card, true
+}
+
+// statementIDParam reads the statement ID in the path, which has to be a UUID
+func statementIDParam(c *gin.Context) (string, bool) {
+	statementID := c.Param("statement_id")
+	if _, err := uuid.Parse(statementID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Statement not found"})
+		return "", false
+	}
+	return statementID, true
+}
@@ -0,0 +1,119 @@
+﻿package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"cards/internal"
+	"cards/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyKeyMaxLength   = 255
+	idempotencyKeyLockTimeout = time.Minute
+	idempotencyKeyTTL         = 24 * time.Hour
+)
+
+type IdempotencyHandler struct {
+	requestStore internal.RequestStore
+}
+
+func NewIdempotencyHandler(requestStore internal.RequestStore) *IdempotencyHandler {
+	return &IdempotencyHandler{
+		requestStore: requestStore,
+	}
+}
+
+// responseRecorder keeps a copy of the response body written by the handler
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Middleware replays the stored response for requests repeating an Idempotency-Key.
+// The same key with a different request body is rejected with 422.
+func (h *IdempotencyHandler) Middleware(c *gin.Context) {
+	key := c.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		c.Next()
+		return
+	}
+
+	if len(key) > idempotencyKeyMaxLength {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	scope := c.Request.Method + " " + c.Request.URL.Path
+	sum := sha256.Sum256(append([]byte(scope+"\n"), body...))
+	requestHash := hex.EncodeToString(sum[:])
+
+	record, claimed, err := h.requestStore.ClaimIdempotencyKey(c.Request.Context(), scope, key, requestHash, idempotencyKeyLockTimeout, idempotencyKeyTTL)
+	if err != nil {
+		log.Printf("Failed to claim idempotency key %s: %v", key, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+		return
+	}
+
+	if !claimed {
+		switch {
+		case record.RequestHash != requestHash:
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+		case record.Status == models.IdempotencyStatusInProgress:
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+		default:
+			log.Printf("Replaying stored response for idempotency key %s", key)
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.StatusCode, record.ContentType, []byte(record.ResponseBody))
+			c.Abort()
+		}
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+
+	c.Next()
+
+	// The outcome is kept even when the client went away, its retry gets the stored response
+	ctx := context.WithoutCancel(c.Request.Context())
+
+	// Server errors are not stored so the client can retry with the same key
+	if recorder.Status() >= http.StatusInternalServerError {
+		if err := h.requestStore.ReleaseIdempotencyKey(ctx, scope, key); err != nil {
+			log.Printf("Failed to release idempotency key %s: %v", key, err)
+		}
+		return
+	}
+
+	err = h.requestStore.CompleteIdempotencyKey(ctx, scope, key, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.String())
+	if err != nil {
+		log.Printf("Failed to store response for idempotency key %s: %v", key, err)
+	}
+}
@@ -1,29 +1,27 @@
 ﻿package handlers
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"os"
 
 	"cards/internal"
 	"cards/models"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 type IssueHandler struct {
-	redisService    *internal.RedisService
-	postgresService *internal.PostgresService
+	userRepository *internal.UserRepository
+	products       *internal.ProductCatalog
+	submitter      *requestSubmitter
 }
 
-func NewIssueHandler(redisService *internal.RedisService, postgresService *internal.PostgresService) *IssueHandler {
+func NewIssueHandler(sessionStore internal.SessionStore, requestStore internal.RequestStore, userRepository *internal.UserRepository, policy *internal.IssuancePolicy, products *internal.ProductCatalog, auditor *internal.Auditor) *IssueHandler {
 	return &IssueHandler{
-		redisService:    redisService,
-		postgresService: postgresService,
+		userRepository: userRepository,
+		products:       products,
+		submitter:      newRequestSubmitter(sessionStore, requestStore, policy, auditor),
 	}
 }
 
@@ -35,56 +33,43 @@ func (h *IssueHandler) Issue(c *gin.Context) {
 	}
 
 	log.Printf("Received card issue request for: %v", req)
-	ctx := context.Background()
+	ctx := c.Request.Context()
 
-	user, err := h.redisService.GetUser(ctx, req.UserToken)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	if !h.checkCardType(c, req.CardType) {
 		return
 	}
 
-	requestUUID := uuid.New().String()
-
-	issueRequest := models.IssueRequest{
-		Name:            user.Name,
-		Lastname:        user.Lastname,
-		BirthDate:       user.BirthDate,
-		CountryCode:     user.CountryCode,
-		CardType:        req.CardType,
-		SuscriptorToken: os.Getenv("SUSCRIPTOR_TOKEN"),
-		RequestUUID:     requestUUID,
-	}
-
-	requestData := models.RequestData{
-		User:      *user,
-		CardType:  req.CardType,
-		UserToken: req.UserToken,
-	}
-
-	if err := h.redisService.StoreRequest(ctx, requestUUID, requestData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store request"})
+	user, err := h.userRepository.Get(ctx, req.UserToken)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	log.Printf("Storing request in Redis for user UUID and request UUID: %s and %s", req.UserToken, requestUUID)
-	webhookURL := os.Getenv("WEBHOOK_URL")
-	if webhookURL == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "WEBHOOK_URL not configured"})
+	requestUUID, ok := h.submitter.submit(c, user, req.UserToken, req.CardType, "")
+	if !ok {
 		return
 	}
 
-	requestJSON, err := json.Marshal(issueRequest)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal request"})
-		return
+	c.JSON(http.StatusAccepted, gin.H{"request_uuid": requestUUID})
+}
+
+// checkCardType rejects card types missing from the issuer's product catalog, writing the error response.
+// Every card type is let through when no catalog is configured.
+func (h *IssueHandler) checkCardType(c *gin.Context, cardType string) bool {
+	if !h.products.Enabled() {
+		return true
 	}
 
-	resp, err := http.Post(webhookURL, "application/json", bytes.NewBuffer(requestJSON))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send request to webhook"})
-		return
+	_, err := h.products.Find(c.Request.Context(), cardType)
+	switch {
+	case errors.Is(err, internal.ErrUnknownCardProduct):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown card type", "card_type": cardType})
+		return false
+	case err != nil:
+		log.Printf("Failed to get card product catalog: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Card product catalog is unavailable, please retry"})
+		return false
 	}
-	defer resp.Body.Close()
 
-	c.Status(http.StatusAccepted)
+	return true
 }
@@ -0,0 +1,76 @@
+﻿package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"cards/internal"
+	"cards/models"
+)
+
+func TestIssueSubmitsRequest(t *testing.T) {
+	server := newTestServer(t)
+	token := server.register(t, "123")
+
+	requestUUID := server.issue(t, token, "debit")
+
+	request, err := server.store.GetCardRequest(t.Context(), requestUUID)
+	if err != nil {
+		t.Fatalf("request not stored: %v", err)
+	}
+	if request.Status != models.CardRequestStatusSubmitted || request.UserToken != token || request.CardType != "debit" {
+		t.Errorf("stored request = %+v", request)
+	}
+
+	data, err := server.sessions.GetRequest(t.Context(), requestUUID)
+	if err != nil {
+		t.Fatalf("request data not cached: %v", err)
+	}
+	if data.UserToken != token || data.CardType != "debit" {
+		t.Errorf("cached request data = %+v", data)
+	}
+
+	if !contains(server.auditActions(t), models.AuditActionCardRequestSubmitted) {
+		t.Errorf("submission not audited")
+	}
+}
+
+func TestIssueRefusesSecondPendingRequestOfType(t *testing.T) {
+	server := newTestServer(t)
+	token := server.register(t, "123")
+	server.issue(t, token, "debit")
+
+	recorder := server.do(t, http.MethodPost, "/v1/issue", models.IssueCardRequest{UserToken: token, CardType: "debit"}, nil)
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("status %d, want 409, body %s", recorder.Code, recorder.Body)
+	}
+
+	var response struct {
+		Violation internal.PolicyViolation `json:"violation"`
+	}
+	decode(t, recorder, &response)
+	if response.Violation.Rule != internal.PolicyRulePendingRequest {
+		t.Errorf("rule = %q, want %s", response.Violation.Rule, internal.PolicyRulePendingRequest)
+	}
+
+	// Another card type is not held back
+	server.issue(t, token, models.CardTypeCredit)
+}
+
+func TestIssueRejectsUnknownUser(t *testing.T) {
+	server := newTestServer(t)
+
+	recorder := server.do(t, http.MethodPost, "/v1/issue", models.IssueCardRequest{UserToken: "unknown", CardType: "debit"}, nil)
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404, body %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestIssueRejectsMissingFields(t *testing.T) {
+	server := newTestServer(t)
+
+	recorder := server.do(t, http.MethodPost, "/v1/issue", map[string]string{"card_type": "debit"}, nil)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400, body %s", recorder.Code, recorder.Body)
+	}
+}
@@ -0,0 +1,104 @@
+﻿package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"cards/internal"
+	"cards/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LedgerHandler struct {
+	cardStore   internal.CardStore
+	ledgerStore internal.LedgerStore
+	authorizer  *internal.Authorizer
+	auditor     *internal.Auditor
+}
+
+func NewLedgerHandler(cardStore internal.CardStore, ledgerStore internal.LedgerStore, authorizer *internal.Authorizer, auditor *internal.Auditor) *LedgerHandler {
+	return &LedgerHandler{
+		cardStore:   cardStore,
+		ledgerStore: ledgerStore,
+		authorizer:  authorizer,
+		auditor:     auditor,
+	}
+}
+
+// Balance handles GET /v1/cards/:card_id/balance?user_token=...
+func (h *LedgerHandler) Balance(c *gin.Context) {
+	card, ok := h.getLedgerCard(c)
+	if !ok {
+		return
+	}
+
+	balance, err := h.ledgerStore.GetCardBalance(c.Request.Context(), card.ID, h.authorizer.Currency())
+	if err != nil {
+		log.Printf("Failed to get balance of card %s: %v", card.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get balance"})
+		return
+	}
+
+	if recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       internal.UserActor(card.UserID),
+		Action:      models.AuditActionBalanceViewed,
+		SubjectType: models.AuditSubjectCard,
+		SubjectID:   card.ID,
+	}) != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, balance)
+}
+
+// Transactions handles GET /v1/cards/:card_id/transactions?user_token=...
+// It takes the paging parameters of the card history, newest first by default
+func (h *LedgerHandler) Transactions(c *gin.Context) {
+	card, ok := h.getLedgerCard(c)
+	if !ok {
+		return
+	}
+
+	query, ok := parseHistoryQuery(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.ledgerStore.GetLedgerTransactions(c.Request.Context(), card.ID, query)
+	if err != nil {
+		log.Printf("Failed to get transactions of card %s: %v", card.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get transactions"})
+		return
+	}
+
+	transactionIDs := make([]string, 0, len(page.Transactions))
+	for _, transaction := range page.Transactions {
+		transactionIDs = append(transactionIDs, transaction.ID)
+	}
+
+	if recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       internal.UserActor(card.UserID),
+		Action:      models.AuditActionTransactionsListed,
+		SubjectType: models.AuditSubjectCard,
+		SubjectID:   card.ID,
+		After:       gin.H{"transaction_ids": transactionIDs},
+	}) != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// getLedgerCard loads the card in the path for its owner, identified by the user_token query parameter
+func (h *LedgerHandler) getLedgerCard(c *gin.Context) (*models.IssuedCardRecord, bool) {
+	userToken := c.Query("user_token")
+	if userToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_token is required"})
+		return nil, false
+	}
+
+	return getOwnedCard(c, h.cardStore, userToken)
+}
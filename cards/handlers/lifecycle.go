@@ -0,0 +1,158 @@
+﻿package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"cards/internal"
+	"cards/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CardLifecycleHandler struct {
+	cardStore      internal.CardStore
+	requestStore   internal.RequestStore
+	userRepository *internal.UserRepository
+	submitter      *requestSubmitter
+	auditor        *internal.Auditor
+}
+
+func NewCardLifecycleHandler(cardStore internal.CardStore, sessionStore internal.SessionStore, requestStore internal.RequestStore, userRepository *internal.UserRepository, policy *internal.IssuancePolicy, auditor *internal.Auditor) *CardLifecycleHandler {
+	return &CardLifecycleHandler{
+		cardStore:      cardStore,
+		requestStore:   requestStore,
+		userRepository: userRepository,
+		submitter:      newRequestSubmitter(sessionStore, requestStore, policy, auditor),
+		auditor:        auditor,
+	}
+}
+
+// Block handles POST /v1/cards/:card_id/block
+func (h *CardLifecycleHandler) Block(c *gin.Context) {
+	h.changeStatus(c, models.CardStatusBlocked)
+}
+
+// Unblock handles POST /v1/cards/:card_id/unblock
+func (h *CardLifecycleHandler) Unblock(c *gin.Context) {
+	h.changeStatus(c, models.CardStatusActive)
+}
+
+// Cancel handles POST /v1/cards/:card_id/cancel
+func (h *CardLifecycleHandler) Cancel(c *gin.Context) {
+	h.changeStatus(c, models.CardStatusCancelled)
+}
+
+// Replace handles POST /v1/cards/:card_id/replace
+func (h *CardLifecycleHandler) Replace(c *gin.Context) {
+	var req models.ReplaceCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	card, ok := getOwnedCard(c, h.cardStore, req.UserToken)
+	if !ok {
+		return
+	}
+
+	log.Printf("Received card replace request for card %s: %s", card.ID, req.Reason)
+
+	if h.hasPendingReplacement(c, card) {
+		return
+	}
+
+	// A card already reported lost or stolen can be replaced again if the previous replacement was declined
+	if card.Status != models.CardStatusLost && card.Status != models.CardStatusStolen {
+		if !h.applyStatusChange(c, card, req.Reason, req.Reason) {
+			return
+		}
+	}
+
+	user, err := h.userRepository.Get(c.Request.Context(), req.UserToken)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	requestUUID, ok := h.submitter.submit(c, user, req.UserToken, card.CardType, card.ID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"request_uuid": requestUUID})
+}
+
+func (h *CardLifecycleHandler) changeStatus(c *gin.Context, to string) {
+	var req models.CardStatusChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	card, ok := getOwnedCard(c, h.cardStore, req.UserToken)
+	if !ok {
+		return
+	}
+
+	log.Printf("Received card status change request for card %s: %s -> %s", card.ID, card.Status, to)
+
+	// A cancelled card cannot be superseded, so it waits for its replacement to arrive
+	if to == models.CardStatusCancelled && h.hasPendingReplacement(c, card) {
+		return
+	}
+
+	if !h.applyStatusChange(c, card, to, req.Reason) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"card_id": card.ID, "status": to})
+}
+
+// hasPendingReplacement refuses a change while a replacement or renewal of the card is waiting for the issuer,
+// writing the error response when there is one
+func (h *CardLifecycleHandler) hasPendingReplacement(c *gin.Context, card *models.IssuedCardRecord) bool {
+	pending, err := h.requestStore.HasPendingReplacement(c.Request.Context(), card.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check card requests"})
+		return true
+	}
+	if pending {
+		c.JSON(http.StatusConflict, gin.H{"error": "A replacement of this card is already pending"})
+		return true
+	}
+	return false
+}
+
+// applyStatusChange moves the card to the given status, writing the error response on failure
+func (h *CardLifecycleHandler) applyStatusChange(c *gin.Context, card *models.IssuedCardRecord, to, reason string) bool {
+	if !models.CanTransitionCardStatus(card.Status, to) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Card cannot move from " + card.Status + " to " + to,
+			"status": card.Status,
+		})
+		return false
+	}
+
+	actor := internal.UserActor(card.UserID)
+	if err := h.cardStore.ChangeCardStatus(c.Request.Context(), card.ID, card.Status, to, actor, reason); err != nil {
+		if errors.Is(err, internal.ErrCardStatusConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Card status changed, please retry"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change card status"})
+		return false
+	}
+
+	recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       actor,
+		Action:      models.AuditActionCardStatusChanged,
+		SubjectType: models.AuditSubjectCard,
+		SubjectID:   card.ID,
+		Before:      gin.H{"status": card.Status},
+		After:       gin.H{"status": to},
+	})
+
+	return true
+}
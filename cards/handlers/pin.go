@@ -0,0 +1,287 @@
+﻿package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"cards/internal"
+	"cards/models"
+	"cards/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const defaultPINMaxAttempts = 3
+
+type PINHandler struct {
+	cardStore   internal.CardStore
+	notifier    *internal.Notifier
+	auditor     *internal.Auditor
+	hasher      *internal.PINHasher
+	maxAttempts int
+}
+
+func NewPINHandler(cardStore internal.CardStore, notifier *internal.Notifier, auditor *internal.Auditor) *PINHandler {
+	maxAttempts := defaultPINMaxAttempts
+	if value, err := strconv.Atoi(os.Getenv("PIN_MAX_ATTEMPTS")); err == nil && value > 0 {
+		maxAttempts = value
+	}
+
+	return &PINHandler{
+		cardStore:   cardStore,
+		notifier:    notifier,
+		auditor:     auditor,
+		hasher:      internal.NewPINHasher(),
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Set handles POST /v1/cards/:card_id/pin
+// It sets the first PIN of a card, a PIN already set is replaced with Change
+func (h *PINHandler) Set(c *gin.Context) {
+	var req models.SetPINRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	card, ok := h.getPINCard(c, req.UserToken)
+	if !ok {
+		return
+	}
+
+	pinHash, ok := h.hashNewPIN(c, card, "pin", req.PIN)
+	if !ok {
+		return
+	}
+
+	if err := h.cardStore.CreateCardPIN(c.Request.Context(), card.ID, pinHash); err != nil {
+		if errors.Is(err, internal.ErrCardPINAlreadySet) {
+			c.JSON(http.StatusConflict, gin.H{"error": "PIN already set, change it with the current PIN"})
+			return
+		}
+		log.Printf("Failed to set PIN of card %s: %v", card.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set PIN"})
+		return
+	}
+
+	log.Printf("PIN set for card %s", card.ID)
+	h.audit(c, card, models.AuditActionCardPINSet, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"card_id": card.ID, "status": "pin set"})
+}
+
+// Change handles POST /v1/cards/:card_id/pin/change
+// The current PIN is verified first, so a wrong one counts as a failed attempt
+func (h *PINHandler) Change(c *gin.Context) {
+	var req models.ChangePINRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	card, ok := h.getPINCard(c, req.UserToken)
+	if !ok {
+		return
+	}
+
+	pinHash, ok := h.hashNewPIN(c, card, "new_pin", req.NewPIN)
+	if !ok {
+		return
+	}
+
+	if !h.verify(c, card, req.CurrentPIN) {
+		return
+	}
+
+	if err := h.cardStore.ChangeCardPIN(c.Request.Context(), card.ID, pinHash); err != nil {
+		if errors.Is(err, internal.ErrCardPINLocked) {
+			c.JSON(http.StatusLocked, gin.H{"error": "PIN is locked"})
+			return
+		}
+		log.Printf("Failed to change PIN of card %s: %v", card.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change PIN"})
+		return
+	}
+
+	log.Printf("PIN changed for card %s", card.ID)
+	h.audit(c, card, models.AuditActionCardPINChanged, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"card_id": card.ID, "status": "pin changed"})
+}
+
+// Verify handles POST /v1/cards/:card_id/pin/verify
+func (h *PINHandler) Verify(c *gin.Context) {
+	var req models.VerifyPINRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	card, ok := getOwnedCard(c, h.cardStore, req.UserToken)
+	if !ok {
+		return
+	}
+
+	// Only a card that can be used has its PIN checked
+	if card.Status != models.CardStatusActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "Card is " + card.Status, "status": card.Status})
+		return
+	}
+
+	if !h.verify(c, card, req.PIN) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"card_id": card.ID, "verified": true})
+}
+
+// Unlock handles POST /admin/v1/cards/:card_id/pin/unlock
+func (h *PINHandler) Unlock(c *gin.Context) {
+	cardID := c.Param("card_id")
+	if _, err := uuid.Parse(cardID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Card not found"})
+		return
+	}
+
+	card, err := h.cardStore.GetIssuedCardByID(c.Request.Context(), cardID)
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Card not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get card"})
+		}
+		return
+	}
+
+	if err := h.cardStore.UnlockCardPIN(c.Request.Context(), card.ID); err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			c.JSON(http.StatusConflict, gin.H{"error": "PIN is not locked"})
+		} else {
+			log.Printf("Failed to unlock PIN of card %s: %v", card.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock PIN"})
+		}
+		return
+	}
+
+	log.Printf("PIN of card %s unlocked by admin", card.ID)
+	recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       models.AuditActorAdmin,
+		Action:      models.AuditActionCardPINUnlocked,
+		SubjectType: models.AuditSubjectCard,
+		SubjectID:   card.ID,
+		Before:      gin.H{"locked": true},
+		After:       gin.H{"locked": false},
+	})
+	c.JSON(http.StatusOK, gin.H{"card_id": card.ID, "status": "pin unlocked"})
+}
+
+// getPINCard loads the card in the path for a PIN change, which needs an active or blocked card
+func (h *PINHandler) getPINCard(c *gin.Context, userToken string) (*models.IssuedCardRecord, bool) {
+	card, ok := getOwnedCard(c, h.cardStore, userToken)
+	if !ok {
+		return nil, false
+	}
+
+	if card.Status != models.CardStatusActive && card.Status != models.CardStatusBlocked {
+		c.JSON(http.StatusConflict, gin.H{"error": "PIN cannot be set on a " + card.Status + " card", "status": card.Status})
+		return nil, false
+	}
+
+	return card, true
+}
+
+// hashNewPIN checks a new PIN and hashes it, writing the error response on failure
+func (h *PINHandler) hashNewPIN(c *gin.Context, card *models.IssuedCardRecord, field, pin string) (string, bool) {
+	if err := validation.PIN(pin); err != nil {
+		var errs validation.Errors
+		errs.Add(field, err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid PIN", "fields": errs})
+		return "", false
+	}
+
+	pinHash, err := h.hasher.Hash(card.ID, pin)
+	if err != nil {
+		log.Printf("Failed to hash PIN of card %s: %v", card.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash PIN"})
+		return "", false
+	}
+
+	return pinHash, true
+}
+
+// verify checks the PIN of a card, locking the PIN after the last allowed failure.
+// The attempt is counted before the slow comparison and only cleared when the PIN matches,
+// so parallel guesses cannot get past the limit.
+// It writes the error response and returns false when the PIN is not accepted.
+func (h *PINHandler) verify(c *gin.Context, card *models.IssuedCardRecord, pin string) bool {
+	record, err := h.cardStore.RecordCardPINAttempt(c.Request.Context(), card.ID, h.maxAttempts)
+	if err != nil {
+		switch {
+		case errors.Is(err, internal.ErrNotFound):
+			c.JSON(http.StatusConflict, gin.H{"error": "PIN not set"})
+		case errors.Is(err, internal.ErrCardPINLocked):
+			c.JSON(http.StatusLocked, gin.H{"error": "PIN is locked after too many failed attempts"})
+		default:
+			log.Printf("Failed to record PIN attempt of card %s: %v", card.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify PIN"})
+		}
+		return false
+	}
+
+	if h.hasher.Matches(record.PINHash, card.ID, pin) {
+		if err := h.cardStore.ResetCardPINAttempts(c.Request.Context(), card.ID, record.FailedAttempts); err != nil {
+			log.Printf("Failed to reset PIN attempts of card %s: %v", card.ID, err)
+		}
+		h.audit(c, card, models.AuditActionCardPINVerified, nil, gin.H{"success": true})
+		return true
+	}
+
+	locked := record.LockedAt != nil
+	h.audit(c, card, models.AuditActionCardPINVerified, nil, gin.H{
+		"success":         false,
+		"failed_attempts": record.FailedAttempts,
+		"locked":          locked,
+	})
+
+	if locked {
+		log.Printf("PIN of card %s locked after %d failed attempts", card.ID, record.FailedAttempts)
+		h.notifyLocked(c.Request.Context(), card)
+		c.JSON(http.StatusLocked, gin.H{"error": "PIN is locked after too many failed attempts"})
+		return false
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error":              "Invalid PIN",
+		"attempts_remaining": h.maxAttempts - record.FailedAttempts,
+	})
+	return false
+}
+
+// notifyLocked tells the card owner their PIN was locked, a failure is only logged
+func (h *PINHandler) notifyLocked(ctx context.Context, card *models.IssuedCardRecord) {
+	event := models.NotificationEvent{
+		Type:    "card.pin_locked",
+		Message: "The PIN of your card ending in " + card.PAN[max(len(card.PAN)-4, 0):] + " was locked after too many failed attempts",
+		Data:    map[string]string{"card_id": card.ID},
+	}
+
+	if err := h.notifier.NotifyEvent(ctx, card.UserToken, event); err != nil {
+		log.Printf("Failed to notify PIN lock of card %s: %v", card.ID, err)
+	}
+}
+
+// audit records a PIN event of the card owner, logging a failure
+func (h *PINHandler) audit(c *gin.Context, card *models.IssuedCardRecord, action string, before, after interface{}) {
+	recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       internal.UserActor(card.UserID),
+		Action:      action,
+		SubjectType: models.AuditSubjectCard,
+		SubjectID:   card.ID,
+		Before:      before,
+		After:       after,
+	})
+}
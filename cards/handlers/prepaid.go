@@ -0,0 +1,210 @@
+﻿package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"cards/internal"
+	"cards/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PrepaidHandler struct {
+	cardStore internal.CardStore
+	prepaid   *internal.PrepaidAccounts
+	notifier  *internal.Notifier
+	auditor   *internal.Auditor
+}
+
+func NewPrepaidHandler(cardStore internal.CardStore, prepaid *internal.PrepaidAccounts, notifier *internal.Notifier, auditor *internal.Auditor) *PrepaidHandler {
+	return &PrepaidHandler{
+		cardStore: cardStore,
+		prepaid:   prepaid,
+		notifier:  notifier,
+		auditor:   auditor,
+	}
+}
+
+// Get handles GET /v1/cards/:card_id/prepaid?user_token=...
+// A card that was never topped up has a zero balance
+func (h *PrepaidHandler) Get(c *gin.Context) {
+	userToken := c.Query("user_token")
+	if userToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_token is required"})
+		return
+	}
+
+	card, ok := h.getPrepaidCard(c, userToken)
+	if !ok {
+		return
+	}
+
+	account, err := h.prepaid.Get(c.Request.Context(), card.ID)
+	if err != nil {
+		log.Printf("Failed to get prepaid balance of card %s: %v", card.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get balance"})
+		return
+	}
+
+	if recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       internal.UserActor(card.UserID),
+		Action:      models.AuditActionBalanceViewed,
+		SubjectType: models.AuditSubjectCard,
+		SubjectID:   card.ID,
+	}) != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// TopUp handles POST /v1/cards/:card_id/prepaid/top-up
+func (h *PrepaidHandler) TopUp(c *gin.Context) {
+	h.changeBalance(c, models.PrepaidChangeTopUp)
+}
+
+// Withdraw handles POST /v1/cards/:card_id/prepaid/withdraw
+// A withdrawal larger than the balance is rejected with 409
+func (h *PrepaidHandler) Withdraw(c *gin.Context) {
+	h.changeBalance(c, models.PrepaidChangeWithdrawal)
+}
+
+// History handles GET /v1/cards/:card_id/prepaid/history?user_token=...
+// It takes the paging parameters of the card history, newest first by default
+func (h *PrepaidHandler) History(c *gin.Context) {
+	userToken := c.Query("user_token")
+	if userToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_token is required"})
+		return
+	}
+
+	card, ok := h.getPrepaidCard(c, userToken)
+	if !ok {
+		return
+	}
+
+	query, ok := parseHistoryQuery(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.prepaid.History(c.Request.Context(), card.ID, query)
+	if err != nil {
+		log.Printf("Failed to get balance history of card %s: %v", card.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get balance history"})
+		return
+	}
+
+	if recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       internal.UserActor(card.UserID),
+		Action:      models.AuditActionPrepaidHistoryListed,
+		SubjectType: models.AuditSubjectCard,
+		SubjectID:   card.ID,
+		After:       gin.H{"changes": len(page.Changes)},
+	}) != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// changeBalance tops up or withdraws from the prepaid card in the path, which has to be active
+func (h *PrepaidHandler) changeBalance(c *gin.Context, changeType string) {
+	var req models.PrepaidAmountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be greater than 0"})
+		return
+	}
+
+	card, ok := h.getPrepaidCard(c, req.UserToken)
+	if !ok {
+		return
+	}
+
+	if card.Status != models.CardStatusActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "Balance cannot be changed on a " + card.Status + " card", "status": card.Status})
+		return
+	}
+
+	var change *models.PrepaidBalanceChangeRecord
+	var err error
+	action := models.AuditActionPrepaidToppedUp
+	if changeType == models.PrepaidChangeWithdrawal {
+		change, err = h.prepaid.Withdraw(c.Request.Context(), card.ID, req.Amount)
+		action = models.AuditActionPrepaidWithdrawn
+	} else {
+		change, err = h.prepaid.TopUp(c.Request.Context(), card.ID, req.Amount)
+	}
+
+	switch {
+	case errors.Is(err, internal.ErrInsufficientFunds):
+		c.JSON(http.StatusConflict, gin.H{"error": "Insufficient funds"})
+		return
+	case errors.Is(err, internal.ErrPrepaidBalanceConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "Balance is being changed by another request, please retry"})
+		return
+	case err != nil:
+		log.Printf("Failed to change prepaid balance of card %s: %v", card.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change balance"})
+		return
+	}
+
+	log.Printf("Prepaid balance of card %s changed by %s %d", card.ID, change.Type, change.Amount)
+	recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       internal.UserActor(card.UserID),
+		Action:      action,
+		SubjectType: models.AuditSubjectCard,
+		SubjectID:   card.ID,
+		After:       change,
+	})
+
+	if changeType == models.PrepaidChangeWithdrawal && h.prepaid.CrossedLowBalance(change.Amount, change.BalanceAfter) {
+		notifyLowBalance(c.Request.Context(), h.notifier, card, change.BalanceAfter, h.prepaid.LowBalanceThreshold(), change.Currency)
+	}
+
+	c.JSON(http.StatusOK, change)
+}
+
+// getPrepaidCard loads the card in the path for its owner, rejecting cards that are not prepaid
+func (h *PrepaidHandler) getPrepaidCard(c *gin.Context, userToken string) (*models.IssuedCardRecord, bool) {
+	card, ok := getOwnedCard(c, h.cardStore, userToken)
+	if !ok {
+		return nil, false
+	}
+
+	if card.CardType != models.CardTypePrepaid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Card is not a prepaid card", "card_type": card.CardType})
+		return nil, false
+	}
+
+	return card, true
+}
+
+// notifyLowBalance tells the owner of a prepaid card its balance fell below the threshold, a failure is only logged
+func notifyLowBalance(ctx context.Context, notifier *internal.Notifier, card *models.IssuedCardRecord, balance, threshold int64, currency string) {
+	event := models.NotificationEvent{
+		Type: "card.prepaid_low_balance",
+		Message: fmt.Sprintf("The balance of your prepaid card ending in %s is down to %s %s",
+			card.PAN[max(len(card.PAN)-4, 0):], internal.FormatAmount(balance), currency),
+		Data: map[string]string{
+			"card_id":   card.ID,
+			"balance":   fmt.Sprint(balance),
+			"threshold": fmt.Sprint(threshold),
+			"currency":  currency,
+		},
+	}
+
+	if err := notifier.NotifyEvent(ctx, card.UserToken, event); err != nil {
+		log.Printf("Failed to notify low balance of card %s: %v", card.ID, err)
+	}
+}
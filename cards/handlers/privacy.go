@@ -0,0 +1,457 @@
+﻿package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cards/internal"
+	"cards/models"
+	"cards/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// PrivacyHandler serves data subject requests: exporting and erasing a citizen's data
+type PrivacyHandler struct {
+	userStore    internal.UserStore
+	cardStore    internal.CardStore
+	requestStore internal.RequestStore
+	ledgerStore  internal.LedgerStore
+	sessionStore internal.SessionStore
+	notifier     *internal.Notifier
+	auditor      *internal.Auditor
+}
+
+func NewPrivacyHandler(userStore internal.UserStore, cardStore internal.CardStore, requestStore internal.RequestStore, ledgerStore internal.LedgerStore, sessionStore internal.SessionStore, notifier *internal.Notifier, auditor *internal.Auditor) *PrivacyHandler {
+	return &PrivacyHandler{
+		userStore:    userStore,
+		cardStore:    cardStore,
+		requestStore: requestStore,
+		ledgerStore:  ledgerStore,
+		sessionStore: sessionStore,
+		notifier:     notifier,
+		auditor:      auditor,
+	}
+}
+
+// Export handles GET /admin/v1/citizens/:citizen_id/export?format=json|zip
+func (h *PrivacyHandler) Export(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be json or zip"})
+		return
+	}
+
+	userRecord, ok := h.getCitizen(c)
+	if !ok {
+		return
+	}
+
+	export, err := h.collect(c.Request.Context(), userRecord)
+	if err != nil {
+		log.Printf("Failed to export user %s: %v", userRecord.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to collect citizen data: " + err.Error()})
+		return
+	}
+
+	if recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       models.AuditActorAdmin,
+		Action:      models.AuditActionUserExported,
+		SubjectType: models.AuditSubjectUser,
+		SubjectID:   userRecord.ID,
+		After:       gin.H{"format": format},
+	}) != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	log.Printf("Data of user %s exported as %s", userRecord.ID, format)
+	fileName := "citizen-" + userRecord.CitizenID + "-export"
+
+	if format == "json" {
+		c.Header("Content-Disposition", `attachment; filename="`+fileName+`.json"`)
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	archive, err := zipExport(export)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build export archive"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+fileName+`.zip"`)
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+// Erase handles POST /admin/v1/citizens/:citizen_id/erase
+func (h *PrivacyHandler) Erase(c *gin.Context) {
+	var req models.EraseCitizenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if validation.NormalizeCitizenID(req.ConfirmCitizenID) != validation.NormalizeCitizenID(c.Param("citizen_id")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "confirm_citizen_id does not match the citizen ID"})
+		return
+	}
+
+	userRecord, ok := h.getCitizen(c)
+	if !ok {
+		return
+	}
+
+	pending, err := h.requestStore.CountPendingCardRequests(c.Request.Context(), userRecord.UserToken, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check pending requests"})
+		return
+	}
+	if pending > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "User has pending card requests"})
+		return
+	}
+
+	// Data outside the database goes first, so a failure leaves the erasure retryable
+	if err := h.eraseSessions(c.Request.Context(), userRecord); err != nil {
+		log.Printf("Failed to erase sessions of user %s: %v", userRecord.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to erase cached data"})
+		return
+	}
+	if err := h.notifier.DeleteHistory(c.Request.Context(), userRecord.UserToken); err != nil {
+		log.Printf("Failed to erase notification history of user %s: %v", userRecord.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to erase notification history"})
+		return
+	}
+
+	erasure := models.UserErasureRecord{
+		ID:          uuid.New().String(),
+		Reason:      req.Reason,
+		RequestedBy: req.RequestedBy,
+	}
+	if err := h.userStore.EraseUser(c.Request.Context(), userRecord.ID, erasure); err != nil {
+		if errors.Is(err, internal.ErrUserErased) {
+			c.JSON(http.StatusConflict, gin.H{"error": "User was already erased"})
+		} else {
+			log.Printf("Failed to erase user %s: %v", userRecord.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase user"})
+		}
+		return
+	}
+
+	// A read in the meantime may have cached the user again
+	h.sessionStore.DeleteUser(c.Request.Context(), userRecord.UserToken)
+
+	// The reason and requester stay in the erasure record, the audit log only points to it
+	recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       models.AuditActorAdmin,
+		Action:      models.AuditActionUserErased,
+		SubjectType: models.AuditSubjectUser,
+		SubjectID:   userRecord.ID,
+		After:       gin.H{"erasure_id": erasure.ID},
+	})
+
+	log.Printf("User %s erased by %s: %s", userRecord.ID, req.RequestedBy, req.Reason)
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "erased",
+		"user_id":    userRecord.ID,
+		"erasure_id": erasure.ID,
+	})
+}
+
+// getCitizen loads the user with the citizen ID in the path, including soft-deleted users
+func (h *PrivacyHandler) getCitizen(c *gin.Context) (*models.UserRecord, bool) {
+	citizenID, ok := citizenIDParam(c)
+	if !ok {
+		return nil, false
+	}
+
+	page, err := h.userStore.SearchUsers(c.Request.Context(), models.UserSearchQuery{
+		HistoryQuery: models.HistoryQuery{Limit: 1},
+		CitizenID:    citizenID,
+		Deleted:      models.UserDeletedInclude,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get citizen"})
+		return nil, false
+	}
+	if len(page.Users) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Citizen not found"})
+		return nil, false
+	}
+
+	userRecord, err := h.userStore.GetUserByID(c.Request.Context(), page.Users[0].ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get citizen"})
+		return nil, false
+	}
+
+	return userRecord, true
+}
+
+// exportedRequestData is a cached request in a citizen export, without the user token
+type exportedRequestData struct {
+	User           models.User `json:"user"`
+	CardType       string      `json:"card_type"`
+	ReplacesCardID string      `json:"replaces_card_id,omitempty"`
+}
+
+// collect assembles everything held about the user
+func (h *PrivacyHandler) collect(ctx context.Context, userRecord *models.UserRecord) (*models.CitizenExport, error) {
+	export := &models.CitizenExport{
+		ExportedAt:            time.Now(),
+		User:                  models.NewAdminUser(*userRecord),
+		IssuedCards:           []models.MaskedCard{},
+		FailedAttempts:        []models.FailedAttempt{},
+		CardRequests:          []models.ExportedCardRequest{},
+		CardPINs:              []models.CardPINRecord{},
+		CardControls:          []models.CardControlsRecord{},
+		Authorizations:        []models.CardAuthorizationRecord{},
+		LedgerTransactions:    []models.LedgerTransactionRecord{},
+		PrepaidAccounts:       []models.PrepaidAccountRecord{},
+		PrepaidBalanceChanges: []models.PrepaidBalanceChangeRecord{},
+		CreditLines:           []models.CreditLineRecord{},
+		CreditStatements:      []models.CreditStatementRecord{},
+		RedisKeys:             map[string]interface{}{},
+		Notifications:         []models.NotificationHistoryEntry{},
+	}
+
+	err := readHistory(func(query models.HistoryQuery) (string, error) {
+		page, err := h.cardStore.GetCardsByUserID(ctx, userRecord.ID, query)
+		if err != nil {
+			return "", err
+		}
+		export.IssuedCards = append(export.IssuedCards, page.Cards...)
+		return page.NextCursor, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readHistory(func(query models.HistoryQuery) (string, error) {
+		page, err := h.cardStore.GetFailedAttemptsByUserID(ctx, userRecord.ID, query)
+		if err != nil {
+			return "", err
+		}
+		export.FailedAttempts = append(export.FailedAttempts, page.Attempts...)
+		return page.NextCursor, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, card := range export.IssuedCards {
+		if err := h.collectCard(ctx, export, card.CardID); err != nil {
+			return nil, err
+		}
+	}
+
+	requests, err := h.requestStore.GetCardRequestsByUserToken(ctx, userRecord.UserToken)
+	if err != nil {
+		return nil, err
+	}
+	for _, request := range requests {
+		export.CardRequests = append(export.CardRequests, models.NewExportedCardRequest(request))
+	}
+
+	user, err := h.sessionStore.GetUser(ctx, userRecord.UserToken)
+	if err != nil && !errors.Is(err, internal.ErrNotFound) {
+		return nil, err
+	}
+	// The user key is named after the token, so it is exported without it
+	if user != nil {
+		export.RedisKeys["user"] = user
+	}
+	for _, request := range requests {
+		data, err := h.sessionStore.GetRequest(ctx, request.RequestUUID)
+		if err != nil && !errors.Is(err, internal.ErrNotFound) {
+			return nil, err
+		}
+		if data != nil {
+			export.RedisKeys["request:"+request.RequestUUID] = exportedRequestData{
+				User:           data.User,
+				CardType:       data.CardType,
+				ReplacesCardID: data.ReplacesCardID,
+			}
+		}
+	}
+
+	notifications, err := h.notifier.GetHistory(ctx, userRecord.UserToken)
+	if err != nil {
+		return nil, err
+	}
+	export.Notifications = append(export.Notifications, notifications...)
+
+	return export, nil
+}
+
+// collectCard adds the PIN, controls, authorizations and money movements of a card to the export
+func (h *PrivacyHandler) collectCard(ctx context.Context, export *models.CitizenExport, cardID string) error {
+	pin, err := h.cardStore.GetCardPIN(ctx, cardID)
+	if err != nil && !errors.Is(err, internal.ErrNotFound) {
+		return err
+	}
+	if pin != nil {
+		export.CardPINs = append(export.CardPINs, *pin)
+	}
+
+	controls, err := h.cardStore.GetCardControls(ctx, cardID)
+	if err != nil && !errors.Is(err, internal.ErrNotFound) {
+		return err
+	}
+	if controls != nil {
+		export.CardControls = append(export.CardControls, *controls)
+	}
+
+	account, err := h.ledgerStore.GetPrepaidAccount(ctx, cardID)
+	if err != nil && !errors.Is(err, internal.ErrNotFound) {
+		return err
+	}
+	if account != nil {
+		export.PrepaidAccounts = append(export.PrepaidAccounts, *account)
+	}
+
+	line, err := h.ledgerStore.GetCreditLine(ctx, cardID)
+	if err != nil && !errors.Is(err, internal.ErrNotFound) {
+		return err
+	}
+	if line != nil {
+		export.CreditLines = append(export.CreditLines, *line)
+	}
+
+	err = readHistory(func(query models.HistoryQuery) (string, error) {
+		page, err := h.ledgerStore.GetCardAuthorizations(ctx, cardID, query)
+		if err != nil {
+			return "", err
+		}
+		export.Authorizations = append(export.Authorizations, page.Authorizations...)
+		return page.NextCursor, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = readHistory(func(query models.HistoryQuery) (string, error) {
+		page, err := h.ledgerStore.GetLedgerTransactions(ctx, cardID, query)
+		if err != nil {
+			return "", err
+		}
+		export.LedgerTransactions = append(export.LedgerTransactions, page.Transactions...)
+		return page.NextCursor, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = readHistory(func(query models.HistoryQuery) (string, error) {
+		page, err := h.ledgerStore.GetPrepaidBalanceChanges(ctx, cardID, query)
+		if err != nil {
+			return "", err
+		}
+		export.PrepaidBalanceChanges = append(export.PrepaidBalanceChanges, page.Changes...)
+		return page.NextCursor, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return readHistory(func(query models.HistoryQuery) (string, error) {
+		page, err := h.ledgerStore.GetCreditStatements(ctx, cardID, query)
+		if err != nil {
+			return "", err
+		}
+		export.CreditStatements = append(export.CreditStatements, page.Statements...)
+		return page.NextCursor, nil
+	})
+}
+
+// readHistory reads a history from the oldest entry, one page at a time.
+// read gets the query of each page and returns the cursor of the next one, empty after the last.
+func readHistory(read func(query models.HistoryQuery) (string, error)) error {
+	query := models.HistoryQuery{Ascending: true, Limit: maxHistoryLimit}
+	for {
+		next, err := read(query)
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		if query.After, err = models.DecodeHistoryCursor(next); err != nil {
+			return err
+		}
+	}
+}
+
+// eraseSessions deletes the user and request keys cached for the user
+func (h *PrivacyHandler) eraseSessions(ctx context.Context, userRecord *models.UserRecord) error {
+	if err := h.sessionStore.DeleteUser(ctx, userRecord.UserToken); err != nil {
+		return err
+	}
+
+	requests, err := h.requestStore.GetCardRequestsByUserToken(ctx, userRecord.UserToken)
+	if err != nil {
+		return err
+	}
+	for _, request := range requests {
+		if err := h.sessionStore.DeleteRequest(ctx, request.RequestUUID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// zipExport writes each section of the export to its own JSON file
+func zipExport(export *models.CitizenExport) ([]byte, error) {
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"user.json", export.User},
+		{"issued_cards.json", export.IssuedCards},
+		{"failed_attempts.json", export.FailedAttempts},
+		{"card_requests.json", export.CardRequests},
+		{"card_pins.json", export.CardPINs},
+		{"card_controls.json", export.CardControls},
+		{"authorizations.json", export.Authorizations},
+		{"ledger_transactions.json", export.LedgerTransactions},
+		{"prepaid_accounts.json", export.PrepaidAccounts},
+		{"prepaid_balance_changes.json", export.PrepaidBalanceChanges},
+		{"credit_lines.json", export.CreditLines},
+		{"credit_statements.json", export.CreditStatements},
+		{"redis_keys.json", export.RedisKeys},
+		{"notifications.json", export.Notifications},
+	}
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for _, file := range files {
+		writer, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
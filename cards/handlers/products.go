@@ -0,0 +1,35 @@
+﻿package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"cards/internal"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ProductsHandler struct {
+	products *internal.ProductCatalog
+}
+
+func NewProductsHandler(products *internal.ProductCatalog) *ProductsHandler {
+	return &ProductsHandler{products: products}
+}
+
+// List handles GET /v1/products, the card products of the issuer
+func (h *ProductsHandler) List(c *gin.Context) {
+	catalog, err := h.products.Products(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, internal.ErrProductCatalogNotConfigured) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Card product catalog is not configured"})
+			return
+		}
+		log.Printf("Failed to get card product catalog: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to get card products"})
+		return
+	}
+
+	c.JSON(http.StatusOK, catalog)
+}
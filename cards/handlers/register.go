@@ -1,29 +1,28 @@
 ﻿package handlers
 
 import (
-	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"log"
 	"net/http"
-	"regexp"
-	"strings"
+	"time"
 
 	"cards/internal"
 	"cards/models"
+	"cards/validation"
 
 	"github.com/gin-gonic/gin"
 )
 
 type RegisterHandler struct {
-	redisService    *internal.RedisService
-	postgresService *internal.PostgresService
+	userRepository *internal.UserRepository
+	auditor        *internal.Auditor
 }
 
-func NewRegisterHandler(redisService *internal.RedisService, postgresService *internal.PostgresService) *RegisterHandler {
+func NewRegisterHandler(userRepository *internal.UserRepository, auditor *internal.Auditor) *RegisterHandler {
 	return &RegisterHandler{
-		redisService:    redisService,
-		postgresService: postgresService,
+		userRepository: userRepository,
+		auditor:        auditor,
 	}
 }
 
@@ -34,9 +33,12 @@ func (h *RegisterHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Validate that ID contains only digits
-	if !isDigitsOnly(req.CitizenID) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID must contain only digits"})
+	user, errs := validation.Registration(req, time.Now())
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Invalid registration data",
+			"fields": errs,
+		})
 		return
 	}
 
@@ -48,31 +50,24 @@ func (h *RegisterHandler) Register(c *gin.Context) {
 		return
 	}
 
-	user := models.User{
-		Name:        req.Name,
-		Lastname:    req.Lastname,
-		BirthDate:   req.BirthDate,
-		CountryCode: req.CountryCode,
-		CitizenID:   req.CitizenID, // Social Security ID
-	}
-
-	ctx := context.Background()
-
-	// Store user in Redis
-	if err := h.redisService.StoreUser(ctx, token, user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store user in Redis"})
-		return
-	}
+	ctx := c.Request.Context()
 
-	// Store user in PostgreSQL
-	_, err = h.postgresService.StoreUser(token, user)
+	// Store user in PostgreSQL, it is only cached in Redis once stored
+	userRecord, err := h.userRepository.Create(ctx, token, user)
 	if err != nil {
-		// If PostgreSQL fails, we should still return success since Redis worked
-		// In production, you might want to handle this differently
+		log.Printf("Failed to store user: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store user in database"})
 		return
 	}
 
+	recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       internal.UserActor(userRecord.ID),
+		Action:      models.AuditActionUserRegistered,
+		SubjectType: models.AuditSubjectUser,
+		SubjectID:   userRecord.ID,
+		After:       gin.H{"country_code": userRecord.CountryCode},
+	})
+
 	response := models.RegisterResponse{
 		Token: token,
 	}
@@ -87,16 +82,3 @@ func generateRandomToken() (string, error) {
 	}
 	return hex.EncodeToString(bytes), nil
 }
-
-// isDigitsOnly validates that the string contains only digits
-func isDigitsOnly(s string) bool {
-	// Remove any whitespace
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return false
-	}
-
-	// Use regex to check if string contains only digits
-	matched, _ := regexp.MatchString(`^\d+$`, s)
-	return matched
-}
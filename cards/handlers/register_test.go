@@ -0,0 +1,72 @@
+﻿package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"cards/models"
+	"cards/validation"
+)
+
+func TestRegisterStoresUser(t *testing.T) {
+	server := newTestServer(t)
+
+	token := server.register(t, "20.123.456")
+
+	userRecord, err := server.store.GetUserByToken(t.Context(), token)
+	if err != nil {
+		t.Fatalf("user not stored: %v", err)
+	}
+	if userRecord.CitizenID != "20123456" {
+		t.Errorf("citizen ID = %q, want it normalized to 20123456", userRecord.CitizenID)
+	}
+
+	cached, err := server.sessions.GetUser(t.Context(), token)
+	if err != nil {
+		t.Fatalf("user not cached: %v", err)
+	}
+	if cached.ID != userRecord.ID {
+		t.Errorf("cached user ID = %q, want %q", cached.ID, userRecord.ID)
+	}
+
+	if !contains(server.auditActions(t), models.AuditActionUserRegistered) {
+		t.Errorf("registration not audited")
+	}
+}
+
+func TestRegisterRejectsInvalidFields(t *testing.T) {
+	server := newTestServer(t)
+
+	recorder := server.do(t, http.MethodPost, "/v1/register", models.RegisterRequest{
+		Name:        "Ana",
+		BirthDate:   "not a date",
+		CountryCode: "AR",
+		CitizenID:   "123",
+	}, nil)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400, body %s", recorder.Code, recorder.Body)
+	}
+
+	var response struct {
+		Fields validation.Errors `json:"fields"`
+	}
+	decode(t, recorder, &response)
+	var fields []string
+	for _, fieldError := range response.Fields {
+		fields = append(fields, fieldError.Field)
+	}
+	for _, field := range []string{"lastname", "birth_date"} {
+		if !contains(fields, field) {
+			t.Errorf("field %s not reported, got %v", field, fields)
+		}
+	}
+}
+
+func TestRegisterRejectsMalformedBody(t *testing.T) {
+	server := newTestServer(t)
+
+	recorder := server.do(t, http.MethodPost, "/v1/register", "{", nil)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", recorder.Code)
+	}
+}
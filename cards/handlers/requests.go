@@ -0,0 +1,54 @@
+﻿package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"cards/internal"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RequestsHandler struct {
+	requestStore internal.RequestStore
+}
+
+func NewRequestsHandler(requestStore internal.RequestStore) *RequestsHandler {
+	return &RequestsHandler{
+		requestStore: requestStore,
+	}
+}
+
+// GetRequest handles GET /v1/requests/:request_uuid?user_token=...
+func (h *RequestsHandler) GetRequest(c *gin.Context) {
+	requestUUID := c.Param("request_uuid")
+	userToken := c.Query("user_token")
+	if userToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_token is required"})
+		return
+	}
+
+	if _, err := uuid.Parse(requestUUID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+		return
+	}
+
+	request, err := h.requestStore.GetCardRequest(c.Request.Context(), requestUUID)
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get request"})
+		}
+		return
+	}
+
+	// Requests of other users are reported as missing
+	if request.UserToken != userToken {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
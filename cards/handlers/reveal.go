@@ -0,0 +1,227 @@
+﻿package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"cards/internal"
+	"cards/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	revealCodeTTL           = 5 * time.Minute
+	revealCodeMaxAttempts   = 5
+	revealChallengeWindow   = time.Hour
+	revealChallengeMaxCodes = 5
+)
+
+type RevealHandler struct {
+	sessionStore internal.SessionStore
+	cardStore    internal.CardStore
+	notifier     *internal.Notifier
+	auditor      *internal.Auditor
+}
+
+func NewRevealHandler(sessionStore internal.SessionStore, cardStore internal.CardStore, notifier *internal.Notifier, auditor *internal.Auditor) *RevealHandler {
+	return &RevealHandler{
+		sessionStore: sessionStore,
+		cardStore:    cardStore,
+		notifier:     notifier,
+		auditor:      auditor,
+	}
+}
+
+// Challenge handles POST /v1/cards/:card_id/reveal/challenge
+// It sends a one-time code to the notifications stream of the card owner
+func (h *RevealHandler) Challenge(c *gin.Context) {
+	var req models.RevealChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	card, ok := getOwnedCard(c, h.cardStore, req.UserToken)
+	if !ok {
+		return
+	}
+
+	log.Printf("Received reveal challenge request for card: %s", card.ID)
+	ctx := c.Request.Context()
+
+	// New codes do not reset the guesses, and only a few can be sent per card
+	codes, err := h.sessionStore.IncrementRevealChallenges(ctx, card.ID, revealChallengeWindow)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store challenge"})
+		return
+	}
+	if codes > revealChallengeMaxCodes {
+		h.audit(c, card, models.RevealActionChallenge, false, "Too many codes requested")
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many codes requested, try again later"})
+		return
+	}
+
+	code, err := generateOneTimeCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate code"})
+		return
+	}
+
+	challenge := models.RevealChallenge{
+		CodeHash:  hashOneTimeCode(card.ID, code),
+		UserToken: req.UserToken,
+	}
+
+	if err := h.sessionStore.StoreRevealChallenge(ctx, card.ID, challenge, revealCodeTTL); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store challenge"})
+		return
+	}
+
+	event := models.NotificationEvent{
+		Type:    "card.reveal_code",
+		Message: "Your code to reveal your card details is " + code,
+		Data:    map[string]string{"card_id": card.ID, "code": code},
+	}
+
+	if err := h.notifier.NotifyEvent(ctx, req.UserToken, event); err != nil {
+		log.Printf("Failed to send reveal code for card %s: %v", card.ID, err)
+		h.sessionStore.DeleteRevealChallenge(ctx, card.ID)
+		h.audit(c, card, models.RevealActionChallenge, false, "Code could not be delivered")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to deliver code, make sure you are connected to notifications"})
+		return
+	}
+
+	h.audit(c, card, models.RevealActionChallenge, true, "")
+	c.JSON(http.StatusAccepted, gin.H{"expires_in": int(revealCodeTTL.Seconds())})
+}
+
+// Reveal handles POST /v1/cards/:card_id/reveal
+// It returns the full card details when the one-time code matches
+func (h *RevealHandler) Reveal(c *gin.Context) {
+	var req models.RevealCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	card, ok := getOwnedCard(c, h.cardStore, req.UserToken)
+	if !ok {
+		return
+	}
+
+	log.Printf("Received reveal request for card: %s", card.ID)
+	ctx := c.Request.Context()
+
+	challenge, err := h.sessionStore.GetRevealChallenge(ctx, card.ID)
+	if err != nil {
+		if !errors.Is(err, internal.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get challenge"})
+			return
+		}
+		h.audit(c, card, models.RevealActionReveal, false, "No active code")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No active code, request a new one"})
+		return
+	}
+
+	// The guess is counted before it is compared so parallel guesses cannot exceed the limit
+	attempts, err := h.sessionStore.IncrementRevealAttempts(ctx, card.ID, revealCodeTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check code"})
+		return
+	}
+	if attempts > revealCodeMaxAttempts {
+		h.sessionStore.DeleteRevealChallenge(ctx, card.ID)
+		h.audit(c, card, models.RevealActionReveal, false, "Too many attempts")
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, request a new code later"})
+		return
+	}
+
+	codeMatches := subtle.ConstantTimeCompare([]byte(challenge.CodeHash), []byte(hashOneTimeCode(card.ID, req.Code))) == 1
+	if !codeMatches || challenge.UserToken != req.UserToken {
+		h.audit(c, card, models.RevealActionReveal, false, "Invalid code")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	// Codes are single use
+	if err := h.sessionStore.DeleteRevealChallenge(ctx, card.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to consume code"})
+		return
+	}
+	h.sessionStore.ResetRevealAttempts(ctx, card.ID)
+
+	fullCard, err := h.cardStore.GetFullCard(ctx, card.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get card details"})
+		return
+	}
+
+	// Details are only returned once the reveal is audited
+	if err := h.audit(c, card, models.RevealActionReveal, true, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to audit reveal"})
+		return
+	}
+
+	c.JSON(http.StatusOK, fullCard)
+}
+
+// audit records a reveal attempt, logging if it cannot be stored.
+// Issued challenges and successful reveals also go to the audit log.
+func (h *RevealHandler) audit(c *gin.Context, card *models.IssuedCardRecord, action string, success bool, reason string) error {
+	record := models.CardRevealAuditRecord{
+		ID:        uuid.New().String(),
+		CardID:    card.ID,
+		UserID:    card.UserID,
+		Action:    action,
+		Success:   success,
+		Reason:    reason,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+
+	if err := h.cardStore.StoreRevealAudit(c.Request.Context(), record); err != nil {
+		log.Printf("Failed to store reveal audit for card %s: %v", card.ID, err)
+		return err
+	}
+
+	if !success {
+		return nil
+	}
+
+	auditAction := models.AuditActionCardRevealChallenged
+	if action == models.RevealActionReveal {
+		auditAction = models.AuditActionCardRevealed
+	}
+
+	return recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       internal.UserActor(card.UserID),
+		Action:      auditAction,
+		SubjectType: models.AuditSubjectCard,
+		SubjectID:   card.ID,
+		After:       gin.H{"reveal_audit_id": record.ID},
+	})
+}
+
+// generateOneTimeCode generates a random 6 digit code
+func generateOneTimeCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func hashOneTimeCode(cardID, code string) string {
+	sum := sha256.Sum256([]byte(cardID + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
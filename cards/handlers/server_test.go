@@ -0,0 +1,164 @@
+﻿package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"cards/internal"
+	"cards/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testWebhookSecret = "test-secret"
+
+// testServer routes requests to the handlers over the in-memory stores, like STORAGE=memory
+type testServer struct {
+	router   *gin.Engine
+	store    *internal.MemoryStore
+	sessions *internal.MemorySessionStore
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("WEBHOOK_SIGNING_SECRET", testWebhookSecret)
+	t.Setenv("NOTIFICATIONS_URL", "")
+	t.Setenv("ISSUER_PRODUCTS_URL", "")
+
+	store := internal.NewMemoryStore()
+	sessions := internal.NewMemorySessionStore()
+	auditor := internal.NewAuditor(store)
+	userRepository := internal.NewUserRepository(sessions, store)
+	policy := internal.NewIssuancePolicy(store, store)
+	creditLines := internal.NewCreditLines(store, "USD")
+
+	registerHandler := NewRegisterHandler(userRepository, auditor)
+	issueHandler := NewIssueHandler(sessions, store, userRepository, policy, internal.NewProductCatalog(), auditor)
+	webhookHandler := NewWebhookHandler(sessions, store, store, store, internal.NewNotifier(), internal.NewWebhookVerifier(), auditor, creditLines)
+
+	router := gin.New()
+	router.Use(RequestID)
+	router.POST("/v1/register", registerHandler.Register)
+	router.POST("/v1/issue", issueHandler.Issue)
+	router.POST("/v1/webhook", webhookHandler.Webhook)
+
+	return &testServer{router: router, store: store, sessions: sessions}
+}
+
+// do sends a JSON body to the router, a string body is sent as is
+func (s *testServer) do(t *testing.T, method, path string, body interface{}, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	raw, ok := body.(string)
+	if !ok {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+		raw = string(encoded)
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(raw))
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// register registers a citizen and returns their user token
+func (s *testServer) register(t *testing.T, citizenID string) string {
+	t.Helper()
+	recorder := s.do(t, http.MethodPost, "/v1/register", models.RegisterRequest{
+		Name:        "Ana",
+		Lastname:    "Perez",
+		BirthDate:   "1990-01-01",
+		CountryCode: "AR",
+		CitizenID:   citizenID,
+	}, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("register: status %d, body %s", recorder.Code, recorder.Body)
+	}
+
+	var response models.RegisterResponse
+	decode(t, recorder, &response)
+	return response.Token
+}
+
+// issue submits an issue request and returns its UUID
+func (s *testServer) issue(t *testing.T, token, cardType string) string {
+	t.Helper()
+	recorder := s.do(t, http.MethodPost, "/v1/issue", models.IssueCardRequest{UserToken: token, CardType: cardType}, nil)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("issue: status %d, body %s", recorder.Code, recorder.Body)
+	}
+
+	var response struct {
+		RequestUUID string `json:"request_uuid"`
+	}
+	decode(t, recorder, &response)
+	return response.RequestUUID
+}
+
+// sendWebhook posts an issuer response signed like the webhook service does
+func (s *testServer) sendWebhook(t *testing.T, response models.IssuerResponse) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(models.WebhookEvent{Type: "card.issuance", Data: response})
+	if err != nil {
+		t.Fatalf("marshal event: %v", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	return s.do(t, http.MethodPost, "/v1/webhook", string(body), http.Header{
+		"X-Webhook-Timestamp": {timestamp},
+		"X-Webhook-Signature": {sign(timestamp, body)},
+	})
+}
+
+// auditActions lists the actions recorded in the audit log, oldest first
+func (s *testServer) auditActions(t *testing.T) []string {
+	t.Helper()
+	page, err := s.store.QueryAuditEvents(t.Context(), models.AuditEventQuery{Ascending: true, Limit: 100})
+	if err != nil {
+		t.Fatalf("query audit events: %v", err)
+	}
+
+	actions := make([]string, 0, len(page.Events))
+	for _, event := range page.Events {
+		actions = append(actions, event.Action)
+	}
+	return actions
+}
+
+func sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	fmt.Fprintf(mac, "%s.%s", timestamp, body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func decode(t *testing.T, recorder *httptest.ResponseRecorder, target interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(recorder.Body.Bytes(), target); err != nil {
+		t.Fatalf("decode %s: %v", recorder.Body, err)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+﻿package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cards/internal"
+	"cards/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestSubmitter stores the issue requests of the handlers that submit them: new cards and replacements
+type requestSubmitter struct {
+	sessionStore internal.SessionStore
+	requestStore internal.RequestStore
+	policy       *internal.IssuancePolicy
+	auditor      *internal.Auditor
+}
+
+func newRequestSubmitter(sessionStore internal.SessionStore, requestStore internal.RequestStore, policy *internal.IssuancePolicy, auditor *internal.Auditor) *requestSubmitter {
+	return &requestSubmitter{
+		sessionStore: sessionStore,
+		requestStore: requestStore,
+		policy:       policy,
+		auditor:      auditor,
+	}
+}
+
+// respondPolicyViolation answers 429 with Retry-After for time based rules and 409 for the rest
+func respondPolicyViolation(c *gin.Context, violation *internal.PolicyViolation) {
+	status := http.StatusConflict
+	if violation.RetryAfter > 0 {
+		status = http.StatusTooManyRequests
+		retryAfter := int(violation.RetryAfter.Round(time.Second) / time.Second)
+		c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	}
+
+	c.JSON(status, gin.H{
+		"error":     "Card issuance policy violated",
+		"violation": violation,
+	})
+}
+
+// submit checks the issuance policy and stores a request together with its outbox message,
+// writing the error response on failure. A replacement sets replacesCardID to the card it replaces.
+// The outbox dispatcher then sends it to the issuer through the webhook service.
+func (s *requestSubmitter) submit(c *gin.Context, user *models.User, userToken, cardType, replacesCardID string) (string, bool) {
+	ctx := c.Request.Context()
+	userID := user.ID
+
+	// The policy is checked while the user's requests are locked, so concurrent calls see each other
+	admit := func() error {
+		violation, err := s.policy.Evaluate(ctx, userToken, cardType, replacesCardID != "")
+		if err != nil {
+			return err
+		}
+		if violation != nil {
+			return violation
+		}
+		return nil
+	}
+
+	requestRecord, outboxMessage, err := internal.CreateCardRequestRecord(*user, userToken, cardType, replacesCardID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", false
+	}
+	requestUUID := requestRecord.RequestUUID
+
+	err = s.requestStore.CreateCardRequest(ctx, requestRecord, outboxMessage, admit)
+	var violation *internal.PolicyViolation
+	switch {
+	case errors.As(err, &violation):
+		respondPolicyViolation(c, violation)
+		return "", false
+	case errors.Is(err, internal.ErrPendingCardRequest):
+		respondPolicyViolation(c, internal.PendingRequestViolation(cardType))
+		return "", false
+	case err != nil:
+		log.Printf("Failed to submit issue request for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store request"})
+		return "", false
+	}
+
+	recordAudit(c, s.auditor, internal.AuditEvent{
+		Actor:       internal.UserActor(userID),
+		Action:      models.AuditActionCardRequestSubmitted,
+		SubjectType: models.AuditSubjectCardRequest,
+		SubjectID:   requestUUID,
+		After: gin.H{
+			"user_id":          userID,
+			"card_type":        cardType,
+			"status":           requestRecord.Status,
+			"replaces_card_id": replacesCardID,
+		},
+	})
+
+	requestData := models.RequestData{
+		User:           *user,
+		CardType:       cardType,
+		UserToken:      userToken,
+		ReplacesCardID: replacesCardID,
+	}
+
+	// Redis only caches the request, the webhook falls back to the database
+	log.Printf("Storing request in Redis for user UUID and request UUID: %s and %s", userToken, requestUUID)
+	if err := s.sessionStore.StoreRequest(ctx, requestUUID, requestData); err != nil {
+		log.Printf("Failed to cache request %s in Redis: %v", requestUUID, err)
+	}
+
+	return requestUUID, true
+}
@@ -1,12 +1,13 @@
 ﻿package handlers
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"os"
 
 	"cards/internal"
 	"cards/models"
@@ -15,29 +16,56 @@ import (
 )
 
 type WebhookHandler struct {
-	redisService    *internal.RedisService
-	postgresService *internal.PostgresService
+	sessionStore internal.SessionStore
+	userStore    internal.UserStore
+	cardStore    internal.CardStore
+	requestStore internal.RequestStore
+	notifier     *internal.Notifier
+	verifier     *internal.WebhookVerifier
+	auditor      *internal.Auditor
+	credit       *internal.CreditLines
 }
 
-func NewWebhookHandler(redisService *internal.RedisService, postgresService *internal.PostgresService) *WebhookHandler {
+func NewWebhookHandler(sessionStore internal.SessionStore, userStore internal.UserStore, cardStore internal.CardStore, requestStore internal.RequestStore, notifier *internal.Notifier, verifier *internal.WebhookVerifier, auditor *internal.Auditor, credit *internal.CreditLines) *WebhookHandler {
 	return &WebhookHandler{
-		redisService:    redisService,
-		postgresService: postgresService,
+		sessionStore: sessionStore,
+		userStore:    userStore,
+		cardStore:    cardStore,
+		requestStore: requestStore,
+		notifier:     notifier,
+		verifier:     verifier,
+		auditor:      auditor,
+		credit:       credit,
 	}
 }
 
 func (h *WebhookHandler) Webhook(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	// Only events signed by the webhook service are accepted
+	timestamp := c.GetHeader("X-Webhook-Timestamp")
+	signature := c.GetHeader("X-Webhook-Signature")
+	if err := h.verifier.Verify(timestamp, signature, body); err != nil {
+		log.Printf("Rejected webhook event from %s: %v", c.ClientIP(), err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook signature"})
+		return
+	}
+
 	var webhookEvent models.WebhookEvent
-	if err := c.ShouldBindJSON(&webhookEvent); err != nil {
+	if err := json.Unmarshal(body, &webhookEvent); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	log.Printf("Received webhook event request for: %s", webhookEvent.Data.RequestUUID)
-	ctx := context.Background()
+	ctx := c.Request.Context()
 	response := webhookEvent.Data
 
-	requestData, err := h.redisService.GetRequest(ctx, response.RequestUUID)
+	requestData, err := h.getRequestData(ctx, response.RequestUUID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
 		return
@@ -50,59 +78,190 @@ func (h *WebhookHandler) Webhook(c *gin.Context) {
 	}
 
 	// Get user from database
-	userRecord, err := h.postgresService.GetUserByToken(userToken)
+	userRecord, err := h.userStore.GetUserByToken(ctx, userToken)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found in database"})
 		return
 	}
 
 	// Process based on issuance result
+	var renewedCard *models.IssuedCardRecord
+	var newCardID string
 	if response.IssuedCard != nil {
 		// Successful issuance - store in issued_cards table
-		issuedCardRecord := h.postgresService.CreateIssuedCardRecord(
+		issuedCardRecord := internal.CreateIssuedCardRecord(
 			userRecord.ID,
 			userToken,
 			response,
 		)
+		if requestData.ReplacesCardID != "" {
+			issuedCardRecord.ReplacesCardID = &requestData.ReplacesCardID
+		}
+		// Credit cards open with the credit line the issuer decided on
+		var creditLimit int64
+		if issuedCardRecord.CardType == models.CardTypeCredit {
+			line := h.credit.NewCreditLine(issuedCardRecord.ID, response.IssuedCard.CreditLine)
+			issuedCardRecord.CreditLine = &line
+			creditLimit = line.CreditLimit
+		}
 
-		if err := h.postgresService.StoreIssuedCard(issuedCardRecord); err != nil {
+		superseded, err := h.cardStore.StoreIssuedCard(ctx, response.RequestUUID, issuedCardRecord)
+		if err != nil {
+			if errors.Is(err, internal.ErrCardRequestNotPending) {
+				h.rejectCompletedRequest(c, response.RequestUUID)
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store issued card"})
 			return
 		}
+
+		recordAudit(c, h.auditor, internal.AuditEvent{
+			Actor:       models.AuditActorIssuer,
+			Action:      models.AuditActionCardIssued,
+			SubjectType: models.AuditSubjectCard,
+			SubjectID:   issuedCardRecord.ID,
+			After: gin.H{
+				"user_id":          userRecord.ID,
+				"request_uuid":     response.RequestUUID,
+				"card_type":        issuedCardRecord.CardType,
+				"status":           issuedCardRecord.Status,
+				"replaces_card_id": requestData.ReplacesCardID,
+				"credit_limit":     creditLimit,
+			},
+		})
+
+		if issuedCardRecord.ReplacesCardID != nil {
+			renewedCard = h.recordSupersededCard(c, *issuedCardRecord.ReplacesCardID, issuedCardRecord.ID, superseded)
+			newCardID = issuedCardRecord.ID
+		}
 	} else if response.DeclineReason != nil {
 		// Failed attempt - store in failed_attempts table
-		failedAttemptRecord := h.postgresService.CreateFailedAttemptRecord(
+		failedAttemptRecord := internal.CreateFailedAttemptRecord(
 			userRecord.ID,
 			userToken,
 			requestData.CardType,
 			response,
 		)
 
-		if err := h.postgresService.StoreFailedAttempt(failedAttemptRecord); err != nil {
+		if err := h.cardStore.StoreFailedAttempt(ctx, response.RequestUUID, failedAttemptRecord); err != nil {
+			if errors.Is(err, internal.ErrCardRequestNotPending) {
+				h.rejectCompletedRequest(c, response.RequestUUID)
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store failed attempt"})
 			return
 		}
+
+		recordAudit(c, h.auditor, internal.AuditEvent{
+			Actor:       models.AuditActorIssuer,
+			Action:      models.AuditActionCardRequestDeclined,
+			SubjectType: models.AuditSubjectCardRequest,
+			SubjectID:   response.RequestUUID,
+			After: gin.H{
+				"user_id":        userRecord.ID,
+				"attempt_id":     failedAttemptRecord.ID,
+				"status":         failedAttemptRecord.Status,
+				"decline_reason": failedAttemptRecord.DeclineReason,
+			},
+		})
 	}
 
 	// Clean up Redis request
-	if err := h.redisService.DeleteRequest(ctx, response.RequestUUID); err != nil {
+	if err := h.sessionStore.DeleteRequest(ctx, response.RequestUUID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete request"})
 		return
 	}
 
 	// Send notification
-	notificationRequest := models.NotificationRequest{
-		UserToken:      userToken,
-		IssuerResponse: response,
+	if err := h.notifier.NotifyIssuerResponse(ctx, userToken, response); err != nil {
+		log.Printf("Failed to notify user for request %s: %v", response.RequestUUID, err)
 	}
-
-	notificationsURL := os.Getenv("NOTIFICATIONS_URL")
-	if notificationsURL != "" {
-		notificationJSON, err := json.Marshal(notificationRequest)
-		if err == nil {
-			http.Post(notificationsURL, "application/json", bytes.NewBuffer(notificationJSON))
-		}
+	if renewedCard != nil {
+		h.notifyRenewal(ctx, renewedCard, newCardID, response.IssuedCard.PAN)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "processed"})
 }
+
+// recordSupersededCard audits the status change of the card a new card replaces or renews,
+// returning the card when it was renewed. A card that could no longer be superseded, e.g.
+// because it was cancelled while the request was pending, keeps its status and is audited as such.
+func (h *WebhookHandler) recordSupersededCard(c *gin.Context, cardID, newCardID string, superseded bool) *models.IssuedCardRecord {
+	card, err := h.cardStore.GetIssuedCardByID(c.Request.Context(), cardID)
+	if err != nil {
+		log.Printf("Failed to get card %s superseded by card %s: %v", cardID, newCardID, err)
+		return nil
+	}
+
+	if !superseded {
+		log.Printf("Card %s kept status %s, it cannot be superseded by card %s", card.ID, card.Status, newCardID)
+		recordAudit(c, h.auditor, internal.AuditEvent{
+			Actor:       models.AuditActorIssuer,
+			Action:      models.AuditActionCardSupersedeSkipped,
+			SubjectType: models.AuditSubjectCard,
+			SubjectID:   card.ID,
+			After:       gin.H{"status": card.Status, "superseded_by": newCardID},
+		})
+		return nil
+	}
+
+	recordAudit(c, h.auditor, internal.AuditEvent{
+		Actor:       models.AuditActorIssuer,
+		Action:      models.AuditActionCardStatusChanged,
+		SubjectType: models.AuditSubjectCard,
+		SubjectID:   card.ID,
+		After:       gin.H{"status": card.Status, "superseded_by": newCardID},
+	})
+
+	if card.Status != models.CardStatusRenewed {
+		return nil
+	}
+	return card
+}
+
+// notifyRenewal tells the owner of a renewed card its new card arrived, a failure is only logged
+func (h *WebhookHandler) notifyRenewal(ctx context.Context, card *models.IssuedCardRecord, newCardID, newPAN string) {
+	event := models.NotificationEvent{
+		Type: "card.renewed",
+		Message: fmt.Sprintf("Your card ending in %s is about to expire and was renewed, the new card ends in %s",
+			card.PAN[max(len(card.PAN)-4, 0):], newPAN[max(len(newPAN)-4, 0):]),
+		Data: map[string]string{
+			"card_id":     card.ID,
+			"new_card_id": newCardID,
+			"expiry_date": card.ExpiryDate,
+		},
+	}
+
+	if err := h.notifier.NotifyEvent(ctx, card.UserToken, event); err != nil {
+		log.Printf("Failed to notify renewal of card %s: %v", card.ID, err)
+	}
+}
+
+// rejectCompletedRequest answers events for requests that already have an outcome, e.g. expired ones
+func (h *WebhookHandler) rejectCompletedRequest(c *gin.Context, requestUUID string) {
+	log.Printf("Ignoring webhook event for request %s, it is no longer pending", requestUUID)
+	c.JSON(http.StatusConflict, gin.H{"error": "Request is no longer pending"})
+}
+
+// getRequestData reads a request from Redis, falling back to the stored card request
+func (h *WebhookHandler) getRequestData(ctx context.Context, requestUUID string) (*models.RequestData, error) {
+	requestData, err := h.sessionStore.GetRequest(ctx, requestUUID)
+	if err == nil {
+		return requestData, nil
+	}
+
+	requestRecord, err := h.requestStore.GetCardRequest(ctx, requestUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	requestData = &models.RequestData{
+		CardType:  requestRecord.CardType,
+		UserToken: requestRecord.UserToken,
+	}
+	if requestRecord.ReplacesCardID != nil {
+		requestData.ReplacesCardID = *requestRecord.ReplacesCardID
+	}
+
+	return requestData, nil
+}
@@ -0,0 +1,185 @@
+﻿package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"cards/internal"
+	"cards/models"
+)
+
+func approved(requestUUID, pan string) models.IssuerResponse {
+	return models.IssuerResponse{
+		RequestUUID: requestUUID,
+		Status:      "approved",
+		IssuedCard: &models.IssuedCard{
+			PAN:        pan,
+			CVV:        "123",
+			ExpiryDate: "2030-01-31",
+			CardType:   "debit",
+		},
+	}
+}
+
+// issueCard issues a debit card through the webhook and returns it
+func (s *testServer) issueCard(t *testing.T, token, pan string) *models.IssuedCardRecord {
+	t.Helper()
+	requestUUID := s.issue(t, token, "debit")
+	if recorder := s.sendWebhook(t, approved(requestUUID, pan)); recorder.Code != http.StatusOK {
+		t.Fatalf("webhook: status %d, body %s", recorder.Code, recorder.Body)
+	}
+
+	request, err := s.store.GetCardRequest(t.Context(), requestUUID)
+	if err != nil || request.IssuedCardID == nil {
+		t.Fatalf("request %s not issued: %+v, %v", requestUUID, request, err)
+	}
+	card, err := s.store.GetIssuedCardByID(t.Context(), *request.IssuedCardID)
+	if err != nil {
+		t.Fatalf("card not stored: %v", err)
+	}
+	return card
+}
+
+func TestWebhookStoresIssuedCard(t *testing.T) {
+	server := newTestServer(t)
+	token := server.register(t, "123")
+
+	card := server.issueCard(t, token, "4111111111111111")
+
+	if card.Status != models.CardStatusActive || card.UserToken != token || card.PAN != "4111111111111111" {
+		t.Errorf("stored card = %+v", card)
+	}
+	if !contains(server.auditActions(t), models.AuditActionCardIssued) {
+		t.Errorf("issuance not audited")
+	}
+}
+
+func TestWebhookStoresDecline(t *testing.T) {
+	server := newTestServer(t)
+	token := server.register(t, "123")
+	requestUUID := server.issue(t, token, "debit")
+
+	recorder := server.sendWebhook(t, models.IssuerResponse{
+		RequestUUID:   requestUUID,
+		Status:        "declined",
+		DeclineReason: &models.DeclineReason{Reason: "risk"},
+	})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200, body %s", recorder.Code, recorder.Body)
+	}
+
+	request, err := server.store.GetCardRequest(t.Context(), requestUUID)
+	if err != nil {
+		t.Fatalf("get request: %v", err)
+	}
+	if request.Status != models.CardRequestStatusDeclined {
+		t.Errorf("request status = %s, want declined", request.Status)
+	}
+	if _, err := server.sessions.GetRequest(t.Context(), requestUUID); err == nil {
+		t.Errorf("request data left in the session store")
+	}
+}
+
+func TestWebhookRejectsInvalidSignature(t *testing.T) {
+	server := newTestServer(t)
+	token := server.register(t, "123")
+	requestUUID := server.issue(t, token, "debit")
+
+	recorder := server.do(t, http.MethodPost, "/v1/webhook", models.WebhookEvent{Data: approved(requestUUID, "4111111111111111")}, http.Header{
+		"X-Webhook-Timestamp": {"1700000000"},
+		"X-Webhook-Signature": {"v1=00"},
+	})
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401, body %s", recorder.Code, recorder.Body)
+	}
+
+	request, err := server.store.GetCardRequest(t.Context(), requestUUID)
+	if err != nil {
+		t.Fatalf("get request: %v", err)
+	}
+	if request.Status != models.CardRequestStatusSubmitted {
+		t.Errorf("request status = %s, want it still submitted", request.Status)
+	}
+}
+
+func TestWebhookRejectsCompletedRequest(t *testing.T) {
+	server := newTestServer(t)
+	token := server.register(t, "123")
+	requestUUID := server.issue(t, token, "debit")
+	server.sendWebhook(t, approved(requestUUID, "4111111111111111"))
+
+	recorder := server.sendWebhook(t, approved(requestUUID, "4111111111112222"))
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("status %d, want 409, body %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestWebhookReplacesLostCard(t *testing.T) {
+	server := newTestServer(t)
+	token := server.register(t, "123")
+	card := server.issueCard(t, token, "4111111111111111")
+	if err := server.store.ChangeCardStatus(t.Context(), card.ID, card.Status, models.CardStatusLost, "test", "lost"); err != nil {
+		t.Fatalf("report card lost: %v", err)
+	}
+	requestUUID := server.submitReplacement(t, token, card.ID)
+
+	if recorder := server.sendWebhook(t, approved(requestUUID, "4111111111112222")); recorder.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200, body %s", recorder.Code, recorder.Body)
+	}
+
+	replaced, err := server.store.GetIssuedCardByID(t.Context(), card.ID)
+	if err != nil {
+		t.Fatalf("get replaced card: %v", err)
+	}
+	if replaced.Status != models.CardStatusReplaced {
+		t.Errorf("replaced card status = %s, want replaced", replaced.Status)
+	}
+}
+
+func TestWebhookKeepsCardThatCannotBeSuperseded(t *testing.T) {
+	server := newTestServer(t)
+	token := server.register(t, "123")
+	card := server.issueCard(t, token, "4111111111111111")
+	requestUUID := server.submitReplacement(t, token, card.ID)
+	// Cancelled while the renewal was pending, a cancelled card cannot be renewed
+	if err := server.store.ChangeCardStatus(t.Context(), card.ID, card.Status, models.CardStatusCancelled, "test", "cancel"); err != nil {
+		t.Fatalf("cancel card: %v", err)
+	}
+
+	if recorder := server.sendWebhook(t, approved(requestUUID, "4111111111112222")); recorder.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200, body %s", recorder.Code, recorder.Body)
+	}
+
+	request, err := server.store.GetCardRequest(t.Context(), requestUUID)
+	if err != nil || request.IssuedCardID == nil {
+		t.Fatalf("new card not stored: %+v, %v", request, err)
+	}
+	old, err := server.store.GetIssuedCardByID(t.Context(), card.ID)
+	if err != nil {
+		t.Fatalf("get old card: %v", err)
+	}
+	if old.Status != models.CardStatusCancelled {
+		t.Errorf("old card status = %s, want it still cancelled", old.Status)
+	}
+	if !contains(server.auditActions(t), models.AuditActionCardSupersedeSkipped) {
+		t.Errorf("skipped supersede not audited")
+	}
+}
+
+// submitReplacement stores a request for a card replacing the given one, like a renewal does
+func (s *testServer) submitReplacement(t *testing.T, token, cardID string) string {
+	t.Helper()
+	user, err := s.store.GetUserByToken(t.Context(), token)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+
+	request, message, err := internal.CreateCardRequestRecord(models.User{Name: user.Name, Lastname: user.Lastname}, token, "debit", cardID)
+	if err != nil {
+		t.Fatalf("build request: %v", err)
+	}
+	if err := s.store.CreateCardRequest(t.Context(), request, message, nil); err != nil {
+		t.Fatalf("store request: %v", err)
+	}
+	return request.RequestUUID
+}
@@ -0,0 +1,125 @@
+﻿package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"cards/models"
+
+	"github.com/google/uuid"
+)
+
+const defaultCardCurrency = "USD"
+
+// Authorizer decides on the transactions card networks submit and records them in the ledger
+type Authorizer struct {
+	cardStore   CardStore
+	ledgerStore LedgerStore
+	controls    *SpendingControls
+	currency    string
+}
+
+func NewAuthorizer(cardStore CardStore, ledgerStore LedgerStore, controls *SpendingControls) *Authorizer {
+	currency := defaultCardCurrency
+	if value := strings.ToUpper(strings.TrimSpace(os.Getenv("CARD_CURRENCY"))); value != "" {
+		currency = value
+	}
+
+	return &Authorizer{
+		cardStore:   cardStore,
+		ledgerStore: ledgerStore,
+		controls:    controls,
+		currency:    currency,
+	}
+}
+
+// Currency is the currency cards are held in, the only one they can be charged in
+func (a *Authorizer) Currency() string {
+	return a.currency
+}
+
+// Refund gives back part or all of an approved authorization, a prepaid card gets the amount back on its balance
+func (a *Authorizer) Refund(ctx context.Context, authorizationID string, amount int64) (*models.RefundResponse, error) {
+	transaction, change, err := a.ledgerStore.RefundCardAuthorization(ctx, authorizationID, amount)
+	if err != nil {
+		return nil, err
+	}
+	return &models.RefundResponse{Transaction: *transaction, BalanceChange: change}, nil
+}
+
+// Authorize checks a transaction against the card it is made with and records the decision.
+// It returns the recorded authorization and the card, which is nil when the PAN matched no card.
+func (a *Authorizer) Authorize(ctx context.Context, credentials models.CardCredentials, transaction models.CardTransaction) (*models.CardAuthorizationRecord, *models.IssuedCardRecord, error) {
+	record := models.CardAuthorizationRecord{
+		ID:              uuid.New().String(),
+		Amount:          transaction.Amount,
+		Currency:        transaction.Currency,
+		Channel:         transaction.Channel,
+		MerchantName:    transaction.MerchantName,
+		MerchantMCC:     transaction.MCC,
+		MerchantCountry: transaction.MerchantCountry,
+		CreatedAt:       time.Now().UTC(),
+	}
+
+	card, err := a.cardStore.GetIssuedCardByPAN(ctx, credentials.PAN)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			return nil, nil, err
+		}
+		decline(&record, models.AuthorizationReasonInvalidCard)
+		stored, err := a.ledgerStore.RecordCardAuthorization(ctx, record, nil)
+		return stored, nil, err
+	}
+	record.CardID = &card.ID
+
+	// Card details are checked before the card state, so a guess learns nothing about the card
+	expiryMonth := cardExpiryMonth(card.ExpiryDate)
+	switch {
+	case expiryMonth != credentials.ExpiryMonth:
+		decline(&record, models.AuthorizationReasonInvalidExpiry)
+	case subtle.ConstantTimeCompare([]byte(card.CVV), []byte(credentials.CVV)) != 1:
+		decline(&record, models.AuthorizationReasonInvalidCVV)
+	case card.Status != models.CardStatusActive:
+		decline(&record, models.AuthorizationReasonCardNotActive)
+	case record.CreatedAt.Format("2006-01") > expiryMonth:
+		// Cards can be used until the end of their expiry month
+		decline(&record, models.AuthorizationReasonExpiredCard)
+	case transaction.Currency != a.currency:
+		decline(&record, models.AuthorizationReasonCurrencyNotSupported)
+	}
+	if record.Status != "" {
+		stored, err := a.ledgerStore.RecordCardAuthorization(ctx, record, nil)
+		return stored, card, err
+	}
+
+	controls, err := a.controls.Get(ctx, card.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stored, err := a.ledgerStore.RecordCardAuthorization(ctx, record, func(spending models.CardSpending) string {
+		if violation := EvaluateCardControls(*controls, transaction, spending); violation != nil {
+			return violation.Rule
+		}
+		return ""
+	})
+	return stored, card, err
+}
+
+// decline marks an authorization declined for a reason
+func decline(record *models.CardAuthorizationRecord, reason string) {
+	record.Status = models.AuthorizationStatusDeclined
+	record.ReasonCode = reason
+}
+
+// cardExpiryMonth returns the YYYY-MM of a card expiry date, which the database may return as a timestamp
+func cardExpiryMonth(expiryDate string) string {
+	if len(expiryDate) < len("2006-01") {
+		return ""
+	}
+	return expiryDate[:len("2006-01")]
+}
@@ -0,0 +1,114 @@
+﻿package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cards/models"
+)
+
+// Spending control rules
+const (
+	ControlRuleOnlineDisabled      = "online_disabled"
+	ControlRuleATMDisabled         = "atm_disabled"
+	ControlRuleCountryNotAllowed   = "country_not_allowed"
+	ControlRuleMCCBlocked          = "mcc_blocked"
+	ControlRuleMCCNotAllowed       = "mcc_not_allowed"
+	ControlRulePerTransactionLimit = "per_transaction_limit"
+	ControlRuleDailyLimit          = "daily_limit"
+	ControlRuleMonthlyLimit        = "monthly_limit"
+)
+
+// ControlViolation describes the spending control a transaction broke
+type ControlViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Limit   int64  `json:"limit,omitempty"`
+}
+
+// SpendingControls checks transactions against the controls cardholders set on their cards
+type SpendingControls struct {
+	cardStore CardStore
+}
+
+func NewSpendingControls(cardStore CardStore) *SpendingControls {
+	return &SpendingControls{
+		cardStore: cardStore,
+	}
+}
+
+// Get returns the controls of a card, the defaults when none were set
+func (s *SpendingControls) Get(ctx context.Context, cardID string) (*models.CardControlsRecord, error) {
+	controls, err := s.cardStore.GetCardControls(ctx, cardID)
+	if errors.Is(err, ErrNotFound) {
+		defaults := models.DefaultCardControls(cardID)
+		return &defaults, nil
+	}
+	return controls, err
+}
+
+// EvaluateCardControls checks a transaction against the controls of its card, returning the first one it breaks.
+// The authorizer reads the controls with Get first and runs this while the card's spending is locked,
+// so it takes what the card already spent rather than reading it.
+func EvaluateCardControls(controls models.CardControlsRecord, transaction models.CardTransaction, spending models.CardSpending) *ControlViolation {
+	switch {
+	case transaction.Channel == models.TransactionChannelOnline && !controls.OnlineEnabled:
+		return &ControlViolation{Rule: ControlRuleOnlineDisabled, Message: "Online transactions are disabled for this card"}
+	case transaction.Channel == models.TransactionChannelATM && !controls.ATMEnabled:
+		return &ControlViolation{Rule: ControlRuleATMDisabled, Message: "ATM use is disabled for this card"}
+	}
+
+	if len(controls.AllowedCountries) > 0 && !containsString(controls.AllowedCountries, transaction.MerchantCountry) {
+		return &ControlViolation{
+			Rule:    ControlRuleCountryNotAllowed,
+			Message: fmt.Sprintf("Transactions in %s are not allowed for this card", transaction.MerchantCountry),
+		}
+	}
+
+	if containsString(controls.BlockedMCCs, transaction.MCC) {
+		return &ControlViolation{
+			Rule:    ControlRuleMCCBlocked,
+			Message: fmt.Sprintf("Merchant category %s is blocked for this card", transaction.MCC),
+		}
+	}
+	if len(controls.AllowedMCCs) > 0 && !containsString(controls.AllowedMCCs, transaction.MCC) {
+		return &ControlViolation{
+			Rule:    ControlRuleMCCNotAllowed,
+			Message: fmt.Sprintf("Merchant category %s is not allowed for this card", transaction.MCC),
+		}
+	}
+
+	if limit := controls.PerTransactionLimit; limit != nil && transaction.Amount > *limit {
+		return &ControlViolation{
+			Rule:    ControlRulePerTransactionLimit,
+			Message: fmt.Sprintf("Transactions above %d are not allowed for this card", *limit),
+			Limit:   *limit,
+		}
+	}
+	if limit := controls.DailyLimit; limit != nil && spending.Today+transaction.Amount > *limit {
+		return &ControlViolation{
+			Rule:    ControlRuleDailyLimit,
+			Message: fmt.Sprintf("The daily limit of %d would be exceeded", *limit),
+			Limit:   *limit,
+		}
+	}
+	if limit := controls.MonthlyLimit; limit != nil && spending.ThisMonth+transaction.Amount > *limit {
+		return &ControlViolation{
+			Rule:    ControlRuleMonthlyLimit,
+			Message: fmt.Sprintf("The monthly limit of %d would be exceeded", *limit),
+			Limit:   *limit,
+		}
+	}
+
+	return nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
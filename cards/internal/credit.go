@@ -0,0 +1,258 @@
+﻿package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"cards/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultCreditLimit       = 50000
+	defaultAPRBasisPoints    = 2499
+	defaultMinimumPercent    = 5
+	defaultMinimumPayment    = 2500
+	defaultPaymentDueDays    = 21
+	maxAPRBasisPoints        = 10000
+	statementTransactionsCap = 1000
+)
+
+var (
+	// ErrCreditLimitExceeded is returned when a purchase would take a credit line over its limit
+	ErrCreditLimitExceeded = errors.New("credit limit exceeded")
+	// ErrBillingCycleNotDue is returned when closing a billing cycle that another run already closed
+	ErrBillingCycleNotDue = errors.New("billing cycle is not due")
+	// ErrStatementNotPayable is returned when paying a statement that is not the latest one of its card
+	ErrStatementNotPayable = errors.New("only the latest statement accepts payments")
+	// ErrPaymentExceedsBalance is returned when a payment is larger than what the card owes
+	ErrPaymentExceedsBalance = errors.New("payment exceeds the outstanding balance")
+)
+
+// CreditLines assigns credit lines to credit cards and turns their billing cycles into statements
+type CreditLines struct {
+	ledgerStore    LedgerStore
+	currency       string
+	defaultLimit   int64
+	defaultAPR     int
+	cycle          time.Duration
+	minimumPercent int64
+	minimumPayment int64
+	dueDays        int
+}
+
+func NewCreditLines(ledgerStore LedgerStore, currency string) *CreditLines {
+	defaultLimit := int64(defaultCreditLimit)
+	if value, err := strconv.ParseInt(os.Getenv("CREDIT_DEFAULT_LIMIT"), 10, 64); err == nil && value > 0 {
+		defaultLimit = value
+	}
+
+	defaultAPR := defaultAPRBasisPoints
+	if value, err := strconv.Atoi(os.Getenv("CREDIT_DEFAULT_APR_BASIS_POINTS")); err == nil && value >= 0 && value <= maxAPRBasisPoints {
+		defaultAPR = value
+	}
+
+	// Billing cycles last a calendar month unless a fixed length is set, e.g. for testing
+	var cycle time.Duration
+	if value, err := time.ParseDuration(os.Getenv("STATEMENT_CYCLE")); err == nil && value > 0 {
+		cycle = value
+	}
+
+	minimumPercent := int64(defaultMinimumPercent)
+	if value, err := strconv.ParseInt(os.Getenv("STATEMENT_MINIMUM_PERCENT"), 10, 64); err == nil && value > 0 && value <= 100 {
+		minimumPercent = value
+	}
+
+	minimumPayment := int64(defaultMinimumPayment)
+	if value, err := strconv.ParseInt(os.Getenv("STATEMENT_MINIMUM_PAYMENT"), 10, 64); err == nil && value >= 0 {
+		minimumPayment = value
+	}
+
+	dueDays := defaultPaymentDueDays
+	if value, err := strconv.Atoi(os.Getenv("STATEMENT_DUE_DAYS")); err == nil && value > 0 {
+		dueDays = value
+	}
+
+	return &CreditLines{
+		ledgerStore:    ledgerStore,
+		currency:       currency,
+		defaultLimit:   defaultLimit,
+		defaultAPR:     defaultAPR,
+		cycle:          cycle,
+		minimumPercent: minimumPercent,
+		minimumPayment: minimumPayment,
+		dueDays:        dueDays,
+	}
+}
+
+// NewCreditLine creates the credit line of a new credit card from the issuer's decision,
+// falling back to the configured defaults when the issuer sent none or an invalid one
+func (c *CreditLines) NewCreditLine(cardID string, issued *models.CreditLine) models.CreditLineRecord {
+	limit, apr := c.defaultLimit, c.defaultAPR
+	if issued != nil && issued.Limit > 0 && issued.APRBasisPoints >= 0 && issued.APRBasisPoints <= maxAPRBasisPoints {
+		limit, apr = issued.Limit, issued.APRBasisPoints
+	}
+
+	now := time.Now().UTC()
+	return models.CreditLineRecord{
+		CardID:          cardID,
+		CreditLimit:     limit,
+		APRBasisPoints:  apr,
+		CycleStart:      now,
+		NextStatementAt: c.nextStatementAt(now),
+	}
+}
+
+// Get returns the credit line of a card with the credit left on it
+func (c *CreditLines) Get(ctx context.Context, cardID string) (*models.CreditSummary, error) {
+	line, err := c.ledgerStore.GetCreditLine(ctx, cardID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CreditSummary{
+		CreditLineRecord: *line,
+		Currency:         c.currency,
+		AvailableCredit:  max(line.CreditLimit-line.Balance, 0),
+	}, nil
+}
+
+// Statements returns a page of the statements of a card
+func (c *CreditLines) Statements(ctx context.Context, cardID string, query models.HistoryQuery) (*models.CreditStatementPage, error) {
+	return c.ledgerStore.GetCreditStatements(ctx, cardID, query)
+}
+
+// Statement returns a statement of a card with the ledger transactions of its billing cycle,
+// failing with ErrNotFound when the statement belongs to another card
+func (c *CreditLines) Statement(ctx context.Context, cardID, statementID string) (*models.CreditStatement, error) {
+	statement, err := c.ledgerStore.GetCreditStatement(ctx, statementID)
+	if err != nil {
+		return nil, err
+	}
+	if statement.CardID != cardID {
+		return nil, ErrNotFound
+	}
+
+	page, err := c.ledgerStore.GetLedgerTransactions(ctx, cardID, models.HistoryQuery{
+		CreatedFrom: &statement.PeriodStart,
+		CreatedTo:   &statement.PeriodEnd,
+		Ascending:   true,
+		Limit:       statementTransactionsCap,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CreditStatement{
+		CreditStatementRecord: *statement,
+		Transactions:          page.Transactions,
+	}, nil
+}
+
+// Pay pays an amount against the latest statement of a card
+func (c *CreditLines) Pay(ctx context.Context, cardID, statementID string, amount int64) (*models.CreditPaymentResponse, error) {
+	statement, err := c.ledgerStore.GetCreditStatement(ctx, statementID)
+	if err != nil {
+		return nil, err
+	}
+	if statement.CardID != cardID {
+		return nil, ErrNotFound
+	}
+
+	statement, transaction, err := c.ledgerStore.PayCreditStatement(ctx, statementID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CreditPaymentResponse{Statement: *statement, Transaction: *transaction}, nil
+}
+
+// BuildStatement closes the billing cycle of a credit line at closedAt and returns its statement,
+// with when the next cycle closes. Interest is charged monthly on the part of the previous statement
+// balance that was not paid during the cycle.
+func (c *CreditLines) BuildStatement(line models.CreditLineRecord, previous *models.CreditStatementRecord, closedAt time.Time) (models.CreditStatementRecord, time.Time) {
+	var opening int64
+	if previous != nil {
+		opening = previous.ClosingBalance
+	}
+
+	var interest int64
+	if carried := opening - line.CyclePayments; carried > 0 {
+		interest = (carried*int64(line.APRBasisPoints) + 60000) / 120000
+	}
+
+	statement := models.CreditStatementRecord{
+		ID:             uuid.New().String(),
+		CardID:         line.CardID,
+		PeriodStart:    line.CycleStart,
+		PeriodEnd:      closedAt,
+		Currency:       c.currency,
+		CreditLimit:    line.CreditLimit,
+		APRBasisPoints: line.APRBasisPoints,
+		OpeningBalance: opening,
+		Purchases:      line.CyclePurchases,
+		Refunds:        line.CycleRefunds,
+		Payments:       line.CyclePayments,
+		Interest:       interest,
+		ClosingBalance: line.Balance + interest,
+		DueDate:        closedAt.AddDate(0, 0, c.dueDays).Format("2006-01-02"),
+		CreatedAt:      closedAt,
+	}
+	statement.MinimumPayment = c.minimumPaymentOf(statement.ClosingBalance)
+	statement.Status = statementStatus(statement)
+
+	// The next cycle is scheduled from the previous close time, so a late run does not shift the cycles
+	next := c.nextStatementAt(line.NextStatementAt)
+	for !next.After(closedAt) {
+		next = c.nextStatementAt(next)
+	}
+
+	return statement, next
+}
+
+// minimumPaymentOf is the configured share of a balance, at least the configured amount and at most the balance
+func (c *CreditLines) minimumPaymentOf(balance int64) int64 {
+	if balance <= 0 {
+		return 0
+	}
+	minimum := (balance*c.minimumPercent + 99) / 100
+	return min(max(minimum, c.minimumPayment), balance)
+}
+
+// nextStatementAt is when a billing cycle closing at the given time is followed by the next one
+func (c *CreditLines) nextStatementAt(from time.Time) time.Time {
+	if c.cycle > 0 {
+		return from.Add(c.cycle)
+	}
+	return from.AddDate(0, 1, 0)
+}
+
+// statementStatus tells whether a statement was paid in full, down to its minimum payment, or not yet
+func statementStatus(statement models.CreditStatementRecord) string {
+	switch {
+	case statement.PaidAmount >= statement.ClosingBalance:
+		return models.StatementStatusPaid
+	case statement.PaidAmount >= statement.MinimumPayment:
+		return models.StatementStatusMinimumPaid
+	default:
+		return models.StatementStatusOpen
+	}
+}
+
+// paymentTransaction posts a statement payment: the card is credited with what its owner paid
+func paymentTransaction(statement models.CreditStatementRecord, amount int64, createdAt time.Time) models.LedgerTransactionRecord {
+	return newLedgerTransaction(statement.CardID, models.LedgerTransactionPayment, amount, statement.Currency,
+		"Payment of statement "+statement.PeriodEnd.Format("2006-01-02"), nil,
+		models.LedgerAccountCreditPayments, models.CardLedgerAccount(statement.CardID), createdAt)
+}
+
+// interestTransaction posts the interest of a statement, just before its period ends so it is listed on it
+func interestTransaction(statement models.CreditStatementRecord) models.LedgerTransactionRecord {
+	return newLedgerTransaction(statement.CardID, models.LedgerTransactionInterest, statement.Interest, statement.Currency,
+		"Interest", nil, models.CardLedgerAccount(statement.CardID), models.LedgerAccountInterestIncome,
+		statement.PeriodEnd.Add(-time.Microsecond))
+}
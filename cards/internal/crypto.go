@@ -0,0 +1,414 @@
+﻿package internal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cards/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// encryptedPrefix marks values encrypted with a data key, as "enc:v1:<key id>:<base64 nonce+ciphertext>"
+const encryptedPrefix = "enc:v1:"
+
+// dataKeyLockID is the advisory lock key held while a data key is created, so replicas starting together create one
+const dataKeyLockID = 6461746173303031
+
+// keyRefreshInterval is how often the active data key is reloaded to pick up rotations
+const keyRefreshInterval = 5 * time.Minute
+
+// CardCipher encrypts card fields with data keys wrapped by a master key
+type CardCipher struct {
+	db        *gorm.DB
+	masterKey []byte
+
+	mutex       sync.RWMutex
+	keys        map[string][]byte
+	activeKeyID string
+	refreshedAt time.Time
+	// Keys PAN fingerprints, derived from the oldest data key so rotations and rewraps keep it
+	fingerprintKey []byte
+}
+
+// LoadMasterKey reads a 32 byte master key from a file, hex or base64 encoded
+func LoadMasterKey(path string) ([]byte, error) {
+	if path == "" {
+		return nil, errors.New("master key file not configured")
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file: %w", err)
+	}
+
+	encoded := strings.TrimSpace(string(content))
+	key, err := hex.DecodeString(encoded)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.New("master key must be hex or base64 encoded")
+		}
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+
+	return key, nil
+}
+
+// NewCardCipher loads the data keys, creating the first one if none exist
+func NewCardCipher(db *gorm.DB, masterKey []byte) (*CardCipher, error) {
+	c := &CardCipher{
+		db:        db,
+		masterKey: masterKey,
+		keys:      make(map[string][]byte),
+	}
+
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+
+	if c.activeKeyID == "" {
+		if _, err := c.createDataKey(true); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Encrypt encrypts a value with the active data key
+func (c *CardCipher) Encrypt(plaintext string) (string, error) {
+	c.mutex.RLock()
+	stale := time.Since(c.refreshedAt) > keyRefreshInterval
+	c.mutex.RUnlock()
+
+	if stale {
+		if err := c.refresh(); err != nil {
+			return "", err
+		}
+	}
+
+	c.mutex.RLock()
+	keyID := c.activeKeyID
+	key := c.keys[keyID]
+	c.mutex.RUnlock()
+
+	ciphertext, err := seal(key, []byte(plaintext), []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + keyID + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt decrypts a value encrypted with any known data key.
+// Values stored before encryption was enabled are returned as they are.
+func (c *CardCipher) Decrypt(value string) (string, error) {
+	keyID, ciphertext, encrypted, err := parseEncrypted(value)
+	if err != nil {
+		return "", err
+	}
+	if !encrypted {
+		return value, nil
+	}
+
+	key, err := c.key(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(key, ciphertext, []byte(keyID))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value with key %s: %w", keyID, err)
+	}
+
+	return string(plaintext), nil
+}
+
+// Fingerprint returns a keyed hash of a PAN, the same for every encryption of it
+func (c *CardCipher) Fingerprint(pan string) string {
+	c.mutex.RLock()
+	key := c.fingerprintKey
+	c.mutex.RUnlock()
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(pan))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NeedsReencryption reports whether a value is not encrypted with the active data key
+func (c *CardCipher) NeedsReencryption(value string) bool {
+	keyID, _, encrypted, err := parseEncrypted(value)
+	if err != nil || !encrypted {
+		return true
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return keyID != c.activeKeyID
+}
+
+// RotateDataKey creates a new data key and makes it the active one
+func (c *CardCipher) RotateDataKey() (string, error) {
+	return c.createDataKey(false)
+}
+
+// createDataKey creates a data key and makes it the active one. With first set it only creates
+// the first key, and loads the one another replica created in the meantime instead.
+func (c *CardCipher) createDataKey(first bool) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	keyID := uuid.New().String()
+	wrapped, err := seal(c.masterKey, dataKey, []byte("data-key:"+keyID))
+	if err != nil {
+		return "", err
+	}
+
+	created := false
+	err = c.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", dataKeyLockID).Error; err != nil {
+			return err
+		}
+
+		if first {
+			var active int64
+			if err := tx.Model(&models.DataKeyRecord{}).Where("active = ?", true).Count(&active).Error; err != nil {
+				return err
+			}
+			if active > 0 {
+				return nil
+			}
+		}
+
+		if err := tx.Model(&models.DataKeyRecord{}).Where("active = ?", true).Update("active", false).Error; err != nil {
+			return err
+		}
+		created = true
+
+		return tx.Create(&models.DataKeyRecord{
+			ID:         keyID,
+			WrappedKey: base64.StdEncoding.EncodeToString(wrapped),
+			Active:     true,
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	if !created {
+		return "", c.refresh()
+	}
+
+	c.mutex.Lock()
+	c.keys[keyID] = dataKey
+	c.activeKeyID = keyID
+	// The first data key also keys the PAN fingerprints
+	if c.fingerprintKey == nil {
+		c.fingerprintKey = deriveFingerprintKey(dataKey)
+	}
+	c.mutex.Unlock()
+
+	return keyID, nil
+}
+
+// RewrapDataKeys wraps every data key with a new master key
+func (c *CardCipher) RewrapDataKeys(newMasterKey []byte) error {
+	err := c.db.Transaction(func(tx *gorm.DB) error {
+		var records []models.DataKeyRecord
+		if err := tx.Find(&records).Error; err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			dataKey, err := c.unwrap(record)
+			if err != nil {
+				return err
+			}
+
+			wrapped, err := seal(newMasterKey, dataKey, []byte("data-key:"+record.ID))
+			if err != nil {
+				return err
+			}
+
+			err = tx.Model(&models.DataKeyRecord{}).
+				Where("id = ?", record.ID).
+				Update("wrapped_key", base64.StdEncoding.EncodeToString(wrapped)).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.masterKey = newMasterKey
+	c.mutex.Unlock()
+
+	return nil
+}
+
+// key returns a data key by ID, reloading the keys if it is not known yet
+func (c *CardCipher) key(keyID string) ([]byte, error) {
+	c.mutex.RLock()
+	key, exists := c.keys[keyID]
+	c.mutex.RUnlock()
+	if exists {
+		return key, nil
+	}
+
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if key, exists := c.keys[keyID]; exists {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown data key %s", keyID)
+}
+
+// refresh loads and unwraps every data key from the database
+func (c *CardCipher) refresh() error {
+	var records []models.DataKeyRecord
+	if err := c.db.Find(&records).Error; err != nil {
+		return fmt.Errorf("failed to load data keys: %w", err)
+	}
+
+	keys := make(map[string][]byte, len(records))
+	activeKeyID := ""
+	var oldest *models.DataKeyRecord
+	for i, record := range records {
+		dataKey, err := c.unwrap(record)
+		if err != nil {
+			return err
+		}
+		keys[record.ID] = dataKey
+		if record.Active {
+			activeKeyID = record.ID
+		}
+		if oldest == nil || record.CreatedAt.Before(oldest.CreatedAt) ||
+			(record.CreatedAt.Equal(oldest.CreatedAt) && record.ID < oldest.ID) {
+			oldest = &records[i]
+		}
+	}
+
+	var fingerprintKey []byte
+	if oldest != nil {
+		fingerprintKey = deriveFingerprintKey(keys[oldest.ID])
+	}
+
+	c.mutex.Lock()
+	c.keys = keys
+	c.activeKeyID = activeKeyID
+	c.fingerprintKey = fingerprintKey
+	c.refreshedAt = time.Now()
+	c.mutex.Unlock()
+
+	return nil
+}
+
+func (c *CardCipher) unwrap(record models.DataKeyRecord) ([]byte, error) {
+	wrapped, err := base64.StdEncoding.DecodeString(record.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped data key %s: %w", record.ID, err)
+	}
+
+	c.mutex.RLock()
+	masterKey := c.masterKey
+	c.mutex.RUnlock()
+
+	dataKey, err := open(masterKey, wrapped, []byte("data-key:"+record.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key %s, wrong master key?: %w", record.ID, err)
+	}
+
+	return dataKey, nil
+}
+
+// deriveFingerprintKey derives the PAN fingerprint key from a data key
+func deriveFingerprintKey(dataKey []byte) []byte {
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write([]byte("pan-fingerprint"))
+	return mac.Sum(nil)
+}
+
+// parseEncrypted splits an encrypted value into its key ID and ciphertext
+func parseEncrypted(value string) (string, []byte, bool, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return "", nil, false, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, encryptedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", nil, false, errors.New("malformed encrypted value")
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, false, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+
+	return parts[0], ciphertext, true, nil
+}
+
+// seal encrypts with AES-256-GCM, prefixing the nonce to the ciphertext
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts a value produced by seal
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,126 @@
+﻿package internal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"cards/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrUnbalancedLedgerTransaction is returned when the debits of a ledger transaction do not match its credits
+var ErrUnbalancedLedgerTransaction = errors.New("ledger transaction debits and credits differ")
+
+// purchaseTransaction posts an approved authorization: the card is debited and the merchants are owed the amount
+func purchaseTransaction(record models.CardAuthorizationRecord) models.LedgerTransactionRecord {
+	authorizationID := record.ID
+	return newLedgerTransaction(*record.CardID, models.LedgerTransactionPurchase, record.Amount, record.Currency, record.MerchantName,
+		&authorizationID, models.CardLedgerAccount(*record.CardID), models.LedgerAccountMerchantSettlement, record.CreatedAt)
+}
+
+// refundTransaction gives back part or all of a purchase: the merchants owe less and the card is credited
+func refundTransaction(record models.CardAuthorizationRecord, amount int64, createdAt time.Time) models.LedgerTransactionRecord {
+	authorizationID := record.ID
+	return newLedgerTransaction(*record.CardID, models.LedgerTransactionRefund, amount, record.Currency, "Refund: "+record.MerchantName,
+		&authorizationID, models.LedgerAccountMerchantSettlement, models.CardLedgerAccount(*record.CardID), createdAt)
+}
+
+// newLedgerTransaction moves an amount of a card from the debited account to the credited one
+func newLedgerTransaction(cardID, transactionType string, amount int64, currency, description string, authorizationID *string,
+	debitAccount, creditAccount string, createdAt time.Time) models.LedgerTransactionRecord {
+	transactionID := uuid.New().String()
+
+	return models.LedgerTransactionRecord{
+		ID:              transactionID,
+		CardID:          cardID,
+		Type:            transactionType,
+		AuthorizationID: authorizationID,
+		Amount:          amount,
+		Currency:        currency,
+		Description:     description,
+		CreatedAt:       createdAt,
+		Entries: []models.LedgerEntryRecord{
+			{
+				TransactionID: transactionID,
+				Account:       debitAccount,
+				Direction:     models.LedgerDebit,
+				Amount:        amount,
+				Currency:      currency,
+				CreatedAt:     createdAt,
+			},
+			{
+				TransactionID: transactionID,
+				Account:       creditAccount,
+				Direction:     models.LedgerCredit,
+				Amount:        amount,
+				Currency:      currency,
+				CreatedAt:     createdAt,
+			},
+		},
+	}
+}
+
+// checkBalanced makes sure a ledger transaction has positive entries whose debits equal its credits in every currency
+func checkBalanced(transaction models.LedgerTransactionRecord) error {
+	totals := map[string]int64{}
+	for _, entry := range transaction.Entries {
+		if entry.Amount <= 0 {
+			return ErrUnbalancedLedgerTransaction
+		}
+		switch entry.Direction {
+		case models.LedgerDebit:
+			totals[entry.Currency] += entry.Amount
+		case models.LedgerCredit:
+			totals[entry.Currency] -= entry.Amount
+		default:
+			return ErrUnbalancedLedgerTransaction
+		}
+	}
+
+	if len(transaction.Entries) < 2 {
+		return ErrUnbalancedLedgerTransaction
+	}
+	for _, total := range totals {
+		if total != 0 {
+			return ErrUnbalancedLedgerTransaction
+		}
+	}
+
+	return nil
+}
+
+// FormatAmount formats an amount in minor units with two decimals
+func FormatAmount(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// spendingPeriods returns the start of the UTC day and month the time falls in
+func spendingPeriods(at time.Time) (time.Time, time.Time) {
+	at = at.UTC()
+	dayStart := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return dayStart, monthStart
+}
+
+// decideAuthorization completes a pending authorization of a card in the given status,
+// declining it when the card is no longer active and otherwise with the reason decide returns
+func decideAuthorization(record *models.CardAuthorizationRecord, cardStatus string, spending models.CardSpending, decide func(models.CardSpending) string) {
+	reason := models.AuthorizationReasonCardNotActive
+	if cardStatus == models.CardStatusActive {
+		reason = decide(spending)
+	}
+
+	if reason == "" {
+		record.Status = models.AuthorizationStatusApproved
+		record.ReasonCode = models.AuthorizationReasonApproved
+	} else {
+		record.Status = models.AuthorizationStatusDeclined
+		record.ReasonCode = reason
+	}
+}
@@ -0,0 +1,1866 @@
+﻿package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cards/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrCitizenAlreadyRegistered is returned by the memory store for a second user with the same citizen ID
+var ErrCitizenAlreadyRegistered = errors.New("citizen ID already registered")
+
+// MemoryStore keeps every record in process memory, for running the service and its tests offline.
+// It implements UserStore, CardStore, RequestStore and AuditStore, and loses everything on restart.
+type MemoryStore struct {
+	mu sync.Mutex
+	// admitMu stores requests one at a time, their admit check reads the store so it cannot hold mu
+	admitMu sync.Mutex
+
+	users          map[string]models.UserRecord // by user token
+	cards          map[string]models.IssuedCardRecord
+	statusChanges  []models.CardStatusChangeRecord
+	failedAttempts []models.FailedAttemptRecord
+	revealAudits   []models.CardRevealAuditRecord
+	cardPINs       map[string]models.CardPINRecord
+	cardControls   map[string]models.CardControlsRecord
+	authorizations []models.CardAuthorizationRecord
+	ledger         []models.LedgerTransactionRecord
+	prepaid        map[string]models.PrepaidAccountRecord
+	prepaidChanges []models.PrepaidBalanceChangeRecord
+	creditLines    map[string]models.CreditLineRecord
+	statements     []models.CreditStatementRecord
+	userErasures   []models.UserErasureRecord
+	auditEvents    []models.AuditEventRecord // in sequence order
+
+	requests        map[string]models.CardRequestRecord
+	outbox          map[string]models.OutboxMessageRecord
+	outboxInFlight  map[string]bool
+	idempotencyKeys map[string]models.IdempotencyKeyRecord // by scope and key
+}
+
+// MemorySessionStore is the SessionStore counterpart of MemoryStore, with Redis-like expirations
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+}
+
+// memorySession is a cached value with an optional expiration, like a Redis key
+type memorySession struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+var (
+	_ UserStore    = (*MemoryStore)(nil)
+	_ CardStore    = (*MemoryStore)(nil)
+	_ RequestStore = (*MemoryStore)(nil)
+	_ AuditStore   = (*MemoryStore)(nil)
+	_ LedgerStore  = (*MemoryStore)(nil)
+	_ SessionStore = (*MemorySessionStore)(nil)
+)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:           map[string]models.UserRecord{},
+		cards:           map[string]models.IssuedCardRecord{},
+		cardPINs:        map[string]models.CardPINRecord{},
+		cardControls:    map[string]models.CardControlsRecord{},
+		prepaid:         map[string]models.PrepaidAccountRecord{},
+		creditLines:     map[string]models.CreditLineRecord{},
+		requests:        map[string]models.CardRequestRecord{},
+		outbox:          map[string]models.OutboxMessageRecord{},
+		outboxInFlight:  map[string]bool{},
+		idempotencyKeys: map[string]models.IdempotencyKeyRecord{},
+	}
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: map[string]memorySession{},
+	}
+}
+
+// StoreUser stores a user, rejecting a citizen ID or token already registered
+func (m *MemoryStore) StoreUser(ctx context.Context, userToken string, user models.User) (*models.UserRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.users[userToken]; exists {
+		return nil, fmt.Errorf("user token %s already registered", userToken)
+	}
+	for _, existing := range m.users {
+		if existing.CitizenID == user.CitizenID {
+			return nil, ErrCitizenAlreadyRegistered
+		}
+	}
+
+	now := time.Now()
+	userRecord := models.UserRecord{
+		ID:          uuid.New().String(),
+		UserToken:   userToken,
+		Name:        user.Name,
+		Lastname:    user.Lastname,
+		BirthDate:   user.BirthDate,
+		CountryCode: user.CountryCode,
+		CitizenID:   user.CitizenID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	m.users[userToken] = userRecord
+
+	return &userRecord, nil
+}
+
+// GetUserByToken retrieves a user by token
+func (m *MemoryStore) GetUserByToken(ctx context.Context, userToken string) (*models.UserRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userRecord, ok := m.users[userToken]
+	if !ok || userRecord.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+
+	return &userRecord, nil
+}
+
+// GetUserByCitizenID retrieves a user by citizen ID
+func (m *MemoryStore) GetUserByCitizenID(ctx context.Context, citizenID string) (*models.UserRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, userRecord := range m.users {
+		if userRecord.CitizenID == citizenID && !userRecord.DeletedAt.Valid {
+			return &userRecord, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetUserByID retrieves a user by ID, including soft-deleted users
+func (m *MemoryStore) GetUserByID(ctx context.Context, userID string) (*models.UserRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.userTokenByID(userID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	userRecord := m.users[token]
+	return &userRecord, nil
+}
+
+// SearchUsers retrieves a page of the users matching the query
+func (m *MemoryStore) SearchUsers(ctx context.Context, query models.UserSearchQuery) (*models.UserPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := strings.ToLower(query.Name)
+	var users []models.UserRecord
+	for _, userRecord := range m.users {
+		switch {
+		case query.Deleted == models.UserDeletedOnly && !userRecord.DeletedAt.Valid,
+			query.Deleted != models.UserDeletedOnly && query.Deleted != models.UserDeletedInclude && userRecord.DeletedAt.Valid:
+			continue
+		}
+		fullName := strings.ToLower(userRecord.Name + " " + userRecord.Lastname)
+		if name != "" && !strings.Contains(fullName, name) {
+			continue
+		}
+		if query.CitizenID != "" && userRecord.CitizenID != query.CitizenID {
+			continue
+		}
+		if query.CountryCode != "" && userRecord.CountryCode != query.CountryCode {
+			continue
+		}
+		if matchesHistory(query.HistoryQuery, "", "", userRecord.CreatedAt, userRecord.ID) {
+			users = append(users, userRecord)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return historyLess(query.HistoryQuery, users[i].CreatedAt, users[i].ID, users[j].CreatedAt, users[j].ID)
+	})
+
+	page := &models.UserPage{Users: []models.AdminUser{}}
+	if len(users) > query.Limit {
+		users = users[:query.Limit]
+		last := users[len(users)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	for _, userRecord := range users {
+		page.Users = append(page.Users, models.NewAdminUser(userRecord))
+	}
+
+	return page, nil
+}
+
+// SoftDeleteUser marks a user as deleted, it can no longer request or list cards
+func (m *MemoryStore) SoftDeleteUser(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.userTokenByID(userID)
+	if !ok || m.users[token].DeletedAt.Valid {
+		return ErrNotFound
+	}
+
+	userRecord := m.users[token]
+	userRecord.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	m.users[token] = userRecord
+	return nil
+}
+
+// RestoreUser clears the deletion of a soft-deleted user that was not erased
+func (m *MemoryStore) RestoreUser(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.userTokenByID(userID)
+	if !ok || !m.users[token].DeletedAt.Valid || m.users[token].ErasedAt != nil {
+		return ErrNotFound
+	}
+
+	userRecord := m.users[token]
+	userRecord.DeletedAt = gorm.DeletedAt{}
+	userRecord.UpdatedAt = time.Now()
+	m.users[token] = userRecord
+	return nil
+}
+
+// EraseUser irreversibly removes the personal data of a user, keeping the card, attempt and
+// request records without anything that identifies them
+func (m *MemoryStore) EraseUser(ctx context.Context, userID string, erasure models.UserErasureRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.userTokenByID(userID)
+	if !ok {
+		return ErrNotFound
+	}
+	userRecord := m.users[token]
+	if userRecord.ErasedAt != nil {
+		return ErrUserErased
+	}
+
+	erasedToken := erasedUserToken(userID)
+	now := time.Now()
+
+	for _, card := range m.cards {
+		if card.UserID != userID {
+			continue
+		}
+		if models.CanTransitionCardStatus(card.Status, models.CardStatusCancelled) {
+			if err := m.changeCardStatus(card.ID, card.Status, models.CardStatusCancelled, "erasure", "Personal data erased"); err != nil {
+				return err
+			}
+			card = m.cards[card.ID]
+		}
+		delete(m.cardPINs, card.ID)
+		delete(m.cardControls, card.ID)
+		for i, authorization := range m.authorizations {
+			if authorization.CardID != nil && *authorization.CardID == card.ID {
+				m.authorizations[i].MerchantName = ""
+				m.authorizations[i].MerchantMCC = ""
+				m.authorizations[i].MerchantCountry = ""
+			}
+		}
+		card.PAN = maskPAN(card.PAN)
+		card.CVV = ""
+		card.UserToken = erasedToken
+		m.cards[card.ID] = card
+	}
+
+	for i := range m.failedAttempts {
+		if m.failedAttempts[i].UserID == userID {
+			m.failedAttempts[i].UserToken = erasedToken
+		}
+	}
+
+	for requestUUID, request := range m.requests {
+		if request.UserToken != token {
+			continue
+		}
+		for id, message := range m.outbox {
+			if message.AggregateID == requestUUID {
+				message.Payload = "{}"
+				m.outbox[id] = message
+			}
+		}
+		request.UserToken = erasedToken
+		m.requests[requestUUID] = request
+	}
+
+	for i := range m.revealAudits {
+		if m.revealAudits[i].UserID == userID {
+			m.revealAudits[i].ClientIP = ""
+			m.revealAudits[i].UserAgent = ""
+		}
+	}
+
+	userRecord.UserToken = erasedToken
+	userRecord.Name = ""
+	userRecord.Lastname = ""
+	userRecord.BirthDate = erasedBirthDate
+	userRecord.CitizenID = erasedToken
+	if !userRecord.DeletedAt.Valid {
+		userRecord.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+	}
+	userRecord.ErasedAt = &now
+	userRecord.UpdatedAt = now
+	delete(m.users, token)
+	m.users[erasedToken] = userRecord
+
+	erasure.UserID = userID
+	erasure.CreatedAt = now
+	m.userErasures = append(m.userErasures, erasure)
+
+	return nil
+}
+
+func (m *MemoryStore) userTokenByID(userID string) (string, bool) {
+	for token, userRecord := range m.users {
+		if userRecord.ID == userID {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// StoreIssuedCard stores an issued card, marking its request as issued and the card it replaces as replaced or renewed.
+// The returned flag reports whether the replaced card was superseded.
+func (m *MemoryStore) StoreIssuedCard(ctx context.Context, requestUUID string, record models.IssuedCardRecord) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if record.ReplacesCardID != nil {
+		if _, ok := m.cards[*record.ReplacesCardID]; !ok {
+			return false, ErrNotFound
+		}
+	}
+
+	now := time.Now()
+	err := m.completeCardRequest(requestUUID, models.CardRequestStatusIssued, func(request *models.CardRequestRecord) {
+		request.IssuedCardID = &record.ID
+		request.IssuedAt = &now
+	})
+	if err != nil {
+		return false, err
+	}
+
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	if record.CreditLine != nil {
+		line := *record.CreditLine
+		line.CreatedAt = now
+		line.UpdatedAt = now
+		m.creditLines[line.CardID] = line
+		record.CreditLine = nil
+	}
+	m.cards[record.ID] = record
+
+	if record.ReplacesCardID == nil {
+		return false, nil
+	}
+
+	replaced := m.cards[*record.ReplacesCardID]
+	to := models.SupersededCardStatus(replaced.Status)
+	if !models.CanTransitionCardStatus(replaced.Status, to) {
+		return false, nil
+	}
+	if err := m.changeCardStatus(replaced.ID, replaced.Status, to, "system", supersededReason(to, record.ID)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetIssuedCardByID retrieves an issued card by its ID
+func (m *MemoryStore) GetIssuedCardByID(ctx context.Context, cardID string) (*models.IssuedCardRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	card, ok := m.cards[cardID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &card, nil
+}
+
+// GetOwnedCard retrieves a card of the user token, returning ErrNotFound when it belongs to
+// someone else or its owner is soft-deleted
+func (m *MemoryStore) GetOwnedCard(ctx context.Context, cardID, userToken string) (*models.IssuedCardRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	card, ok := m.cards[cardID]
+	if !ok || card.UserToken != userToken {
+		return nil, ErrNotFound
+	}
+	if owner, ok := m.users[userToken]; !ok || owner.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+
+	return &card, nil
+}
+
+// GetIssuedCardByPAN retrieves the most recent card with a PAN
+func (m *MemoryStore) GetIssuedCardByPAN(ctx context.Context, pan string) (*models.IssuedCardRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var found *models.IssuedCardRecord
+	for _, card := range m.cards {
+		if card.PAN == pan && (found == nil || card.CreatedAt.After(found.CreatedAt)) {
+			found = &card
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+
+	return found, nil
+}
+
+// GetExpiringCards retrieves active and blocked cards expiring before the given time, soonest first,
+// continuing after the given card when it is set. Cards with a pending or issued request to supersede
+// them and cards of deleted users are left out; a declined or expired renewal is tried again.
+func (m *MemoryStore) GetExpiringCards(ctx context.Context, expiresBefore time.Time, after *models.IssuedCardRecord, limit int) ([]models.IssuedCardRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	superseded := map[string]bool{}
+	for _, request := range m.requests {
+		if request.ReplacesCardID != nil && (request.IsPending() || request.Status == models.CardRequestStatusIssued) {
+			superseded[*request.ReplacesCardID] = true
+		}
+	}
+
+	before := expiresBefore.Format("2006-01-02")
+	var cards []models.IssuedCardRecord
+	for _, card := range m.cards {
+		userRecord, ok := m.users[card.UserToken]
+		if (card.Status != models.CardStatusActive && card.Status != models.CardStatusBlocked) ||
+			card.ExpiryDate >= before || superseded[card.ID] || !ok || userRecord.DeletedAt.Valid {
+			continue
+		}
+		if after != nil && (card.ExpiryDate < after.ExpiryDate || card.ExpiryDate == after.ExpiryDate && card.ID <= after.ID) {
+			continue
+		}
+		cards = append(cards, card)
+	}
+	sort.Slice(cards, func(i, j int) bool {
+		if cards[i].ExpiryDate != cards[j].ExpiryDate {
+			return cards[i].ExpiryDate < cards[j].ExpiryDate
+		}
+		return cards[i].ID < cards[j].ID
+	})
+
+	return cards[:min(len(cards), limit)], nil
+}
+
+// ChangeCardStatus moves a card from one status to another and records who changed it
+func (m *MemoryStore) ChangeCardStatus(ctx context.Context, cardID, from, to, changedBy, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.changeCardStatus(cardID, from, to, changedBy, reason)
+}
+
+func (m *MemoryStore) changeCardStatus(cardID, from, to, changedBy, reason string) error {
+	if !models.CanTransitionCardStatus(from, to) {
+		return fmt.Errorf("cannot move card from %s to %s", from, to)
+	}
+
+	card, ok := m.cards[cardID]
+	if !ok || card.Status != from {
+		return ErrCardStatusConflict
+	}
+
+	now := time.Now()
+	card.Status = to
+	card.StatusChangedAt = &now
+	card.StatusChangedBy = changedBy
+	card.UpdatedAt = now
+	m.cards[cardID] = card
+
+	m.statusChanges = append(m.statusChanges, models.CardStatusChangeRecord{
+		ID:         uuid.New().String(),
+		CardID:     cardID,
+		FromStatus: from,
+		ToStatus:   to,
+		ChangedBy:  changedBy,
+		Reason:     reason,
+		CreatedAt:  now,
+	})
+
+	return nil
+}
+
+// StoreFailedAttempt stores a failed attempt and marks its request as declined
+func (m *MemoryStore) StoreFailedAttempt(ctx context.Context, requestUUID string, record models.FailedAttemptRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	err := m.completeCardRequest(requestUUID, models.CardRequestStatusDeclined, func(request *models.CardRequestRecord) {
+		request.DeclineReason = record.DeclineReason
+		request.DeclinedAt = &now
+	})
+	if err != nil {
+		return err
+	}
+
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	m.failedAttempts = append(m.failedAttempts, record)
+
+	return nil
+}
+
+// GetCardsByUserID retrieves a page of the cards of a user with their PANs masked
+func (m *MemoryStore) GetCardsByUserID(ctx context.Context, userID string, query models.HistoryQuery) (*models.CardPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var cards []models.IssuedCardRecord
+	for _, card := range m.cards {
+		if card.UserID == userID && matchesHistory(query, card.CardType, card.Status, card.CreatedAt, card.ID) {
+			cards = append(cards, card)
+		}
+	}
+	sort.Slice(cards, func(i, j int) bool {
+		return historyLess(query, cards[i].CreatedAt, cards[i].ID, cards[j].CreatedAt, cards[j].ID)
+	})
+
+	page := &models.CardPage{Cards: []models.MaskedCard{}}
+	if len(cards) > query.Limit {
+		cards = cards[:query.Limit]
+		last := cards[len(cards)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	for _, card := range cards {
+		page.Cards = append(page.Cards, maskCard(card))
+	}
+
+	return page, nil
+}
+
+// GetFailedAttemptsByUserID retrieves a page of the failed issue attempts of a user
+func (m *MemoryStore) GetFailedAttemptsByUserID(ctx context.Context, userID string, query models.HistoryQuery) (*models.FailedAttemptPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var attempts []models.FailedAttemptRecord
+	for _, attempt := range m.failedAttempts {
+		if attempt.UserID == userID && matchesHistory(query, attempt.CardType, attempt.Status, attempt.CreatedAt, attempt.ID) {
+			attempts = append(attempts, attempt)
+		}
+	}
+	sort.Slice(attempts, func(i, j int) bool {
+		return historyLess(query, attempts[i].CreatedAt, attempts[i].ID, attempts[j].CreatedAt, attempts[j].ID)
+	})
+
+	page := &models.FailedAttemptPage{Attempts: []models.FailedAttempt{}}
+	if len(attempts) > query.Limit {
+		attempts = attempts[:query.Limit]
+		last := attempts[len(attempts)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	for _, attempt := range attempts {
+		page.Attempts = append(page.Attempts, failedAttempt(attempt))
+	}
+
+	return page, nil
+}
+
+// matchesHistory applies the filters and cursor of a history query the same way historyScope does
+func matchesHistory(query models.HistoryQuery, cardType, status string, createdAt time.Time, id string) bool {
+	if query.CardType != "" && cardType != query.CardType {
+		return false
+	}
+	if query.Status != "" && status != query.Status {
+		return false
+	}
+	if query.CreatedFrom != nil && createdAt.Before(*query.CreatedFrom) {
+		return false
+	}
+	if query.CreatedTo != nil && !createdAt.Before(*query.CreatedTo) {
+		return false
+	}
+	if query.After != nil {
+		return historyLess(query, query.After.CreatedAt, query.After.ID, createdAt, id)
+	}
+	return true
+}
+
+// historyLess reports whether the first item comes before the second in the query's sort order
+func historyLess(query models.HistoryQuery, createdAtA time.Time, idA string, createdAtB time.Time, idB string) bool {
+	if !createdAtA.Equal(createdAtB) {
+		return createdAtA.Before(createdAtB) == query.Ascending
+	}
+	return idA != idB && (idA < idB) == query.Ascending
+}
+
+// CountCardsByUserToken counts the cards of a user in the given statuses, of any card type when cardType is empty
+func (m *MemoryStore) CountCardsByUserToken(ctx context.Context, userToken, cardType string, statuses []string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for _, card := range m.cards {
+		if card.UserToken != userToken || (cardType != "" && card.CardType != cardType) {
+			continue
+		}
+		for _, status := range statuses {
+			if card.Status == status {
+				count++
+				break
+			}
+		}
+	}
+	return count, nil
+}
+
+// GetFullCard retrieves the complete details of a card, including its PAN and CVV
+func (m *MemoryStore) GetFullCard(ctx context.Context, cardID string) (*models.FullCard, error) {
+	card, err := m.GetIssuedCardByID(ctx, cardID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.FullCard{
+		CardID:     card.ID,
+		CardPAN:    card.PAN,
+		CardCVV:    card.CVV,
+		CardExpiry: card.ExpiryDate,
+		CardType:   card.CardType,
+		CardStatus: card.Status,
+	}, nil
+}
+
+// StoreRevealAudit stores an attempt to reveal card details
+func (m *MemoryStore) StoreRevealAudit(ctx context.Context, record models.CardRevealAuditRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	m.revealAudits = append(m.revealAudits, record)
+
+	return nil
+}
+
+// GetCardPIN retrieves the PIN of a card
+func (m *MemoryStore) GetCardPIN(ctx context.Context, cardID string) (*models.CardPINRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.cardPINs[cardID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &record, nil
+}
+
+// CreateCardPIN stores the first PIN of a card, failing if the card already has one
+func (m *MemoryStore) CreateCardPIN(ctx context.Context, cardID, pinHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.cardPINs[cardID]; ok {
+		return ErrCardPINAlreadySet
+	}
+
+	now := time.Now()
+	m.cardPINs[cardID] = models.CardPINRecord{
+		CardID:    cardID,
+		PINHash:   pinHash,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	return nil
+}
+
+// ChangeCardPIN replaces the PIN of a card and clears its failed attempts, unless it is locked
+func (m *MemoryStore) ChangeCardPIN(ctx context.Context, cardID, pinHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.cardPINs[cardID]
+	if !ok || record.LockedAt != nil {
+		return ErrCardPINLocked
+	}
+
+	record.PINHash = pinHash
+	record.FailedAttempts = 0
+	record.UpdatedAt = time.Now()
+	m.cardPINs[cardID] = record
+
+	return nil
+}
+
+// RecordCardPINAttempt counts a verification before the PIN is compared, locking the PIN when it reaches maxAttempts
+func (m *MemoryStore) RecordCardPINAttempt(ctx context.Context, cardID string, maxAttempts int) (*models.CardPINRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.cardPINs[cardID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if record.LockedAt != nil {
+		return nil, ErrCardPINLocked
+	}
+
+	now := time.Now()
+	record.FailedAttempts++
+	if record.FailedAttempts >= maxAttempts {
+		record.LockedAt = &now
+	}
+	record.UpdatedAt = now
+	m.cardPINs[cardID] = record
+
+	return &record, nil
+}
+
+// ResetCardPINAttempts clears the attempts of a PIN after a successful verification, unless others were counted since
+func (m *MemoryStore) ResetCardPINAttempts(ctx context.Context, cardID string, attempts int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.cardPINs[cardID]
+	if ok && record.FailedAttempts == attempts {
+		record.LockedAt = nil
+		record.FailedAttempts = 0
+		record.UpdatedAt = time.Now()
+		m.cardPINs[cardID] = record
+	}
+
+	return nil
+}
+
+// UnlockCardPIN clears the lock and the failed attempts of a PIN, returning ErrNotFound if it is not locked
+func (m *MemoryStore) UnlockCardPIN(ctx context.Context, cardID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.cardPINs[cardID]
+	if !ok || record.LockedAt == nil {
+		return ErrNotFound
+	}
+
+	record.LockedAt = nil
+	record.FailedAttempts = 0
+	record.UpdatedAt = time.Now()
+	m.cardPINs[cardID] = record
+
+	return nil
+}
+
+// GetCardControls retrieves the spending controls of a card
+func (m *MemoryStore) GetCardControls(ctx context.Context, cardID string) (*models.CardControlsRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	controls, ok := m.cardControls[cardID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &controls, nil
+}
+
+// SaveCardControls creates or replaces the spending controls of a card
+func (m *MemoryStore) SaveCardControls(ctx context.Context, controls models.CardControlsRecord) (*models.CardControlsRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	controls.CreatedAt = now
+	if existing, ok := m.cardControls[controls.CardID]; ok {
+		controls.CreatedAt = existing.CreatedAt
+	}
+	controls.UpdatedAt = now
+	m.cardControls[controls.CardID] = controls
+
+	return &controls, nil
+}
+
+// DeleteCardControls removes the spending controls of a card, returning ErrNotFound if it has none
+func (m *MemoryStore) DeleteCardControls(ctx context.Context, cardID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.cardControls[cardID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.cardControls, cardID)
+
+	return nil
+}
+
+// RecordCardAuthorization stores an authorization and posts it to the ledger when approved.
+// A record without a status is decided here, a card that is no longer active is declined.
+// Prepaid cards pay from their balance and credit cards from their credit line, an approved authorization
+// the balance or the credit left cannot cover is declined.
+func (m *MemoryStore) RecordCardAuthorization(ctx context.Context, record models.CardAuthorizationRecord, decide func(spending models.CardSpending) string) (*models.CardAuthorizationRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var prepaidChange *models.PrepaidBalanceChangeRecord
+	var prepaidAccount models.PrepaidAccountRecord
+	var creditLine *models.CreditLineRecord
+	if record.Status == "" {
+		card, ok := m.cards[*record.CardID]
+		if !ok {
+			return nil, ErrNotFound
+		}
+
+		dayStart, monthStart := spendingPeriods(record.CreatedAt)
+		var spending models.CardSpending
+		for _, authorization := range m.authorizations {
+			if authorization.CardID == nil || *authorization.CardID != card.ID ||
+				authorization.Status != models.AuthorizationStatusApproved || authorization.CreatedAt.Before(monthStart) {
+				continue
+			}
+			spending.ThisMonth += authorization.Amount
+			if !authorization.CreatedAt.Before(dayStart) {
+				spending.Today += authorization.Amount
+			}
+		}
+
+		decideAuthorization(&record, card.Status, spending, decide)
+
+		if record.Status == models.AuthorizationStatusApproved && card.CardType == models.CardTypePrepaid {
+			change := newPrepaidChange(card.ID, models.PrepaidChangePurchase, record.Amount, record.Currency)
+			change.CreatedAt = record.CreatedAt
+			account, err := m.applyPrepaidChange(&change)
+			switch {
+			case errors.Is(err, ErrInsufficientFunds):
+				decline(&record, models.AuthorizationReasonInsufficientFunds)
+			case err != nil:
+				return nil, err
+			default:
+				prepaidChange, prepaidAccount = &change, account
+			}
+			balance := change.BalanceAfter
+			record.AvailableBalance = &balance
+		}
+
+		if record.Status == models.AuthorizationStatusApproved && card.CardType == models.CardTypeCredit {
+			line, ok := m.creditLines[card.ID]
+			if ok && line.Balance+record.Amount <= line.CreditLimit {
+				line.Balance += record.Amount
+				line.CyclePurchases += record.Amount
+				line.UpdatedAt = time.Now()
+				creditLine = &line
+			} else {
+				decline(&record, models.AuthorizationReasonCreditLimitExceeded)
+			}
+			if ok {
+				available := max(line.CreditLimit-line.Balance, 0)
+				record.AvailableBalance = &available
+			}
+		}
+	}
+
+	if record.Status == models.AuthorizationStatusApproved {
+		transaction := purchaseTransaction(record)
+		if err := checkBalanced(transaction); err != nil {
+			return nil, err
+		}
+		m.ledger = append(m.ledger, transaction)
+
+		if prepaidChange != nil {
+			prepaidChange.LedgerTransactionID = transaction.ID
+			m.prepaid[prepaidAccount.CardID] = prepaidAccount
+			m.prepaidChanges = append(m.prepaidChanges, *prepaidChange)
+		}
+		if creditLine != nil {
+			m.creditLines[creditLine.CardID] = *creditLine
+		}
+	}
+	m.authorizations = append(m.authorizations, record)
+
+	return &record, nil
+}
+
+// RefundCardAuthorization gives back part or all of an approved authorization, crediting the card.
+// The balance change is only returned for prepaid cards.
+func (m *MemoryStore) RefundCardAuthorization(ctx context.Context, authorizationID string, amount int64) (*models.LedgerTransactionRecord, *models.PrepaidBalanceChangeRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var authorization *models.CardAuthorizationRecord
+	for i := range m.authorizations {
+		if m.authorizations[i].ID == authorizationID {
+			authorization = &m.authorizations[i]
+			break
+		}
+	}
+	if authorization == nil {
+		return nil, nil, ErrNotFound
+	}
+	if authorization.Status != models.AuthorizationStatusApproved {
+		return nil, nil, ErrAuthorizationNotRefundable
+	}
+
+	var refunded int64
+	for _, transaction := range m.ledger {
+		if transaction.Type == models.LedgerTransactionRefund && transaction.AuthorizationID != nil && *transaction.AuthorizationID == authorizationID {
+			refunded += transaction.Amount
+		}
+	}
+	if refunded+amount > authorization.Amount {
+		return nil, nil, ErrRefundExceedsAuthorization
+	}
+
+	card, ok := m.cards[*authorization.CardID]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+
+	transaction := refundTransaction(*authorization, amount, time.Now().UTC())
+	if err := checkBalanced(transaction); err != nil {
+		return nil, nil, err
+	}
+	if card.CardType == models.CardTypeCredit {
+		if line, ok := m.creditLines[card.ID]; ok {
+			line.Balance -= amount
+			line.CycleRefunds += amount
+			line.UpdatedAt = time.Now()
+			m.creditLines[card.ID] = line
+		}
+	}
+	if card.CardType != models.CardTypePrepaid {
+		m.ledger = append(m.ledger, transaction)
+		return &transaction, nil, nil
+	}
+
+	change := newPrepaidChange(card.ID, models.PrepaidChangeRefund, amount, authorization.Currency)
+	change.CreatedAt = transaction.CreatedAt
+	change.LedgerTransactionID = transaction.ID
+	account, err := m.applyPrepaidChange(&change)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.prepaid[card.ID] = account
+	m.prepaidChanges = append(m.prepaidChanges, change)
+	m.ledger = append(m.ledger, transaction)
+
+	return &transaction, &change, nil
+}
+
+// GetPrepaidAccount retrieves the balance of a prepaid card
+func (m *MemoryStore) GetPrepaidAccount(ctx context.Context, cardID string) (*models.PrepaidAccountRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.prepaid[cardID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &account, nil
+}
+
+// ChangePrepaidBalance tops up or withdraws from a prepaid card and posts the change to the ledger
+func (m *MemoryStore) ChangePrepaidBalance(ctx context.Context, change models.PrepaidBalanceChangeRecord) (*models.PrepaidBalanceChangeRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	transaction := prepaidTransaction(change)
+	if err := checkBalanced(transaction); err != nil {
+		return nil, err
+	}
+	change.LedgerTransactionID = transaction.ID
+
+	account, err := m.applyPrepaidChange(&change)
+	if err != nil {
+		return nil, err
+	}
+	m.prepaid[change.CardID] = account
+	m.prepaidChanges = append(m.prepaidChanges, change)
+	m.ledger = append(m.ledger, transaction)
+
+	return &change, nil
+}
+
+// applyPrepaidChange returns the account of a card with a change applied, without storing either.
+// The mutex already serializes changes, so there is no version conflict to retry.
+func (m *MemoryStore) applyPrepaidChange(change *models.PrepaidBalanceChangeRecord) (models.PrepaidAccountRecord, error) {
+	account, ok := m.prepaid[change.CardID]
+	if !ok {
+		account = models.PrepaidAccountRecord{CardID: change.CardID, Currency: change.Currency, CreatedAt: time.Now().UTC()}
+	}
+
+	balance := account.Balance + prepaidDelta(*change)
+	if balance < 0 {
+		change.BalanceAfter = account.Balance
+		return account, ErrInsufficientFunds
+	}
+
+	account.Balance = balance
+	account.Version++
+	account.UpdatedAt = time.Now().UTC()
+	change.BalanceAfter = account.Balance
+	change.Version = account.Version
+
+	return account, nil
+}
+
+// GetPrepaidBalanceChanges retrieves a page of the balance history of a prepaid card
+func (m *MemoryStore) GetPrepaidBalanceChanges(ctx context.Context, cardID string, query models.HistoryQuery) (*models.PrepaidBalanceChangePage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changes := []models.PrepaidBalanceChangeRecord{}
+	for _, change := range m.prepaidChanges {
+		if change.CardID == cardID && matchesHistory(query, "", "", change.CreatedAt, change.ID) {
+			changes = append(changes, change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return historyLess(query, changes[i].CreatedAt, changes[i].ID, changes[j].CreatedAt, changes[j].ID)
+	})
+
+	page := &models.PrepaidBalanceChangePage{Changes: changes}
+	if len(changes) > query.Limit {
+		page.Changes = changes[:query.Limit]
+		last := page.Changes[len(page.Changes)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	return page, nil
+}
+
+// GetCardAuthorizations retrieves a page of the authorizations of a card
+func (m *MemoryStore) GetCardAuthorizations(ctx context.Context, cardID string, query models.HistoryQuery) (*models.CardAuthorizationPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	authorizations := []models.CardAuthorizationRecord{}
+	for _, authorization := range m.authorizations {
+		if authorization.CardID != nil && *authorization.CardID == cardID &&
+			matchesHistory(query, "", "", authorization.CreatedAt, authorization.ID) {
+			authorizations = append(authorizations, authorization)
+		}
+	}
+	sort.Slice(authorizations, func(i, j int) bool {
+		return historyLess(query, authorizations[i].CreatedAt, authorizations[i].ID, authorizations[j].CreatedAt, authorizations[j].ID)
+	})
+
+	page := &models.CardAuthorizationPage{Authorizations: authorizations}
+	if len(authorizations) > query.Limit {
+		page.Authorizations = authorizations[:query.Limit]
+		last := page.Authorizations[len(page.Authorizations)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	return page, nil
+}
+
+// GetCardBalance sums the ledger entries of a card in a currency
+func (m *MemoryStore) GetCardBalance(ctx context.Context, cardID, currency string) (*models.CardBalance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	balance := &models.CardBalance{
+		CardID:   cardID,
+		Account:  models.CardLedgerAccount(cardID),
+		Currency: currency,
+	}
+	for _, transaction := range m.ledger {
+		for _, entry := range transaction.Entries {
+			if entry.Account != balance.Account || entry.Currency != currency {
+				continue
+			}
+			if entry.Direction == models.LedgerDebit {
+				balance.Debits += entry.Amount
+			} else {
+				balance.Credits += entry.Amount
+			}
+		}
+	}
+	balance.Balance = balance.Credits - balance.Debits
+
+	return balance, nil
+}
+
+// GetLedgerTransactions retrieves a page of the ledger transactions of a card with their entries
+func (m *MemoryStore) GetLedgerTransactions(ctx context.Context, cardID string, query models.HistoryQuery) (*models.LedgerTransactionPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	transactions := []models.LedgerTransactionRecord{}
+	for _, transaction := range m.ledger {
+		if transaction.CardID == cardID && matchesHistory(query, "", "", transaction.CreatedAt, transaction.ID) {
+			transactions = append(transactions, transaction)
+		}
+	}
+	sort.Slice(transactions, func(i, j int) bool {
+		return historyLess(query, transactions[i].CreatedAt, transactions[i].ID, transactions[j].CreatedAt, transactions[j].ID)
+	})
+
+	page := &models.LedgerTransactionPage{Transactions: transactions}
+	if len(transactions) > query.Limit {
+		page.Transactions = transactions[:query.Limit]
+		last := page.Transactions[len(page.Transactions)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	return page, nil
+}
+
+// GetCreditLine retrieves the credit line of a credit card
+func (m *MemoryStore) GetCreditLine(ctx context.Context, cardID string) (*models.CreditLineRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	line, ok := m.creditLines[cardID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &line, nil
+}
+
+// GetDueCreditLines retrieves credit lines whose billing cycle closes before the given time, the oldest first
+func (m *MemoryStore) GetDueCreditLines(ctx context.Context, before time.Time, limit int) ([]models.CreditLineRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lines := []models.CreditLineRecord{}
+	for _, line := range m.creditLines {
+		if !line.NextStatementAt.After(before) {
+			lines = append(lines, line)
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].NextStatementAt.Before(lines[j].NextStatementAt)
+	})
+	if len(lines) > limit {
+		lines = lines[:limit]
+	}
+
+	return lines, nil
+}
+
+// CloseBillingCycle turns the billing cycle of a credit line into the statement build returns,
+// posting its interest and starting the next cycle
+func (m *MemoryStore) CloseBillingCycle(ctx context.Context, cardID string, closedAt time.Time, build func(line models.CreditLineRecord, previous *models.CreditStatementRecord) (models.CreditStatementRecord, time.Time)) (*models.CreditStatementRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	line, ok := m.creditLines[cardID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if line.NextStatementAt.After(closedAt) {
+		return nil, ErrBillingCycleNotDue
+	}
+
+	statement, nextStatementAt := build(line, m.latestStatement(cardID))
+	statement.UpdatedAt = statement.CreatedAt
+
+	if statement.Interest > 0 {
+		transaction := interestTransaction(statement)
+		if err := checkBalanced(transaction); err != nil {
+			return nil, err
+		}
+		m.ledger = append(m.ledger, transaction)
+	}
+	m.statements = append(m.statements, statement)
+
+	line.Balance = statement.ClosingBalance
+	line.CyclePurchases = 0
+	line.CycleRefunds = 0
+	line.CyclePayments = 0
+	line.CycleStart = statement.PeriodEnd
+	line.NextStatementAt = nextStatementAt
+	line.UpdatedAt = time.Now()
+	m.creditLines[cardID] = line
+
+	return &statement, nil
+}
+
+// GetCreditStatements retrieves a page of the statements of a credit card
+func (m *MemoryStore) GetCreditStatements(ctx context.Context, cardID string, query models.HistoryQuery) (*models.CreditStatementPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statements := []models.CreditStatementRecord{}
+	for _, statement := range m.statements {
+		if statement.CardID == cardID && matchesHistory(query, "", "", statement.CreatedAt, statement.ID) {
+			statements = append(statements, statement)
+		}
+	}
+	sort.Slice(statements, func(i, j int) bool {
+		return historyLess(query, statements[i].CreatedAt, statements[i].ID, statements[j].CreatedAt, statements[j].ID)
+	})
+
+	page := &models.CreditStatementPage{Statements: statements}
+	if len(statements) > query.Limit {
+		page.Statements = statements[:query.Limit]
+		last := page.Statements[len(page.Statements)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	return page, nil
+}
+
+// GetCreditStatement retrieves a statement by its ID
+func (m *MemoryStore) GetCreditStatement(ctx context.Context, statementID string) (*models.CreditStatementRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, statement := range m.statements {
+		if statement.ID == statementID {
+			return &statement, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// PayCreditStatement pays an amount against the latest statement of a credit card and posts it to the ledger
+func (m *MemoryStore) PayCreditStatement(ctx context.Context, statementID string, amount int64) (*models.CreditStatementRecord, *models.LedgerTransactionRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index := -1
+	for i, statement := range m.statements {
+		if statement.ID == statementID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, nil, ErrNotFound
+	}
+
+	statement := m.statements[index]
+	line, ok := m.creditLines[statement.CardID]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	if latest := m.latestStatement(statement.CardID); latest.ID != statement.ID {
+		return nil, nil, ErrStatementNotPayable
+	}
+	if amount > line.Balance {
+		return nil, nil, ErrPaymentExceedsBalance
+	}
+
+	now := time.Now().UTC()
+	transaction := paymentTransaction(statement, amount, now)
+	if err := checkBalanced(transaction); err != nil {
+		return nil, nil, err
+	}
+
+	line.Balance -= amount
+	line.CyclePayments += amount
+	line.UpdatedAt = now
+	m.creditLines[line.CardID] = line
+
+	statement.PaidAmount += amount
+	statement.Status = statementStatus(statement)
+	statement.UpdatedAt = now
+	m.statements[index] = statement
+	m.ledger = append(m.ledger, transaction)
+
+	return &statement, &transaction, nil
+}
+
+// latestStatement returns the statement of a card with the latest period, nil when it has none
+func (m *MemoryStore) latestStatement(cardID string) *models.CreditStatementRecord {
+	var latest *models.CreditStatementRecord
+	for i := range m.statements {
+		statement := m.statements[i]
+		if statement.CardID == cardID && (latest == nil || statement.PeriodEnd.After(latest.PeriodEnd)) {
+			latest = &statement
+		}
+	}
+	return latest
+}
+
+// AppendAuditEvent chains an event to the last one in the audit log and stores it
+func (m *MemoryStore) AppendAuditEvent(ctx context.Context, event models.AuditEventRecord) (*models.AuditEventRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var prev *models.AuditEventRecord
+	if len(m.auditEvents) > 0 {
+		prev = &m.auditEvents[len(m.auditEvents)-1]
+	}
+
+	event = chainAuditEvent(prev, event)
+	m.auditEvents = append(m.auditEvents, event)
+
+	return &event, nil
+}
+
+// QueryAuditEvents retrieves a page of the audit events matching the query
+func (m *MemoryStore) QueryAuditEvents(ctx context.Context, query models.AuditEventQuery) (*models.AuditEventPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []models.AuditEventRecord
+	for i := range m.auditEvents {
+		// Events are kept oldest first, newest first pages walk them backwards
+		event := m.auditEvents[i]
+		if !query.Ascending {
+			event = m.auditEvents[len(m.auditEvents)-1-i]
+		}
+
+		if query.AfterSequence > 0 && (query.Ascending && event.Sequence <= query.AfterSequence ||
+			!query.Ascending && event.Sequence >= query.AfterSequence) {
+			continue
+		}
+		if query.Actor != "" && event.Actor != query.Actor ||
+			query.Action != "" && event.Action != query.Action ||
+			query.SubjectType != "" && event.SubjectType != query.SubjectType ||
+			query.SubjectID != "" && event.SubjectID != query.SubjectID ||
+			query.RequestID != "" && event.RequestID != query.RequestID {
+			continue
+		}
+		if query.CreatedFrom != nil && event.CreatedAt.Before(*query.CreatedFrom) ||
+			query.CreatedTo != nil && !event.CreatedAt.Before(*query.CreatedTo) {
+			continue
+		}
+
+		events = append(events, event)
+		if len(events) > query.Limit {
+			break
+		}
+	}
+
+	return auditEventPage(events, query.Limit), nil
+}
+
+// GetAuditEventsAfter retrieves the events following a sequence number in chain order
+func (m *MemoryStore) GetAuditEventsAfter(ctx context.Context, sequence int64, limit int) ([]models.AuditEventRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []models.AuditEventRecord
+	for _, event := range m.auditEvents {
+		if event.Sequence <= sequence {
+			continue
+		}
+		events = append(events, event)
+		if len(events) == limit {
+			break
+		}
+	}
+
+	return events, nil
+}
+
+// CreateCardRequest stores a card request together with the outbox message that submits it
+func (m *MemoryStore) CreateCardRequest(ctx context.Context, request models.CardRequestRecord, message models.OutboxMessageRecord, admit func() error) error {
+	m.admitMu.Lock()
+	defer m.admitMu.Unlock()
+
+	if admit != nil {
+		if err := admit(); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.requests[request.RequestUUID]; exists {
+		return fmt.Errorf("card request %s already exists", request.RequestUUID)
+	}
+	for _, existing := range m.requests {
+		if existing.UserToken == request.UserToken && existing.CardType == request.CardType && existing.IsPending() {
+			return ErrPendingCardRequest
+		}
+	}
+
+	now := time.Now()
+	request.CreatedAt = now
+	request.UpdatedAt = now
+	m.requests[request.RequestUUID] = request
+
+	message.CreatedAt = now
+	message.UpdatedAt = now
+	m.outbox[message.ID] = message
+
+	return nil
+}
+
+// GetCardRequest retrieves a card request by its UUID
+func (m *MemoryStore) GetCardRequest(ctx context.Context, requestUUID string) (*models.CardRequestRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	request, ok := m.requests[requestUUID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &request, nil
+}
+
+// GetOverdueCardRequests retrieves pending requests last submitted before the given time
+func (m *MemoryStore) GetOverdueCardRequests(ctx context.Context, submittedBefore time.Time, limit int) ([]models.CardRequestRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var requests []models.CardRequestRecord
+	for _, request := range m.requests {
+		submittedAt := request.CreatedAt
+		if request.ResubmittedAt != nil {
+			submittedAt = *request.ResubmittedAt
+		}
+		if request.IsPending() && submittedAt.Before(submittedBefore) {
+			requests = append(requests, request)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].CreatedAt.Before(requests[j].CreatedAt) })
+
+	if len(requests) > limit {
+		requests = requests[:limit]
+	}
+	return requests, nil
+}
+
+// HasPendingReplacement reports whether a request to replace or renew a card is still waiting for the issuer
+func (m *MemoryStore) HasPendingReplacement(ctx context.Context, cardID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, request := range m.requests {
+		if request.ReplacesCardID != nil && *request.ReplacesCardID == cardID && request.IsPending() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CountPendingCardRequests counts the requests of a user still waiting for the issuer,
+// of any card type when cardType is empty
+func (m *MemoryStore) CountPendingCardRequests(ctx context.Context, userToken, cardType string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for _, request := range m.requests {
+		if request.UserToken == userToken && request.IsPending() && (cardType == "" || request.CardType == cardType) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetLastDeclinedCardRequest retrieves the most recently declined request of a user for a card type
+func (m *MemoryStore) GetLastDeclinedCardRequest(ctx context.Context, userToken, cardType string) (*models.CardRequestRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var last *models.CardRequestRecord
+	for _, request := range m.requests {
+		if request.UserToken != userToken || request.CardType != cardType || request.Status != models.CardRequestStatusDeclined || request.DeclinedAt == nil {
+			continue
+		}
+		if last == nil || request.DeclinedAt.After(*last.DeclinedAt) {
+			last = &request
+		}
+	}
+
+	if last == nil {
+		return nil, ErrNotFound
+	}
+	return last, nil
+}
+
+// GetCardRequestsByUserToken retrieves every request of a user, oldest first
+func (m *MemoryStore) GetCardRequestsByUserToken(ctx context.Context, userToken string) ([]models.CardRequestRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var requests []models.CardRequestRecord
+	for _, request := range m.requests {
+		if request.UserToken == userToken {
+			requests = append(requests, request)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].CreatedAt.Before(requests[j].CreatedAt) })
+
+	return requests, nil
+}
+
+// ResubmitCardRequest queues a pending request again with a copy of its last outbox message
+func (m *MemoryStore) ResubmitCardRequest(ctx context.Context, requestUUID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var last *models.OutboxMessageRecord
+	for _, message := range m.outbox {
+		if message.AggregateID == requestUUID && message.Topic == models.OutboxTopicIssueRequest {
+			if last == nil || message.CreatedAt.After(last.CreatedAt) {
+				message := message
+				last = &message
+			}
+		}
+	}
+	if last == nil {
+		return ErrNotFound
+	}
+
+	request, ok := m.requests[requestUUID]
+	if !ok || !request.IsPending() {
+		return ErrCardRequestNotPending
+	}
+
+	now := time.Now()
+	request.Status = models.CardRequestStatusSubmitted
+	request.Resubmits++
+	request.ResubmittedAt = &now
+	request.UpdatedAt = now
+	m.requests[requestUUID] = request
+
+	m.cancelOutboxMessages(requestUUID)
+
+	message := models.OutboxMessageRecord{
+		ID:            uuid.New().String(),
+		AggregateID:   requestUUID,
+		Topic:         last.Topic,
+		Payload:       last.Payload,
+		Status:        models.OutboxStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	m.outbox[message.ID] = message
+
+	return nil
+}
+
+// ExpireCardRequest marks a pending request as expired and stores the failed attempt for it
+func (m *MemoryStore) ExpireCardRequest(ctx context.Context, requestUUID string, record models.FailedAttemptRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	request, ok := m.requests[requestUUID]
+	if !ok || !request.IsPending() {
+		return ErrCardRequestNotPending
+	}
+
+	now := time.Now()
+	request.Status = models.CardRequestStatusExpired
+	request.DeclineReason = record.DeclineReason
+	request.ExpiredAt = &now
+	request.UpdatedAt = now
+	m.requests[requestUUID] = request
+
+	m.cancelOutboxMessages(requestUUID)
+
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	m.failedAttempts = append(m.failedAttempts, record)
+
+	return nil
+}
+
+// ProcessNextOutboxMessage delivers the next due outbox message, returning false if there was none.
+// The store is not locked during delivery, the message is skipped by other callers meanwhile.
+func (m *MemoryStore) ProcessNextOutboxMessage(
+	ctx context.Context,
+	deliver func(context.Context, models.OutboxMessageRecord) error,
+	backoff func(attempts int) time.Duration,
+	maxAttempts int,
+) (bool, error) {
+	m.mu.Lock()
+	var next *models.OutboxMessageRecord
+	now := time.Now()
+	for _, message := range m.outbox {
+		if message.Status != models.OutboxStatusPending || message.NextAttemptAt.After(now) || m.outboxInFlight[message.ID] {
+			continue
+		}
+		if next == nil || message.NextAttemptAt.Before(next.NextAttemptAt) {
+			message := message
+			next = &message
+		}
+	}
+	if next == nil {
+		m.mu.Unlock()
+		return false, nil
+	}
+	m.outboxInFlight[next.ID] = true
+	m.mu.Unlock()
+
+	message := *next
+	message.Attempts++
+	deliverErr := deliver(ctx, message)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.outboxInFlight, message.ID)
+
+	stored, ok := m.outbox[message.ID]
+	if !ok {
+		return true, nil
+	}
+	stored.Attempts = message.Attempts
+	stored.UpdatedAt = time.Now()
+
+	if deliverErr != nil {
+		stored.LastError = deliverErr.Error()
+		if stored.Attempts >= maxAttempts {
+			stored.Status = models.OutboxStatusFailed
+		} else {
+			stored.NextAttemptAt = time.Now().Add(backoff(stored.Attempts))
+		}
+		m.outbox[stored.ID] = stored
+		return true, nil
+	}
+
+	sentAt := time.Now()
+	stored.Status = models.OutboxStatusSent
+	stored.SentAt = &sentAt
+	stored.LastError = ""
+	m.outbox[stored.ID] = stored
+
+	if stored.Topic == models.OutboxTopicIssueRequest {
+		if request, ok := m.requests[stored.AggregateID]; ok && request.IsPending() {
+			request.Status = models.CardRequestStatusForwarded
+			request.ForwardedAt = &sentAt
+			request.UpdatedAt = sentAt
+			m.requests[request.RequestUUID] = request
+		}
+	}
+
+	return true, nil
+}
+
+// ClaimIdempotencyKey reserves an idempotency key for a request.
+// It returns the existing record and false if the key was already used and is still valid.
+func (m *MemoryStore) ClaimIdempotencyKey(ctx context.Context, scope, key, requestHash string, lockTimeout, ttl time.Duration) (*models.IdempotencyKeyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	mapKey := scope + "\x00" + key
+
+	existing, exists := m.idempotencyKeys[mapKey]
+	stale := exists &&
+		((existing.Status == models.IdempotencyStatusInProgress && existing.UpdatedAt.Before(now.Add(-lockTimeout))) ||
+			existing.CreatedAt.Before(now.Add(-ttl)))
+	if exists && !stale {
+		return &existing, false, nil
+	}
+
+	record := models.IdempotencyKeyRecord{
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+		Status:      models.IdempotencyStatusInProgress,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	m.idempotencyKeys[mapKey] = record
+
+	return &record, true, nil
+}
+
+// CompleteIdempotencyKey stores the response sent for an idempotency key
+func (m *MemoryStore) CompleteIdempotencyKey(ctx context.Context, scope, key string, statusCode int, contentType, responseBody string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mapKey := scope + "\x00" + key
+	record, ok := m.idempotencyKeys[mapKey]
+	if !ok {
+		return ErrNotFound
+	}
+
+	record.Status = models.IdempotencyStatusCompleted
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.ResponseBody = responseBody
+	record.UpdatedAt = time.Now()
+	m.idempotencyKeys[mapKey] = record
+
+	return nil
+}
+
+// ReleaseIdempotencyKey removes a key so the request can be retried
+func (m *MemoryStore) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.idempotencyKeys, scope+"\x00"+key)
+	return nil
+}
+
+// completeCardRequest records the outcome of a request, requests unknown to the store are accepted as is
+func (m *MemoryStore) completeCardRequest(requestUUID, status string, update func(request *models.CardRequestRecord)) error {
+	request, ok := m.requests[requestUUID]
+	if !ok {
+		return nil
+	}
+	if !request.IsPending() {
+		return ErrCardRequestNotPending
+	}
+
+	request.Status = status
+	request.UpdatedAt = time.Now()
+	update(&request)
+	m.requests[requestUUID] = request
+
+	return nil
+}
+
+// cancelOutboxMessages stops the delivery of messages still pending for a request
+func (m *MemoryStore) cancelOutboxMessages(requestUUID string) {
+	for id, message := range m.outbox {
+		if message.AggregateID == requestUUID && message.Status == models.OutboxStatusPending {
+			message.Status = models.OutboxStatusFailed
+			message.LastError = "cancelled"
+			message.UpdatedAt = time.Now()
+			m.outbox[id] = message
+		}
+	}
+}
+
+func (m *MemorySessionStore) StoreUser(ctx context.Context, token string, user models.User, ttl time.Duration) error {
+	m.setSession("user:"+token, user, ttl)
+	return nil
+}
+
+func (m *MemorySessionStore) GetUser(ctx context.Context, token string) (*models.User, error) {
+	value, ok := m.getSession("user:" + token)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	user := value.(models.User)
+	return &user, nil
+}
+
+func (m *MemorySessionStore) DeleteUser(ctx context.Context, token string) error {
+	m.deleteSession("user:" + token)
+	return nil
+}
+
+func (m *MemorySessionStore) StoreRequest(ctx context.Context, uuid string, data models.RequestData) error {
+	m.setSession("request:"+uuid, data, 24*time.Hour)
+	return nil
+}
+
+func (m *MemorySessionStore) GetRequest(ctx context.Context, uuid string) (*models.RequestData, error) {
+	value, ok := m.getSession("request:" + uuid)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	data := value.(models.RequestData)
+	return &data, nil
+}
+
+func (m *MemorySessionStore) DeleteRequest(ctx context.Context, uuid string) error {
+	m.deleteSession("request:" + uuid)
+	return nil
+}
+
+func (m *MemorySessionStore) StoreRevealChallenge(ctx context.Context, cardID string, challenge models.RevealChallenge, ttl time.Duration) error {
+	m.setSession("reveal:"+cardID, challenge, ttl)
+	return nil
+}
+
+func (m *MemorySessionStore) GetRevealChallenge(ctx context.Context, cardID string) (*models.RevealChallenge, error) {
+	value, ok := m.getSession("reveal:" + cardID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	challenge := value.(models.RevealChallenge)
+	return &challenge, nil
+}
+
+// IncrementRevealAttempts counts a guess of the one-time code of a card, returning the guesses made in the window
+func (m *MemorySessionStore) IncrementRevealAttempts(ctx context.Context, cardID string, window time.Duration) (int64, error) {
+	return m.increment("reveal_attempts:"+cardID, window), nil
+}
+
+func (m *MemorySessionStore) ResetRevealAttempts(ctx context.Context, cardID string) error {
+	m.deleteSession("reveal_attempts:" + cardID)
+	return nil
+}
+
+// IncrementRevealChallenges counts a code sent for a card, returning the codes sent in the window
+func (m *MemorySessionStore) IncrementRevealChallenges(ctx context.Context, cardID string, window time.Duration) (int64, error) {
+	return m.increment("reveal_challenges:"+cardID, window), nil
+}
+
+func (m *MemorySessionStore) DeleteRevealChallenge(ctx context.Context, cardID string) error {
+	m.deleteSession("reveal:" + cardID)
+	return nil
+}
+
+// setSession stores a value, a zero ttl keeps it until deleted
+func (m *MemorySessionStore) setSession(key string, value interface{}, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session := memorySession{value: value}
+	if ttl > 0 {
+		session.expiresAt = time.Now().Add(ttl)
+	}
+	m.sessions[key] = session
+}
+
+func (m *MemorySessionStore) getSession(key string) (interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[key]
+	if !ok {
+		return nil, false
+	}
+	if !session.expiresAt.IsZero() && time.Now().After(session.expiresAt) {
+		delete(m.sessions, key)
+		return nil, false
+	}
+
+	return session.value, true
+}
+
+// increment adds one to a counter, the window starts with the first increment
+func (m *MemorySessionStore) increment(key string, window time.Duration) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[key]
+	if !ok || time.Now().After(session.expiresAt) {
+		session = memorySession{value: int64(0), expiresAt: time.Now().Add(window)}
+	}
+	count := session.value.(int64) + 1
+	session.value = count
+	m.sessions[key] = session
+
+	return count
+}
+
+func (m *MemorySessionStore) deleteSession(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, key)
+}
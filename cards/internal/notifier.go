@@ -0,0 +1,139 @@
+﻿package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"cards/models"
+)
+
+// ErrNotificationsNotConfigured is returned when NOTIFICATIONS_URL is not set
+var ErrNotificationsNotConfigured = errors.New("NOTIFICATIONS_URL not configured")
+
+// ErrNotificationHistoryNotConfigured is returned when NOTIFICATIONS_HISTORY_URL is not set
+var ErrNotificationHistoryNotConfigured = errors.New("NOTIFICATIONS_HISTORY_URL not configured")
+
+const defaultNotificationsTimeout = 5 * time.Second
+
+// Notifier sends notifications to users through the notifications service
+type Notifier struct {
+	notificationsURL string
+	historyURL       string
+	client           *http.Client
+}
+
+func NewNotifier() *Notifier {
+	timeout := defaultNotificationsTimeout
+	if value, err := time.ParseDuration(os.Getenv("NOTIFICATIONS_TIMEOUT")); err == nil && value > 0 {
+		timeout = value
+	}
+
+	return &Notifier{
+		notificationsURL: os.Getenv("NOTIFICATIONS_URL"),
+		historyURL:       os.Getenv("NOTIFICATIONS_HISTORY_URL"),
+		client:           &http.Client{Timeout: timeout},
+	}
+}
+
+// NotifyIssuerResponse sends the result of an issue request to the user
+func (n *Notifier) NotifyIssuerResponse(ctx context.Context, userToken string, response models.IssuerResponse) error {
+	return n.send(ctx, models.NotificationRequest{
+		UserToken:      userToken,
+		IssuerResponse: &response,
+	})
+}
+
+// NotifyEvent sends any other event to the user
+func (n *Notifier) NotifyEvent(ctx context.Context, userToken string, event models.NotificationEvent) error {
+	return n.send(ctx, models.NotificationRequest{
+		UserToken: userToken,
+		Event:     &event,
+	})
+}
+
+// GetHistory retrieves the notifications sent to the user
+func (n *Notifier) GetHistory(ctx context.Context, userToken string) ([]models.NotificationHistoryEntry, error) {
+	resp, err := n.historyRequest(ctx, http.MethodGet, userToken)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var history struct {
+		Notifications []models.NotificationHistoryEntry `json:"notifications"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return nil, err
+	}
+
+	return history.Notifications, nil
+}
+
+// DeleteHistory makes the notifications service forget the notifications sent to the user
+func (n *Notifier) DeleteHistory(ctx context.Context, userToken string) error {
+	resp, err := n.historyRequest(ctx, http.MethodDelete, userToken)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (n *Notifier) historyRequest(ctx context.Context, method, userToken string) (*http.Response, error) {
+	if n.historyURL == "" {
+		return nil, ErrNotificationHistoryNotConfigured
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, n.historyURL+"?user_token="+url.QueryEscape(userToken), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("notifications service returned status %d", resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+func (n *Notifier) send(ctx context.Context, notification models.NotificationRequest) error {
+	if n.notificationsURL == "" {
+		return ErrNotificationsNotConfigured
+	}
+
+	notificationJSON, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.notificationsURL, bytes.NewBuffer(notificationJSON))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notifications service returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
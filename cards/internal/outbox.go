@@ -0,0 +1,147 @@
+﻿package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"cards/models"
+)
+
+const (
+	defaultOutboxPollInterval = 2 * time.Second
+	defaultOutboxMaxAttempts  = 10
+	defaultOutboxTimeout      = 10 * time.Second
+	outboxMaxBackoff          = 5 * time.Minute
+)
+
+// OutboxDispatcher delivers pending outbox messages with retries and backoff
+type OutboxDispatcher struct {
+	requestStore RequestStore
+	auditor      *Auditor
+	client       *http.Client
+	webhookURL   string
+	pollInterval time.Duration
+	maxAttempts  int
+}
+
+func NewOutboxDispatcher(requestStore RequestStore, auditor *Auditor) *OutboxDispatcher {
+	pollInterval := defaultOutboxPollInterval
+	if value, err := time.ParseDuration(os.Getenv("OUTBOX_POLL_INTERVAL")); err == nil && value > 0 {
+		pollInterval = value
+	}
+
+	maxAttempts := defaultOutboxMaxAttempts
+	if value, err := strconv.Atoi(os.Getenv("OUTBOX_MAX_ATTEMPTS")); err == nil && value > 0 {
+		maxAttempts = value
+	}
+
+	timeout := defaultOutboxTimeout
+	if value, err := time.ParseDuration(os.Getenv("OUTBOX_TIMEOUT")); err == nil && value > 0 {
+		timeout = value
+	}
+
+	return &OutboxDispatcher{
+		requestStore: requestStore,
+		auditor:      auditor,
+		client:       &http.Client{Timeout: timeout},
+		webhookURL:   os.Getenv("WEBHOOK_URL"),
+		pollInterval: pollInterval,
+		maxAttempts:  maxAttempts,
+	}
+}
+
+// Run delivers due messages every poll interval until the context is cancelled
+func (d *OutboxDispatcher) Run(ctx context.Context) {
+	if d.webhookURL == "" {
+		log.Println("WEBHOOK_URL not configured, issue requests will stay in the outbox")
+	}
+
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.dispatchDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchDue delivers messages until none is due
+func (d *OutboxDispatcher) dispatchDue(ctx context.Context) {
+	for {
+		processed, err := d.requestStore.ProcessNextOutboxMessage(ctx, d.deliver, outboxBackoff, d.maxAttempts)
+		if err != nil {
+			log.Printf("Failed to process outbox message: %v", err)
+			return
+		}
+		if !processed {
+			return
+		}
+	}
+}
+
+func (d *OutboxDispatcher) deliver(ctx context.Context, message models.OutboxMessageRecord) error {
+	var url string
+	switch message.Topic {
+	case models.OutboxTopicIssueRequest:
+		url = d.webhookURL
+	default:
+		return fmt.Errorf("unknown outbox topic %s", message.Topic)
+	}
+
+	if url == "" {
+		return fmt.Errorf("no destination configured for topic %s", message.Topic)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBufferString(message.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		log.Printf("Failed to deliver outbox message %s (attempt %d): %v", message.ID, message.Attempts, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("Outbox message %s delivery returned status %d (attempt %d)", message.ID, resp.StatusCode, message.Attempts)
+		return fmt.Errorf("destination returned status %d", resp.StatusCode)
+	}
+
+	log.Printf("Outbox message %s delivered for %s", message.ID, message.AggregateID)
+
+	// Issue requests are marked as forwarded once delivered
+	err = d.auditor.Record(ctx, AuditEvent{
+		Actor:       models.AuditActorOutbox,
+		Action:      models.AuditActionCardRequestForwarded,
+		SubjectType: models.AuditSubjectCardRequest,
+		SubjectID:   message.AggregateID,
+		After:       map[string]interface{}{"outbox_message_id": message.ID, "attempts": message.Attempts},
+	})
+	if err != nil {
+		log.Printf("Failed to record audit event for outbox message %s: %v", message.ID, err)
+	}
+	return nil
+}
+
+// outboxBackoff doubles the delay after every failed attempt, up to a maximum
+func outboxBackoff(attempts int) time.Duration {
+	delay := time.Second << uint(attempts-1)
+	if delay <= 0 || delay > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return delay
+}
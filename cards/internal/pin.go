@@ -0,0 +1,48 @@
+﻿package internal
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const defaultPINHashCost = 12
+
+// ErrCardPINAlreadySet is returned when a PIN is set on a card that already has one
+var ErrCardPINAlreadySet = errors.New("card PIN already set")
+
+// ErrCardPINLocked is returned when a PIN is used after too many failed verifications
+var ErrCardPINLocked = errors.New("card PIN locked")
+
+// PINHasher hashes card PINs with bcrypt. The card ID is part of the hashed value,
+// so a hash copied to another card does not verify.
+type PINHasher struct {
+	cost int
+}
+
+func NewPINHasher() *PINHasher {
+	cost := defaultPINHashCost
+	if value, err := strconv.Atoi(os.Getenv("PIN_HASH_COST")); err == nil && value >= bcrypt.MinCost && value <= bcrypt.MaxCost {
+		cost = value
+	}
+
+	return &PINHasher{
+		cost: cost,
+	}
+}
+
+// Hash returns the salted bcrypt hash of the PIN of a card
+func (h *PINHasher) Hash(cardID, pin string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(cardID+":"+pin), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Matches reports whether the PIN is the one hashed for the card
+func (h *PINHasher) Matches(pinHash, cardID, pin string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(pinHash), []byte(cardID+":"+pin)) == nil
+}
@@ -0,0 +1,153 @@
+﻿package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"cards/models"
+)
+
+const (
+	defaultMaxActiveCardsPerType = 1
+	defaultMaxTotalCards         = 3
+	defaultDeclineCooldown       = time.Hour
+)
+
+// Issuance policy rules
+const (
+	PolicyRulePendingRequest   = "pending_request"
+	PolicyRuleMaxActivePerType = "max_active_cards_per_type"
+	PolicyRuleMaxTotalCards    = "max_total_cards"
+	PolicyRuleDeclineCooldown  = "decline_cooldown"
+)
+
+// heldCardStatuses are the statuses of cards a citizen still holds, lost and stolen cards
+// count until their replacement is issued
+var heldCardStatuses = []string{models.CardStatusActive, models.CardStatusBlocked, models.CardStatusLost, models.CardStatusStolen}
+
+// PolicyViolation describes the issuance rule a request broke
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Limit   int    `json:"limit,omitempty"`
+	// Time left until the rule stops applying, only set for time based rules
+	RetryAfter time.Duration `json:"-"`
+}
+
+// Error lets a violation refuse a request from inside the store transaction
+func (v *PolicyViolation) Error() string {
+	return v.Rule + ": " + v.Message
+}
+
+// PendingRequestViolation is the violation of a request made while one of the same card type is pending
+func PendingRequestViolation(cardType string) *PolicyViolation {
+	return &PolicyViolation{
+		Rule:    PolicyRulePendingRequest,
+		Message: fmt.Sprintf("A %s card request is still waiting for the issuer", cardType),
+	}
+}
+
+// IssuancePolicy limits the cards a citizen can request. A limit of 0 disables its rule.
+// A single pending request per card type is always enforced, the database does not allow more.
+type IssuancePolicy struct {
+	cardStore             CardStore
+	requestStore          RequestStore
+	maxActiveCardsPerType int
+	maxTotalCards         int
+	declineCooldown       time.Duration
+}
+
+func NewIssuancePolicy(cardStore CardStore, requestStore RequestStore) *IssuancePolicy {
+	maxActiveCardsPerType := defaultMaxActiveCardsPerType
+	if value, err := strconv.Atoi(os.Getenv("ISSUE_MAX_ACTIVE_CARDS_PER_TYPE")); err == nil && value >= 0 {
+		maxActiveCardsPerType = value
+	}
+
+	maxTotalCards := defaultMaxTotalCards
+	if value, err := strconv.Atoi(os.Getenv("ISSUE_MAX_TOTAL_CARDS")); err == nil && value >= 0 {
+		maxTotalCards = value
+	}
+
+	declineCooldown := defaultDeclineCooldown
+	if value, err := time.ParseDuration(os.Getenv("ISSUE_DECLINE_COOLDOWN")); err == nil && value >= 0 {
+		declineCooldown = value
+	}
+
+	return &IssuancePolicy{
+		cardStore:             cardStore,
+		requestStore:          requestStore,
+		maxActiveCardsPerType: maxActiveCardsPerType,
+		maxTotalCards:         maxTotalCards,
+		declineCooldown:       declineCooldown,
+	}
+}
+
+// Evaluate checks a new request of the card type against every rule,
+// returning the first one it breaks or nil when it can be submitted.
+// A replacement takes the place of a lost or stolen card, which is not counted among the cards held.
+func (p *IssuancePolicy) Evaluate(ctx context.Context, userToken, cardType string, replacement bool) (*PolicyViolation, error) {
+	pendingOfType, err := p.requestStore.CountPendingCardRequests(ctx, userToken, cardType)
+	if err != nil {
+		return nil, err
+	}
+	if pendingOfType > 0 {
+		return PendingRequestViolation(cardType), nil
+	}
+
+	if p.maxActiveCardsPerType > 0 {
+		activeOfType, err := p.cardStore.CountCardsByUserToken(ctx, userToken, cardType, []string{models.CardStatusActive, models.CardStatusBlocked})
+		if err != nil {
+			return nil, err
+		}
+		if activeOfType >= int64(p.maxActiveCardsPerType) {
+			return &PolicyViolation{
+				Rule:    PolicyRuleMaxActivePerType,
+				Message: fmt.Sprintf("At most %d active %s cards are allowed", p.maxActiveCardsPerType, cardType),
+				Limit:   p.maxActiveCardsPerType,
+			}, nil
+		}
+	}
+
+	if p.maxTotalCards > 0 {
+		held, err := p.cardStore.CountCardsByUserToken(ctx, userToken, "", heldCardStatuses)
+		if err != nil {
+			return nil, err
+		}
+		pending, err := p.requestStore.CountPendingCardRequests(ctx, userToken, "")
+		if err != nil {
+			return nil, err
+		}
+		if replacement {
+			held--
+		}
+		if held+pending >= int64(p.maxTotalCards) {
+			return &PolicyViolation{
+				Rule:    PolicyRuleMaxTotalCards,
+				Message: fmt.Sprintf("At most %d cards are allowed", p.maxTotalCards),
+				Limit:   p.maxTotalCards,
+			}, nil
+		}
+	}
+
+	if p.declineCooldown > 0 {
+		declined, err := p.requestStore.GetLastDeclinedCardRequest(ctx, userToken, cardType)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		if declined != nil && declined.DeclinedAt != nil {
+			if remaining := time.Until(declined.DeclinedAt.Add(p.declineCooldown)); remaining > 0 {
+				return &PolicyViolation{
+					Rule:       PolicyRuleDeclineCooldown,
+					Message:    fmt.Sprintf("A %s card request was declined, try again in %s", cardType, remaining.Round(time.Second)),
+					RetryAfter: remaining,
+				}, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
@@ -1,51 +1,87 @@
 ﻿package internal
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"cards/models"
 
 	"github.com/google/uuid"
-	"gorm.io/driver/postgres"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	"gorm.io/gorm/clause"
 )
 
+// ErrCardStatusConflict is returned when a card is no longer in the status a change expected
+var ErrCardStatusConflict = errors.New("card status changed concurrently")
+
+// ErrCardRequestNotPending is returned when a card request already has an outcome
+var ErrCardRequestNotPending = errors.New("card request is not pending")
+
+// ErrPendingCardRequest is returned when the user already has a pending request of the card type
+var ErrPendingCardRequest = errors.New("card request of this type already pending")
+
+// ErrUserErased is returned when the personal data of a user was already erased
+var ErrUserErased = errors.New("user already erased")
+
+// pgUniqueViolation is the PostgreSQL error code of a unique constraint violation
+const pgUniqueViolation = "23505"
+
+// erasedBirthDate replaces the birth date of erased users, the column cannot be empty
+const erasedBirthDate = "1900-01-01"
+
+// erasedUserToken replaces the token and citizen ID of an erased user, both must stay unique
+func erasedUserToken(userID string) string {
+	return "erased:" + userID
+}
+
+// likeEscaper escapes the wildcards of user input used in a LIKE pattern
+var likeEscaper = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+
 type PostgresService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	cipher *CardCipher
 }
 
 func NewPostgresService() *PostgresService {
-	postgresURL := os.Getenv("POSTGRES_URL")
-	if postgresURL == "" {
-		panic("POSTGRES_URL environment variable is required")
+	db := openDatabase()
+	migrator := newMigrator(db)
+
+	// Replicas started with MIGRATE_ON_START apply pending migrations under the advisory lock
+	if os.Getenv("MIGRATE_ON_START") == "true" {
+		if _, err := migrator.Up(); err != nil {
+			panic("Failed to migrate database: " + err.Error())
+		}
 	}
 
-	db, err := gorm.Open(postgres.Open(postgresURL), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	})
+	if err := migrator.CheckVersion(); err != nil {
+		panic("Unexpected database schema: " + err.Error())
+	}
+
+	// Load the master key that wraps the card data keys
+	masterKey, err := LoadMasterKey(os.Getenv("MASTER_KEY_FILE"))
 	if err != nil {
-		panic("Failed to connect to PostgreSQL: " + err.Error())
+		panic("Failed to load master key: " + err.Error())
 	}
 
-	// Auto-migrate the schema
-	err = db.AutoMigrate(
-		&models.UserRecord{},
-		&models.IssuedCardRecord{},
-		&models.FailedAttemptRecord{},
-	)
+	cardCipher, err := NewCardCipher(db, masterKey)
 	if err != nil {
-		panic("Failed to migrate database: " + err.Error())
+		panic("Failed to load data keys: " + err.Error())
 	}
 
 	return &PostgresService{
-		db: db,
+		db:     db,
+		cipher: cardCipher,
 	}
 }
 
 // StoreUser stores a user in the database
-func (p *PostgresService) StoreUser(userToken string, user models.User) (*models.UserRecord, error) {
+func (p *PostgresService) StoreUser(ctx context.Context, userToken string, user models.User) (*models.UserRecord, error) {
 	userRecord := &models.UserRecord{
 		ID:          uuid.New().String(),
 		UserToken:   userToken,
@@ -56,7 +92,7 @@ func (p *PostgresService) StoreUser(userToken string, user models.User) (*models
 		CitizenID:   user.CitizenID, // Social Security ID
 	}
 
-	result := p.db.Create(userRecord)
+	result := p.db.WithContext(ctx).Create(userRecord)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -65,9 +101,9 @@ func (p *PostgresService) StoreUser(userToken string, user models.User) (*models
 }
 
 // GetUserByToken retrieves a user by token
-func (p *PostgresService) GetUserByToken(userToken string) (*models.UserRecord, error) {
+func (p *PostgresService) GetUserByToken(ctx context.Context, userToken string) (*models.UserRecord, error) {
 	var user models.UserRecord
-	result := p.db.Where("user_token = ?", userToken).First(&user)
+	result := p.db.WithContext(ctx).Where("user_token = ?", userToken).First(&user)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -75,135 +111,1765 @@ func (p *PostgresService) GetUserByToken(userToken string) (*models.UserRecord,
 	return &user, nil
 }
 
-// StoreIssuedCard stores an issued card in the database
-func (p *PostgresService) StoreIssuedCard(record models.IssuedCardRecord) error {
-	result := p.db.Create(&record)
-	return result.Error
+// GetUserByCitizenID retrieves a user by citizen ID
+func (p *PostgresService) GetUserByCitizenID(ctx context.Context, citizenID string) (*models.UserRecord, error) {
+	var user models.UserRecord
+	result := p.db.WithContext(ctx).Where("citizen_id = ?", citizenID).First(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &user, nil
 }
 
-// StoreFailedAttempt stores a failed attempt in the database
-func (p *PostgresService) StoreFailedAttempt(record models.FailedAttemptRecord) error {
-	result := p.db.Create(&record)
-	return result.Error
+// GetUserByID retrieves a user by ID, including soft-deleted users
+func (p *PostgresService) GetUserByID(ctx context.Context, userID string) (*models.UserRecord, error) {
+	var user models.UserRecord
+	result := p.db.WithContext(ctx).Unscoped().Where("id = ?", userID).First(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &user, nil
+}
+
+// SearchUsers retrieves a page of the users matching the query
+func (p *PostgresService) SearchUsers(ctx context.Context, query models.UserSearchQuery) (*models.UserPage, error) {
+	db := p.db.WithContext(ctx)
+	switch query.Deleted {
+	case models.UserDeletedInclude:
+		db = db.Unscoped()
+	case models.UserDeletedOnly:
+		db = db.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+
+	if query.Name != "" {
+		pattern := "%" + likeEscaper.Replace(query.Name) + "%"
+		db = db.Where("(name ILIKE ? OR lastname ILIKE ? OR name || ' ' || lastname ILIKE ?)", pattern, pattern, pattern)
+	}
+	if query.CitizenID != "" {
+		db = db.Where("citizen_id = ?", query.CitizenID)
+	}
+	if query.CountryCode != "" {
+		db = db.Where("country_code = ?", query.CountryCode)
+	}
+
+	var users []models.UserRecord
+	result := historyScope(db, query.HistoryQuery).Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	page := &models.UserPage{Users: []models.AdminUser{}}
+	if len(users) > query.Limit {
+		users = users[:query.Limit]
+		last := users[len(users)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	for _, userRecord := range users {
+		page.Users = append(page.Users, models.NewAdminUser(userRecord))
+	}
+
+	return page, nil
+}
+
+// SoftDeleteUser marks a user as deleted, it can no longer request or list cards
+func (p *PostgresService) SoftDeleteUser(ctx context.Context, userID string) error {
+	result := p.db.WithContext(ctx).Where("id = ?", userID).Delete(&models.UserRecord{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RestoreUser clears the deletion of a soft-deleted user that was not erased
+func (p *PostgresService) RestoreUser(ctx context.Context, userID string) error {
+	result := p.db.WithContext(ctx).Unscoped().Model(&models.UserRecord{}).
+		Where("id = ? AND deleted_at IS NOT NULL AND erased_at IS NULL", userID).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// EraseUser irreversibly removes the personal data of a user, keeping the card, attempt and
+// request records without anything that identifies them. Active and blocked cards are cancelled
+// and the erasure is recorded.
+func (p *PostgresService) EraseUser(ctx context.Context, userID string, erasure models.UserErasureRecord) error {
+	var user models.UserRecord
+	if err := p.db.WithContext(ctx).Unscoped().Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+	if user.ErasedAt != nil {
+		return ErrUserErased
+	}
+
+	var cards []models.IssuedCardRecord
+	if err := p.db.WithContext(ctx).Where("user_id = ?", userID).Find(&cards).Error; err != nil {
+		return err
+	}
+
+	// Card numbers are kept masked, the CVV is dropped
+	erasedPANs := map[string]string{}
+	erasedCVV, err := p.cipher.Encrypt("")
+	if err != nil {
+		return fmt.Errorf("failed to encrypt CVV: %w", err)
+	}
+	for _, card := range cards {
+		if err := p.decryptCard(&card); err != nil {
+			return err
+		}
+		erasedPANs[card.ID], err = p.cipher.Encrypt(maskPAN(card.PAN))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt PAN: %w", err)
+		}
+	}
+
+	erasedToken := erasedUserToken(userID)
+	now := time.Now()
+
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, card := range cards {
+			if models.CanTransitionCardStatus(card.Status, models.CardStatusCancelled) {
+				err := changeCardStatus(tx, card.ID, card.Status, models.CardStatusCancelled, "erasure", "Personal data erased")
+				if err != nil {
+					return err
+				}
+			}
+
+			err := tx.Model(&models.IssuedCardRecord{}).Where("id = ?", card.ID).Updates(map[string]interface{}{
+				"pan":             erasedPANs[card.ID],
+				"pan_fingerprint": nil,
+				"cvv":             erasedCVV,
+				"user_token":      erasedToken,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		err := tx.Model(&models.FailedAttemptRecord{}).Where("user_id = ?", userID).
+			Update("user_token", erasedToken).Error
+		if err != nil {
+			return err
+		}
+
+		// Outbox payloads carry the name and birth date sent to the issuer
+		err = tx.Model(&models.OutboxMessageRecord{}).
+			Where("aggregate_id IN (?)", tx.Model(&models.CardRequestRecord{}).Select("request_uuid").Where("user_token = ?", user.UserToken)).
+			Update("payload", "{}").Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.CardRequestRecord{}).Where("user_token = ?", user.UserToken).
+			Update("user_token", erasedToken).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.CardRevealAuditRecord{}).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"client_ip": "", "user_agent": ""}).Error
+		if err != nil {
+			return err
+		}
+
+		// Merchants show where the citizen shopped. Amounts stay, the ledger keeps them under retention.
+		err = tx.Model(&models.CardAuthorizationRecord{}).
+			Where("card_id IN (?)", tx.Model(&models.IssuedCardRecord{}).Select("id").Where("user_id = ?", userID)).
+			Updates(map[string]interface{}{"merchant_name": "", "merchant_mcc": "", "merchant_country": ""}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("card_id IN (?)", tx.Model(&models.IssuedCardRecord{}).Select("id").Where("user_id = ?", userID)).
+			Delete(&models.CardPINRecord{}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("card_id IN (?)", tx.Model(&models.IssuedCardRecord{}).Select("id").Where("user_id = ?", userID)).
+			Delete(&models.CardControlsRecord{}).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Model(&models.UserRecord{}).
+			Where("id = ? AND erased_at IS NULL", userID).
+			Updates(map[string]interface{}{
+				"user_token": erasedToken,
+				"name":       "",
+				"lastname":   "",
+				"birth_date": erasedBirthDate,
+				"citizen_id": erasedToken,
+				"deleted_at": gorm.Expr("COALESCE(deleted_at, ?)", now),
+				"erased_at":  now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUserErased
+		}
+
+		erasure.UserID = userID
+		erasure.CreatedAt = now
+		return tx.Create(&erasure).Error
+	})
+}
+
+// StoreIssuedCard stores an issued card in the database, marking its request as issued
+// and the card it replaces as replaced or renewed. The card is stored even when the replaced
+// card moved to a status it cannot leave in the meantime, e.g. it was cancelled; the returned
+// flag reports whether the replaced card was superseded.
+func (p *PostgresService) StoreIssuedCard(ctx context.Context, requestUUID string, record models.IssuedCardRecord) (bool, error) {
+	fingerprint := p.cipher.Fingerprint(record.PAN)
+	record.PANFingerprint = &fingerprint
+	if err := p.encryptCard(&record); err != nil {
+		return false, err
+	}
+
+	superseded := false
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the replaced card so its status cannot change before it is superseded
+		var replaced models.IssuedCardRecord
+		if record.ReplacesCardID != nil {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", *record.ReplacesCardID).First(&replaced).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		err := completeCardRequest(tx, requestUUID, models.CardRequestStatusIssued, map[string]interface{}{
+			"issued_card_id": record.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+
+		if record.CreditLine != nil {
+			if err := tx.Create(record.CreditLine).Error; err != nil {
+				return err
+			}
+		}
+
+		if record.ReplacesCardID == nil {
+			return nil
+		}
+
+		to := models.SupersededCardStatus(replaced.Status)
+		if !models.CanTransitionCardStatus(replaced.Status, to) {
+			return nil
+		}
+		superseded = true
+		return changeCardStatus(tx, replaced.ID, replaced.Status, to, "system", supersededReason(to, record.ID))
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return superseded, nil
+}
+
+// GetIssuedCardByID retrieves an issued card by its ID
+func (p *PostgresService) GetIssuedCardByID(ctx context.Context, cardID string) (*models.IssuedCardRecord, error) {
+	var card models.IssuedCardRecord
+	result := p.db.WithContext(ctx).Where("id = ?", cardID).First(&card)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if err := p.decryptCard(&card); err != nil {
+		return nil, err
+	}
+
+	return &card, nil
+}
+
+// GetOwnedCard retrieves a card of the user token, returning ErrNotFound when it belongs to
+// someone else or its owner is soft-deleted
+func (p *PostgresService) GetOwnedCard(ctx context.Context, cardID, userToken string) (*models.IssuedCardRecord, error) {
+	var card models.IssuedCardRecord
+	result := p.db.WithContext(ctx).
+		Joins("JOIN users ON users.id = issued_cards.user_id AND users.deleted_at IS NULL").
+		Where("issued_cards.id = ? AND issued_cards.user_token = ?", cardID, userToken).
+		First(&card)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if err := p.decryptCard(&card); err != nil {
+		return nil, err
+	}
+
+	return &card, nil
+}
+
+// GetIssuedCardByPAN retrieves the most recent card with a PAN, found through its fingerprint
+func (p *PostgresService) GetIssuedCardByPAN(ctx context.Context, pan string) (*models.IssuedCardRecord, error) {
+	var card models.IssuedCardRecord
+	result := p.db.WithContext(ctx).Where("pan_fingerprint = ?", p.cipher.Fingerprint(pan)).Order("created_at DESC").First(&card)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if err := p.decryptCard(&card); err != nil {
+		return nil, err
+	}
+	if card.PAN != pan {
+		return nil, ErrNotFound
+	}
+
+	return &card, nil
+}
+
+// GetExpiringCards retrieves active and blocked cards expiring before the given time, soonest first,
+// continuing after the given card when it is set. Cards with a pending or issued request to supersede
+// them and cards of deleted users are left out; a declined or expired renewal is tried again.
+func (p *PostgresService) GetExpiringCards(ctx context.Context, expiresBefore time.Time, after *models.IssuedCardRecord, limit int) ([]models.IssuedCardRecord, error) {
+	query := p.db.WithContext(ctx).
+		Where("status IN ? AND expiry_date < ?", []string{models.CardStatusActive, models.CardStatusBlocked}, expiresBefore.Format("2006-01-02")).
+		Where("NOT EXISTS (SELECT 1 FROM card_requests WHERE card_requests.replaces_card_id = issued_cards.id AND card_requests.status IN ?)",
+			[]string{models.CardRequestStatusSubmitted, models.CardRequestStatusForwarded, models.CardRequestStatusIssued}).
+		Where("EXISTS (SELECT 1 FROM users WHERE users.id = issued_cards.user_id AND users.deleted_at IS NULL)")
+	if after != nil {
+		query = query.Where("(expiry_date, id) > (?, ?)", after.ExpiryDate, after.ID)
+	}
+
+	var cards []models.IssuedCardRecord
+	result := query.
+		Order("expiry_date, id").
+		Limit(limit).
+		Find(&cards)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	for i := range cards {
+		if err := p.decryptCard(&cards[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return cards, nil
+}
+
+// ChangeCardStatus moves a card from one status to another and records who changed it
+func (p *PostgresService) ChangeCardStatus(ctx context.Context, cardID, from, to, changedBy, reason string) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return changeCardStatus(tx, cardID, from, to, changedBy, reason)
+	})
 }
 
-// CreateIssuedCardRecord creates a record for successful card issuance
-func (p *PostgresService) CreateIssuedCardRecord(
-	userID string,
-	userToken string,
-	response models.IssuerResponse,
-) models.IssuedCardRecord {
-	return models.IssuedCardRecord{
+func changeCardStatus(tx *gorm.DB, cardID, from, to, changedBy, reason string) error {
+	if !models.CanTransitionCardStatus(from, to) {
+		return fmt.Errorf("cannot move card from %s to %s", from, to)
+	}
+
+	now := time.Now()
+	result := tx.Model(&models.IssuedCardRecord{}).
+		Where("id = ? AND status = ?", cardID, from).
+		Updates(map[string]interface{}{
+			"status":            to,
+			"status_changed_at": now,
+			"status_changed_by": changedBy,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCardStatusConflict
+	}
+
+	return tx.Create(&models.CardStatusChangeRecord{
 		ID:         uuid.New().String(),
-		UserID:     userID,
-		UserToken:  userToken,
-		PAN:        response.IssuedCard.PAN,
-		CVV:        response.IssuedCard.CVV,
-		ExpiryDate: response.IssuedCard.ExpiryDate,
-		CardType:   response.IssuedCard.CardType,
-		Status:     response.Status,
+		CardID:     cardID,
+		FromStatus: from,
+		ToStatus:   to,
+		ChangedBy:  changedBy,
+		Reason:     reason,
+		CreatedAt:  now,
+	}).Error
+}
+
+// StoreFailedAttempt stores a failed attempt in the database and marks its request as declined
+func (p *PostgresService) StoreFailedAttempt(ctx context.Context, requestUUID string, record models.FailedAttemptRecord) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := completeCardRequest(tx, requestUUID, models.CardRequestStatusDeclined, map[string]interface{}{
+			"decline_reason": record.DeclineReason,
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&record).Error
+	})
+}
+
+// CreateCardRequest stores a card request together with the outbox message that submits it.
+// Requests of a user are stored one at a time, admit runs once the previous ones are committed
+// and can refuse the request by returning an error.
+func (p *PostgresService) CreateCardRequest(ctx context.Context, request models.CardRequestRecord, message models.OutboxMessageRecord, admit func() error) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "card_requests:"+request.UserToken).Error; err != nil {
+			return err
+		}
+
+		if admit != nil {
+			if err := admit(); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(&request).Error; err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+				return ErrPendingCardRequest
+			}
+			return err
+		}
+
+		return tx.Create(&message).Error
+	})
+}
+
+// GetCardRequest retrieves a card request by its UUID
+func (p *PostgresService) GetCardRequest(ctx context.Context, requestUUID string) (*models.CardRequestRecord, error) {
+	var request models.CardRequestRecord
+	result := p.db.WithContext(ctx).Where("request_uuid = ?", requestUUID).First(&request)
+	if result.Error != nil {
+		return nil, result.Error
 	}
+
+	return &request, nil
 }
 
-// CreateFailedAttemptRecord creates a record for failed card issuance
-func (p *PostgresService) CreateFailedAttemptRecord(
-	userID string,
-	userToken string,
-	cardType string,
-	response models.IssuerResponse,
-) models.FailedAttemptRecord {
-	return models.FailedAttemptRecord{
-		ID:            uuid.New().String(),
-		UserID:        userID,
-		UserToken:     userToken,
-		CardType:      cardType,
-		DeclineReason: response.DeclineReason.Reason,
-		Status:        response.Status,
+// GetOverdueCardRequests retrieves pending requests last submitted before the given time
+func (p *PostgresService) GetOverdueCardRequests(ctx context.Context, submittedBefore time.Time, limit int) ([]models.CardRequestRecord, error) {
+	var requests []models.CardRequestRecord
+	result := p.db.WithContext(ctx).
+		Where("status IN ?", []string{models.CardRequestStatusSubmitted, models.CardRequestStatusForwarded}).
+		Where("COALESCE(resubmitted_at, created_at) < ?", submittedBefore).
+		Order("created_at").
+		Limit(limit).
+		Find(&requests)
+	if result.Error != nil {
+		return nil, result.Error
 	}
+
+	return requests, nil
 }
 
-// SendNotification sends a notification to the notifications service
-func (p *PostgresService) SendNotification(userToken string, response models.IssuerResponse) error {
-	fmt.Printf("Sending notification for user %s with status %s\n", userToken, response.Status)
+// HasPendingReplacement reports whether a request to replace or renew a card is still waiting for the issuer
+func (p *PostgresService) HasPendingReplacement(ctx context.Context, cardID string) (bool, error) {
+	var count int64
+	err := p.db.WithContext(ctx).Model(&models.CardRequestRecord{}).
+		Where("replaces_card_id = ?", cardID).
+		Where("status IN ?", []string{models.CardRequestStatusSubmitted, models.CardRequestStatusForwarded}).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CountPendingCardRequests counts the requests of a user still waiting for the issuer,
+// of any card type when cardType is empty
+func (p *PostgresService) CountPendingCardRequests(ctx context.Context, userToken, cardType string) (int64, error) {
+	query := p.db.WithContext(ctx).Model(&models.CardRequestRecord{}).
+		Where("user_token = ?", userToken).
+		Where("status IN ?", []string{models.CardRequestStatusSubmitted, models.CardRequestStatusForwarded})
+	if cardType != "" {
+		query = query.Where("card_type = ?", cardType)
+	}
+
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// GetLastDeclinedCardRequest retrieves the most recently declined request of a user for a card type
+func (p *PostgresService) GetLastDeclinedCardRequest(ctx context.Context, userToken, cardType string) (*models.CardRequestRecord, error) {
+	var request models.CardRequestRecord
+	result := p.db.WithContext(ctx).
+		Where("user_token = ? AND card_type = ? AND status = ?", userToken, cardType, models.CardRequestStatusDeclined).
+		Order("declined_at DESC NULLS LAST").
+		First(&request)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &request, nil
+}
+
+// GetCardRequestsByUserToken retrieves every request of a user, oldest first
+func (p *PostgresService) GetCardRequestsByUserToken(ctx context.Context, userToken string) ([]models.CardRequestRecord, error) {
+	var requests []models.CardRequestRecord
+	result := p.db.WithContext(ctx).Where("user_token = ?", userToken).Order("created_at").Find(&requests)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return requests, nil
+}
+
+// ResubmitCardRequest queues a pending request again with a copy of its last outbox message
+func (p *PostgresService) ResubmitCardRequest(ctx context.Context, requestUUID string) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var last models.OutboxMessageRecord
+		result := tx.Where("aggregate_id = ? AND topic = ?", requestUUID, models.OutboxTopicIssueRequest).
+			Order("created_at DESC").
+			First(&last)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		now := time.Now()
+		result = tx.Model(&models.CardRequestRecord{}).
+			Where("request_uuid = ? AND status IN ?", requestUUID, []string{models.CardRequestStatusSubmitted, models.CardRequestStatusForwarded}).
+			Updates(map[string]interface{}{
+				"status":         models.CardRequestStatusSubmitted,
+				"resubmits":      gorm.Expr("resubmits + 1"),
+				"resubmitted_at": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCardRequestNotPending
+		}
+
+		if err := cancelOutboxMessages(tx, requestUUID); err != nil {
+			return err
+		}
+
+		return tx.Create(&models.OutboxMessageRecord{
+			ID:            uuid.New().String(),
+			AggregateID:   requestUUID,
+			Topic:         last.Topic,
+			Payload:       last.Payload,
+			Status:        models.OutboxStatusPending,
+			NextAttemptAt: now,
+		}).Error
+	})
+}
+
+// ExpireCardRequest marks a pending request as expired and stores the failed attempt for it
+func (p *PostgresService) ExpireCardRequest(ctx context.Context, requestUUID string, record models.FailedAttemptRecord) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updated, err := updateCardRequestStatus(tx, requestUUID, models.CardRequestStatusExpired, map[string]interface{}{
+			"decline_reason": record.DeclineReason,
+		})
+		if err != nil {
+			return err
+		}
+		if !updated {
+			return ErrCardRequestNotPending
+		}
+
+		if err := cancelOutboxMessages(tx, requestUUID); err != nil {
+			return err
+		}
+
+		return tx.Create(&record).Error
+	})
+}
+
+// cancelOutboxMessages stops the delivery of messages still pending for a request
+func cancelOutboxMessages(tx *gorm.DB, requestUUID string) error {
+	return tx.Model(&models.OutboxMessageRecord{}).
+		Where("aggregate_id = ? AND status = ?", requestUUID, models.OutboxStatusPending).
+		Updates(map[string]interface{}{
+			"status":     models.OutboxStatusFailed,
+			"last_error": "cancelled",
+		}).Error
+}
+
+// completeCardRequest records the outcome of a request.
+// Requests stored before card_requests existed have no row and are accepted as is.
+func completeCardRequest(tx *gorm.DB, requestUUID, status string, updates map[string]interface{}) error {
+	updated, err := updateCardRequestStatus(tx, requestUUID, status, updates)
+	if err != nil || updated {
+		return err
+	}
+
+	var count int64
+	if err := tx.Model(&models.CardRequestRecord{}).Where("request_uuid = ?", requestUUID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCardRequestNotPending
+	}
+
 	return nil
 }
 
-// FullCardResult represents the joined result from users and cards tables
-type FullCardResult struct {
-	// User fields
-	UserID          string `gorm:"column:user_id"`
-	UserToken       string `gorm:"column:user_token"`
-	UserName        string `gorm:"column:name"`
-	UserLastname    string `gorm:"column:lastname"`
-	UserBirthDate   string `gorm:"column:birth_date"`
-	UserCountryCode string `gorm:"column:country_code"`
-	UserSocialID    string `gorm:"column:citizen_id"`
-	UserCreatedAt   string `gorm:"column:user_created_at"`
-
-	// Card fields
-	CardID        string `gorm:"column:card_id"`
-	CardPAN       string `gorm:"column:pan"`
-	CardCVV       string `gorm:"column:cvv"`
-	CardExpiry    string `gorm:"column:expiry_date"`
-	CardType      string `gorm:"column:card_type"`
-	CardStatus    string `gorm:"column:card_status"`
-	CardCreatedAt string `gorm:"column:card_created_at"`
-}
-
-// GetCardsByCitizenID retrieves all users and their cards for a specific citizen ID
-func (p *PostgresService) GetCardsByCitizenID(citizenID string) ([]models.FullCard, error) {
-	var results []FullCardResult
-
-	// Single query with JOIN
-	result := p.db.Table("users").
-		Select(`
-			users.id as user_id,
-			users.user_token,
-			users.name,
-			users.lastname,
-			users.birth_date,
-			users.country_code,
-			users.citizen_id,
-			users.created_at as user_created_at,
-			issued_cards.id as card_id,
-			issued_cards.pan,
-			issued_cards.cvv,
-			issued_cards.expiry_date,
-			issued_cards.card_type,
-			issued_cards.status as card_status,
-			issued_cards.created_at as card_created_at
-		`).
-		Joins("LEFT JOIN issued_cards ON users.id = issued_cards.user_id").
-		Where("users.citizen_id = ?", citizenID).
-		Find(&results)
-
-	if result.Error != nil {
-		return nil, result.Error
-	}
-
-	// Convert to FullCard models
-	fullCards := make([]models.FullCard, len(results))
-	for i, result := range results {
-		fullCards[i] = models.FullCard{
-			UserID:          result.UserID,
-			UserToken:       result.UserToken,
-			UserName:        result.UserName,
-			UserLastname:    result.UserLastname,
-			UserBirthDate:   result.UserBirthDate,
-			UserCountryCode: result.UserCountryCode,
-			UserSocialID:    result.UserSocialID,
-			UserCreatedAt:   result.UserCreatedAt,
-			CardID:          result.CardID,
-			CardPAN:         result.CardPAN,
-			CardCVV:         result.CardCVV,
-			CardExpiry:      result.CardExpiry,
-			CardType:        result.CardType,
-			CardStatus:      result.CardStatus,
-			CardCreatedAt:   result.CardCreatedAt,
-		}
-	}
-
-	return fullCards, nil
+// updateCardRequestStatus moves a pending request to the given status and sets its timestamp.
+// It returns false if the request was not found or was no longer pending.
+func updateCardRequestStatus(tx *gorm.DB, requestUUID, status string, updates map[string]interface{}) (bool, error) {
+	if updates == nil {
+		updates = map[string]interface{}{}
+	}
+	updates["status"] = status
+	updates[status+"_at"] = time.Now()
+
+	result := tx.Model(&models.CardRequestRecord{}).
+		Where("request_uuid = ? AND status IN ?", requestUUID, []string{models.CardRequestStatusSubmitted, models.CardRequestStatusForwarded}).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// ProcessNextOutboxMessage delivers the next due outbox message, returning false if there was none.
+// The message stays locked while it is delivered so concurrent dispatchers skip it.
+// A crash after delivery but before the update means the message is delivered again.
+func (p *PostgresService) ProcessNextOutboxMessage(
+	ctx context.Context,
+	deliver func(context.Context, models.OutboxMessageRecord) error,
+	backoff func(attempts int) time.Duration,
+	maxAttempts int,
+) (bool, error) {
+	processed := false
+
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var message models.OutboxMessageRecord
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.OutboxStatusPending, time.Now()).
+			Order("next_attempt_at").
+			Limit(1).
+			Find(&message)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		processed = true
+
+		message.Attempts++
+		updates := map[string]interface{}{"attempts": message.Attempts}
+
+		// Issue requests are marked as forwarded once sent, the reconciler expires undelivered ones
+		forwarded := false
+		if err := deliver(ctx, message); err != nil {
+			updates["last_error"] = err.Error()
+			if message.Attempts >= maxAttempts {
+				updates["status"] = models.OutboxStatusFailed
+			} else {
+				updates["next_attempt_at"] = time.Now().Add(backoff(message.Attempts))
+			}
+		} else {
+			updates["status"] = models.OutboxStatusSent
+			updates["sent_at"] = time.Now()
+			updates["last_error"] = ""
+			forwarded = true
+		}
+
+		if err := tx.Model(&models.OutboxMessageRecord{}).Where("id = ?", message.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if !forwarded || message.Topic != models.OutboxTopicIssueRequest {
+			return nil
+		}
+		_, err := updateCardRequestStatus(tx, message.AggregateID, models.CardRequestStatusForwarded, nil)
+		return err
+	})
+
+	return processed, err
+}
+
+// ClaimIdempotencyKey reserves an idempotency key for a request.
+// It returns the existing record and false if the key was already used and is still valid.
+// Keys left in progress longer than lockTimeout, or older than ttl, are claimed again.
+func (p *PostgresService) ClaimIdempotencyKey(ctx context.Context, scope, key, requestHash string, lockTimeout, ttl time.Duration) (*models.IdempotencyKeyRecord, bool, error) {
+	now := time.Now()
+	record := models.IdempotencyKeyRecord{
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+		Status:      models.IdempotencyStatusInProgress,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	result := p.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return &record, true, nil
+	}
+
+	result = p.db.WithContext(ctx).Model(&models.IdempotencyKeyRecord{}).
+		Where("scope = ? AND key = ?", scope, key).
+		Where("(status = ? AND updated_at < ?) OR created_at < ?", models.IdempotencyStatusInProgress, now.Add(-lockTimeout), now.Add(-ttl)).
+		Updates(map[string]interface{}{
+			"request_hash":  requestHash,
+			"status":        models.IdempotencyStatusInProgress,
+			"status_code":   0,
+			"content_type":  "",
+			"response_body": "",
+			"created_at":    now,
+			"updated_at":    now,
+		})
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return &record, true, nil
+	}
+
+	var existing models.IdempotencyKeyRecord
+	if err := p.db.WithContext(ctx).Where("scope = ? AND key = ?", scope, key).First(&existing).Error; err != nil {
+		return nil, false, err
+	}
+
+	return &existing, false, nil
+}
+
+// CompleteIdempotencyKey stores the response sent for an idempotency key
+func (p *PostgresService) CompleteIdempotencyKey(ctx context.Context, scope, key string, statusCode int, contentType, responseBody string) error {
+	return p.db.WithContext(ctx).Model(&models.IdempotencyKeyRecord{}).
+		Where("scope = ? AND key = ?", scope, key).
+		Updates(map[string]interface{}{
+			"status":        models.IdempotencyStatusCompleted,
+			"status_code":   statusCode,
+			"content_type":  contentType,
+			"response_body": responseBody,
+		}).Error
+}
+
+// ReleaseIdempotencyKey deletes an idempotency key so the request can be retried
+func (p *PostgresService) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	return p.db.WithContext(ctx).Where("scope = ? AND key = ?", scope, key).Delete(&models.IdempotencyKeyRecord{}).Error
+}
+
+// SendNotification sends a notification to the notifications service
+func (p *PostgresService) SendNotification(userToken string, response models.IssuerResponse) error {
+	fmt.Printf("Sending notification for user %s with status %s\n", userToken, response.Status)
+	return nil
+}
+
+// GetCardsByUserID retrieves a page of the cards of a user with their PANs masked
+func (p *PostgresService) GetCardsByUserID(ctx context.Context, userID string, query models.HistoryQuery) (*models.CardPage, error) {
+	var cards []models.IssuedCardRecord
+	result := historyScope(p.db.WithContext(ctx).Where("user_id = ?", userID), query).Find(&cards)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	page := &models.CardPage{Cards: []models.MaskedCard{}}
+	if len(cards) > query.Limit {
+		cards = cards[:query.Limit]
+		last := cards[len(cards)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	for _, card := range cards {
+		if err := p.decryptCard(&card); err != nil {
+			return nil, err
+		}
+		page.Cards = append(page.Cards, maskCard(card))
+	}
+
+	return page, nil
+}
+
+// GetFailedAttemptsByUserID retrieves a page of the failed issue attempts of a user
+func (p *PostgresService) GetFailedAttemptsByUserID(ctx context.Context, userID string, query models.HistoryQuery) (*models.FailedAttemptPage, error) {
+	var attempts []models.FailedAttemptRecord
+	result := historyScope(p.db.WithContext(ctx).Where("user_id = ?", userID), query).Find(&attempts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	page := &models.FailedAttemptPage{Attempts: []models.FailedAttempt{}}
+	if len(attempts) > query.Limit {
+		attempts = attempts[:query.Limit]
+		last := attempts[len(attempts)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	for _, attempt := range attempts {
+		page.Attempts = append(page.Attempts, failedAttempt(attempt))
+	}
+
+	return page, nil
+}
+
+// historyScope applies the filters of a history query and fetches one row more than
+// the limit, so the caller knows whether there is a next page
+func historyScope(db *gorm.DB, query models.HistoryQuery) *gorm.DB {
+	if query.CardType != "" {
+		db = db.Where("card_type = ?", query.CardType)
+	}
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+	if query.CreatedFrom != nil {
+		db = db.Where("created_at >= ?", *query.CreatedFrom)
+	}
+	if query.CreatedTo != nil {
+		db = db.Where("created_at < ?", *query.CreatedTo)
+	}
+
+	order, comparison := "DESC", "<"
+	if query.Ascending {
+		order, comparison = "ASC", ">"
+	}
+	if query.After != nil {
+		db = db.Where("(created_at, id) "+comparison+" (?::timestamptz, ?::uuid)", query.After.CreatedAt, query.After.ID)
+	}
+
+	return db.Order("created_at " + order + ", id " + order).Limit(query.Limit + 1)
+}
+
+// CountCardsByUserToken counts the cards of a user in the given statuses, of any card type when cardType is empty
+func (p *PostgresService) CountCardsByUserToken(ctx context.Context, userToken, cardType string, statuses []string) (int64, error) {
+	query := p.db.WithContext(ctx).Model(&models.IssuedCardRecord{}).
+		Where("user_token = ?", userToken).
+		Where("status IN ?", statuses)
+	if cardType != "" {
+		query = query.Where("card_type = ?", cardType)
+	}
+
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// GetFullCard retrieves the complete details of a card, including its PAN and CVV
+func (p *PostgresService) GetFullCard(ctx context.Context, cardID string) (*models.FullCard, error) {
+	card, err := p.GetIssuedCardByID(ctx, cardID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.FullCard{
+		CardID:     card.ID,
+		CardPAN:    card.PAN,
+		CardCVV:    card.CVV,
+		CardExpiry: card.ExpiryDate,
+		CardType:   card.CardType,
+		CardStatus: card.Status,
+	}, nil
+}
+
+// StoreRevealAudit stores an attempt to reveal card details
+func (p *PostgresService) StoreRevealAudit(ctx context.Context, record models.CardRevealAuditRecord) error {
+	result := p.db.WithContext(ctx).Create(&record)
+	return result.Error
+}
+
+// GetCardPIN retrieves the PIN of a card
+func (p *PostgresService) GetCardPIN(ctx context.Context, cardID string) (*models.CardPINRecord, error) {
+	var record models.CardPINRecord
+	result := p.db.WithContext(ctx).Where("card_id = ?", cardID).First(&record)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &record, nil
+}
+
+// CreateCardPIN stores the first PIN of a card, failing if the card already has one
+func (p *PostgresService) CreateCardPIN(ctx context.Context, cardID, pinHash string) error {
+	record := models.CardPINRecord{
+		CardID:  cardID,
+		PINHash: pinHash,
+	}
+
+	result := p.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCardPINAlreadySet
+	}
+
+	return nil
+}
+
+// ChangeCardPIN replaces the PIN of a card and clears its failed attempts, unless it is locked
+func (p *PostgresService) ChangeCardPIN(ctx context.Context, cardID, pinHash string) error {
+	result := p.db.WithContext(ctx).Model(&models.CardPINRecord{}).
+		Where("card_id = ? AND locked_at IS NULL", cardID).
+		Updates(map[string]interface{}{
+			"pin_hash":        pinHash,
+			"failed_attempts": 0,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCardPINLocked
+	}
+
+	return nil
+}
+
+// RecordCardPINAttempt counts a verification before the PIN is compared, locking the PIN when it reaches maxAttempts.
+// Counting first means concurrent verifications cannot get past the limit while the comparison runs.
+// The row is locked so concurrent failures are all counted.
+func (p *PostgresService) RecordCardPINAttempt(ctx context.Context, cardID string, maxAttempts int) (*models.CardPINRecord, error) {
+	var record models.CardPINRecord
+
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("card_id = ?", cardID).First(&record)
+		if result.Error != nil {
+			return result.Error
+		}
+		if record.LockedAt != nil {
+			return ErrCardPINLocked
+		}
+
+		record.FailedAttempts++
+		updates := map[string]interface{}{"failed_attempts": record.FailedAttempts}
+		if record.FailedAttempts >= maxAttempts {
+			now := time.Now()
+			record.LockedAt = &now
+			updates["locked_at"] = now
+		}
+
+		return tx.Model(&models.CardPINRecord{}).Where("card_id = ?", cardID).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// ResetCardPINAttempts clears the attempts of a PIN after a successful verification, including the lock the
+// verification's own attempt set. Nothing is cleared if other attempts were counted since.
+func (p *PostgresService) ResetCardPINAttempts(ctx context.Context, cardID string, attempts int) error {
+	return p.db.WithContext(ctx).Model(&models.CardPINRecord{}).
+		Where("card_id = ? AND failed_attempts = ?", cardID, attempts).
+		Updates(map[string]interface{}{
+			"locked_at":       nil,
+			"failed_attempts": 0,
+		}).Error
+}
+
+// UnlockCardPIN clears the lock and the failed attempts of a PIN, returning ErrNotFound if it is not locked
+func (p *PostgresService) UnlockCardPIN(ctx context.Context, cardID string) error {
+	result := p.db.WithContext(ctx).Model(&models.CardPINRecord{}).
+		Where("card_id = ? AND locked_at IS NOT NULL", cardID).
+		Updates(map[string]interface{}{
+			"locked_at":       nil,
+			"failed_attempts": 0,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetCardControls retrieves the spending controls of a card
+func (p *PostgresService) GetCardControls(ctx context.Context, cardID string) (*models.CardControlsRecord, error) {
+	var controls models.CardControlsRecord
+	result := p.db.WithContext(ctx).Where("card_id = ?", cardID).First(&controls)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &controls, nil
+}
+
+// SaveCardControls creates or replaces the spending controls of a card
+func (p *PostgresService) SaveCardControls(ctx context.Context, controls models.CardControlsRecord) (*models.CardControlsRecord, error) {
+	result := p.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "card_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"per_transaction_limit", "daily_limit", "monthly_limit",
+			"allowed_countries", "allowed_mccs", "blocked_mccs",
+			"online_enabled", "atm_enabled", "updated_at",
+		}),
+	}).Create(&controls)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return p.GetCardControls(ctx, controls.CardID)
+}
+
+// DeleteCardControls removes the spending controls of a card, returning ErrNotFound if it has none
+func (p *PostgresService) DeleteCardControls(ctx context.Context, cardID string) error {
+	result := p.db.WithContext(ctx).Where("card_id = ?", cardID).Delete(&models.CardControlsRecord{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RecordCardAuthorization stores an authorization and posts it to the ledger when approved.
+// A record without a status is decided here: the card row is locked so the spending passed to decide
+// counts every earlier authorization, and a card that is no longer active is declined.
+// Prepaid cards pay from their balance and credit cards from their credit line, an approved authorization
+// the balance or the credit left cannot cover is declined.
+func (p *PostgresService) RecordCardAuthorization(ctx context.Context, record models.CardAuthorizationRecord, decide func(spending models.CardSpending) string) (*models.CardAuthorizationRecord, error) {
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var prepaidChange *models.PrepaidBalanceChangeRecord
+		if record.Status == "" {
+			var card models.IssuedCardRecord
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status", "card_type").
+				Where("id = ?", *record.CardID).First(&card).Error
+			if err != nil {
+				return err
+			}
+
+			dayStart, monthStart := spendingPeriods(record.CreatedAt)
+			var spending models.CardSpending
+			err = tx.Model(&models.CardAuthorizationRecord{}).
+				Select("COALESCE(SUM(amount) FILTER (WHERE created_at >= ?), 0) AS today, COALESCE(SUM(amount), 0) AS this_month", dayStart).
+				Where("card_id = ? AND status = ? AND created_at >= ?", *record.CardID, models.AuthorizationStatusApproved, monthStart).
+				Scan(&spending).Error
+			if err != nil {
+				return err
+			}
+
+			decideAuthorization(&record, card.Status, spending, decide)
+
+			if record.Status == models.AuthorizationStatusApproved && card.CardType == models.CardTypePrepaid {
+				change := newPrepaidChange(card.ID, models.PrepaidChangePurchase, record.Amount, record.Currency)
+				change.CreatedAt = record.CreatedAt
+				err := applyPrepaidChange(tx, &change)
+				switch {
+				case errors.Is(err, ErrInsufficientFunds):
+					decline(&record, models.AuthorizationReasonInsufficientFunds)
+				case err != nil:
+					return err
+				default:
+					prepaidChange = &change
+				}
+				balance := change.BalanceAfter
+				record.AvailableBalance = &balance
+			}
+
+			if record.Status == models.AuthorizationStatusApproved && card.CardType == models.CardTypeCredit {
+				line, err := chargeCreditLine(tx, card.ID, record.Amount)
+				switch {
+				case errors.Is(err, ErrCreditLimitExceeded):
+					decline(&record, models.AuthorizationReasonCreditLimitExceeded)
+				case err != nil:
+					return err
+				}
+				if line != nil {
+					available := max(line.CreditLimit-line.Balance, 0)
+					record.AvailableBalance = &available
+				}
+			}
+		}
+
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		if record.Status != models.AuthorizationStatusApproved {
+			return nil
+		}
+
+		transaction := purchaseTransaction(record)
+		if err := createLedgerTransaction(tx, transaction); err != nil {
+			return err
+		}
+		if prepaidChange == nil {
+			return nil
+		}
+
+		prepaidChange.LedgerTransactionID = transaction.ID
+		return tx.Create(prepaidChange).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// RefundCardAuthorization gives back part or all of an approved authorization, crediting the card.
+// The authorization row is locked so concurrent refunds cannot add up to more than its amount.
+// The balance change is only returned for prepaid cards.
+func (p *PostgresService) RefundCardAuthorization(ctx context.Context, authorizationID string, amount int64) (*models.LedgerTransactionRecord, *models.PrepaidBalanceChangeRecord, error) {
+	var transaction models.LedgerTransactionRecord
+	var prepaidChange *models.PrepaidBalanceChangeRecord
+
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var authorization models.CardAuthorizationRecord
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", authorizationID).First(&authorization).Error
+		if err != nil {
+			return err
+		}
+		if authorization.Status != models.AuthorizationStatusApproved {
+			return ErrAuthorizationNotRefundable
+		}
+
+		var refunded int64
+		err = tx.Model(&models.LedgerTransactionRecord{}).Select("COALESCE(SUM(amount), 0)").
+			Where("authorization_id = ? AND type = ?", authorizationID, models.LedgerTransactionRefund).
+			Scan(&refunded).Error
+		if err != nil {
+			return err
+		}
+		if refunded+amount > authorization.Amount {
+			return ErrRefundExceedsAuthorization
+		}
+
+		var card models.IssuedCardRecord
+		if err := tx.Unscoped().Select("id", "card_type").Where("id = ?", *authorization.CardID).First(&card).Error; err != nil {
+			return err
+		}
+
+		transaction = refundTransaction(authorization, amount, time.Now().UTC())
+		if err := createLedgerTransaction(tx, transaction); err != nil {
+			return err
+		}
+		if card.CardType == models.CardTypeCredit {
+			return tx.Model(&models.CreditLineRecord{}).Where("card_id = ?", card.ID).Updates(map[string]interface{}{
+				"balance":       gorm.Expr("balance - ?", amount),
+				"cycle_refunds": gorm.Expr("cycle_refunds + ?", amount),
+			}).Error
+		}
+		if card.CardType != models.CardTypePrepaid {
+			return nil
+		}
+
+		change := newPrepaidChange(card.ID, models.PrepaidChangeRefund, amount, authorization.Currency)
+		change.CreatedAt = transaction.CreatedAt
+		change.LedgerTransactionID = transaction.ID
+		if err := applyPrepaidChange(tx, &change); err != nil {
+			return err
+		}
+		prepaidChange = &change
+		return tx.Create(prepaidChange).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &transaction, prepaidChange, nil
+}
+
+// createLedgerTransaction stores a ledger transaction with its entries, refusing an unbalanced one
+func createLedgerTransaction(tx *gorm.DB, transaction models.LedgerTransactionRecord) error {
+	if err := checkBalanced(transaction); err != nil {
+		return err
+	}
+
+	return tx.Create(&transaction).Error
+}
+
+// GetCardAuthorizations retrieves a page of the authorizations of a card
+func (p *PostgresService) GetCardAuthorizations(ctx context.Context, cardID string, query models.HistoryQuery) (*models.CardAuthorizationPage, error) {
+	var authorizations []models.CardAuthorizationRecord
+	result := historyScope(p.db.WithContext(ctx).Where("card_id = ?", cardID), query).Find(&authorizations)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	page := &models.CardAuthorizationPage{Authorizations: authorizations}
+	if len(authorizations) > query.Limit {
+		page.Authorizations = authorizations[:query.Limit]
+		last := page.Authorizations[len(page.Authorizations)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	if page.Authorizations == nil {
+		page.Authorizations = []models.CardAuthorizationRecord{}
+	}
+
+	return page, nil
+}
+
+// GetCardBalance sums the ledger entries of a card in a currency
+func (p *PostgresService) GetCardBalance(ctx context.Context, cardID, currency string) (*models.CardBalance, error) {
+	balance := &models.CardBalance{
+		CardID:   cardID,
+		Account:  models.CardLedgerAccount(cardID),
+		Currency: currency,
+	}
+
+	err := p.db.WithContext(ctx).Model(&models.LedgerEntryRecord{}).
+		Select("COALESCE(SUM(amount) FILTER (WHERE direction = ?), 0) AS debits, COALESCE(SUM(amount) FILTER (WHERE direction = ?), 0) AS credits",
+			models.LedgerDebit, models.LedgerCredit).
+		Where("account = ? AND currency = ?", balance.Account, currency).
+		Scan(balance).Error
+	if err != nil {
+		return nil, err
+	}
+
+	balance.Balance = balance.Credits - balance.Debits
+	return balance, nil
+}
+
+// GetLedgerTransactions retrieves a page of the ledger transactions of a card with their entries
+func (p *PostgresService) GetLedgerTransactions(ctx context.Context, cardID string, query models.HistoryQuery) (*models.LedgerTransactionPage, error) {
+	var transactions []models.LedgerTransactionRecord
+	result := historyScope(p.db.WithContext(ctx).Where("card_id = ?", cardID), query).
+		Preload("Entries", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Find(&transactions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	page := &models.LedgerTransactionPage{Transactions: transactions}
+	if len(transactions) > query.Limit {
+		page.Transactions = transactions[:query.Limit]
+		last := page.Transactions[len(page.Transactions)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	if page.Transactions == nil {
+		page.Transactions = []models.LedgerTransactionRecord{}
+	}
+
+	return page, nil
+}
+
+// GetPrepaidAccount retrieves the balance of a prepaid card
+func (p *PostgresService) GetPrepaidAccount(ctx context.Context, cardID string) (*models.PrepaidAccountRecord, error) {
+	var account models.PrepaidAccountRecord
+	result := p.db.WithContext(ctx).Where("card_id = ?", cardID).First(&account)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &account, nil
+}
+
+// ChangePrepaidBalance tops up or withdraws from a prepaid card and posts the change to the ledger
+func (p *PostgresService) ChangePrepaidBalance(ctx context.Context, change models.PrepaidBalanceChangeRecord) (*models.PrepaidBalanceChangeRecord, error) {
+	transaction := prepaidTransaction(change)
+	change.LedgerTransactionID = transaction.ID
+
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := applyPrepaidChange(tx, &change); err != nil {
+			return err
+		}
+		if err := createLedgerTransaction(tx, transaction); err != nil {
+			return err
+		}
+		return tx.Create(&change).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &change, nil
+}
+
+// applyPrepaidChange adds a change to the balance of its card with optimistic concurrency: the new balance
+// is only written while the account still has the version it was computed from, otherwise it is read again.
+// The account is created on first use. BalanceAfter is the current balance when funds are insufficient.
+func applyPrepaidChange(tx *gorm.DB, change *models.PrepaidBalanceChangeRecord) error {
+	account := models.PrepaidAccountRecord{CardID: change.CardID, Currency: change.Currency}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+		return err
+	}
+
+	for attempt := 0; attempt < prepaidUpdateAttempts; attempt++ {
+		if err := tx.Where("card_id = ?", change.CardID).First(&account).Error; err != nil {
+			return err
+		}
+
+		balance := account.Balance + prepaidDelta(*change)
+		if balance < 0 {
+			change.BalanceAfter = account.Balance
+			return ErrInsufficientFunds
+		}
+
+		result := tx.Model(&models.PrepaidAccountRecord{}).
+			Where("card_id = ? AND version = ?", change.CardID, account.Version).
+			Updates(map[string]interface{}{
+				"balance": balance,
+				"version": account.Version + 1,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			change.BalanceAfter = balance
+			change.Version = account.Version + 1
+			return nil
+		}
+	}
+
+	return ErrPrepaidBalanceConflict
+}
+
+// GetPrepaidBalanceChanges retrieves a page of the balance history of a prepaid card
+func (p *PostgresService) GetPrepaidBalanceChanges(ctx context.Context, cardID string, query models.HistoryQuery) (*models.PrepaidBalanceChangePage, error) {
+	var changes []models.PrepaidBalanceChangeRecord
+	result := historyScope(p.db.WithContext(ctx).Where("card_id = ?", cardID), query).Find(&changes)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	page := &models.PrepaidBalanceChangePage{Changes: []models.PrepaidBalanceChangeRecord{}}
+	if len(changes) > query.Limit {
+		changes = changes[:query.Limit]
+		last := changes[len(changes)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	page.Changes = append(page.Changes, changes...)
+
+	return page, nil
+}
+
+// chargeCreditLine adds a purchase to what a credit card owes and returns its credit line.
+// The update only applies while the balance stays within the limit, so concurrent purchases cannot exceed it.
+// This is the only place the limit is enforced, interest can take the balance over it.
+func chargeCreditLine(tx *gorm.DB, cardID string, amount int64) (*models.CreditLineRecord, error) {
+	result := tx.Model(&models.CreditLineRecord{}).
+		Where("card_id = ? AND balance + ? <= credit_limit", cardID, amount).
+		Updates(map[string]interface{}{
+			"balance":         gorm.Expr("balance + ?", amount),
+			"cycle_purchases": gorm.Expr("cycle_purchases + ?", amount),
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var line models.CreditLineRecord
+	if err := tx.Where("card_id = ?", cardID).First(&line).Error; err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrCreditLimitExceeded
+		}
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		return &line, ErrCreditLimitExceeded
+	}
+
+	return &line, nil
+}
+
+// GetCreditLine retrieves the credit line of a credit card
+func (p *PostgresService) GetCreditLine(ctx context.Context, cardID string) (*models.CreditLineRecord, error) {
+	var line models.CreditLineRecord
+	result := p.db.WithContext(ctx).Where("card_id = ?", cardID).First(&line)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &line, nil
+}
+
+// GetDueCreditLines retrieves credit lines whose billing cycle closes before the given time, the oldest first
+func (p *PostgresService) GetDueCreditLines(ctx context.Context, before time.Time, limit int) ([]models.CreditLineRecord, error) {
+	var lines []models.CreditLineRecord
+	result := p.db.WithContext(ctx).Where("next_statement_at <= ?", before).
+		Order("next_statement_at ASC").
+		Limit(limit).
+		Find(&lines)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return lines, nil
+}
+
+// CloseBillingCycle turns the billing cycle of a credit line into the statement build returns,
+// posting its interest and starting the next cycle. The line is locked so purchases and payments
+// wait for the statement, and a cycle that another run already closed fails with ErrBillingCycleNotDue.
+func (p *PostgresService) CloseBillingCycle(ctx context.Context, cardID string, closedAt time.Time, build func(line models.CreditLineRecord, previous *models.CreditStatementRecord) (models.CreditStatementRecord, time.Time)) (*models.CreditStatementRecord, error) {
+	var statement models.CreditStatementRecord
+
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var line models.CreditLineRecord
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("card_id = ?", cardID).First(&line).Error
+		if err != nil {
+			return err
+		}
+		if line.NextStatementAt.After(closedAt) {
+			return ErrBillingCycleNotDue
+		}
+
+		var previous *models.CreditStatementRecord
+		var last models.CreditStatementRecord
+		err = tx.Where("card_id = ?", cardID).Order("period_end DESC").First(&last).Error
+		switch {
+		case err == nil:
+			previous = &last
+		case !errors.Is(err, ErrNotFound):
+			return err
+		}
+
+		var nextStatementAt time.Time
+		statement, nextStatementAt = build(line, previous)
+
+		if statement.Interest > 0 {
+			if err := createLedgerTransaction(tx, interestTransaction(statement)); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&statement).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.CreditLineRecord{}).Where("card_id = ?", cardID).Updates(map[string]interface{}{
+			"balance":           statement.ClosingBalance,
+			"cycle_purchases":   0,
+			"cycle_refunds":     0,
+			"cycle_payments":    0,
+			"cycle_start":       statement.PeriodEnd,
+			"next_statement_at": nextStatementAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &statement, nil
+}
+
+// GetCreditStatements retrieves a page of the statements of a credit card
+func (p *PostgresService) GetCreditStatements(ctx context.Context, cardID string, query models.HistoryQuery) (*models.CreditStatementPage, error) {
+	var statements []models.CreditStatementRecord
+	result := historyScope(p.db.WithContext(ctx).Where("card_id = ?", cardID), query).Find(&statements)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	page := &models.CreditStatementPage{Statements: []models.CreditStatementRecord{}}
+	if len(statements) > query.Limit {
+		statements = statements[:query.Limit]
+		last := statements[len(statements)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	page.Statements = append(page.Statements, statements...)
+
+	return page, nil
+}
+
+// GetCreditStatement retrieves a statement by its ID
+func (p *PostgresService) GetCreditStatement(ctx context.Context, statementID string) (*models.CreditStatementRecord, error) {
+	var statement models.CreditStatementRecord
+	result := p.db.WithContext(ctx).Where("id = ?", statementID).First(&statement)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &statement, nil
+}
+
+// PayCreditStatement pays an amount against the latest statement of a credit card and posts it to the ledger.
+// The credit line is locked first, like when a billing cycle closes, so a payment never lands between cycles.
+func (p *PostgresService) PayCreditStatement(ctx context.Context, statementID string, amount int64) (*models.CreditStatementRecord, *models.LedgerTransactionRecord, error) {
+	var statement models.CreditStatementRecord
+	var transaction models.LedgerTransactionRecord
+
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", statementID).First(&statement).Error; err != nil {
+			return err
+		}
+
+		var line models.CreditLineRecord
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("card_id = ?", statement.CardID).First(&line).Error
+		if err != nil {
+			return err
+		}
+
+		var latest models.CreditStatementRecord
+		if err := tx.Where("card_id = ?", statement.CardID).Order("period_end DESC").First(&latest).Error; err != nil {
+			return err
+		}
+		if latest.ID != statement.ID {
+			return ErrStatementNotPayable
+		}
+		if amount > line.Balance {
+			return ErrPaymentExceedsBalance
+		}
+
+		err = tx.Model(&models.CreditLineRecord{}).Where("card_id = ?", line.CardID).Updates(map[string]interface{}{
+			"balance":        gorm.Expr("balance - ?", amount),
+			"cycle_payments": gorm.Expr("cycle_payments + ?", amount),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		statement = latest
+		statement.PaidAmount += amount
+		statement.Status = statementStatus(statement)
+		err = tx.Model(&statement).Updates(map[string]interface{}{
+			"paid_amount": statement.PaidAmount,
+			"status":      statement.Status,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		transaction = paymentTransaction(statement, amount, time.Now().UTC())
+		return createLedgerTransaction(tx, transaction)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &statement, &transaction, nil
+}
+
+// AppendAuditEvent chains an event to the last one in the audit log and stores it.
+// Appends are serialized with an advisory lock, concurrent writers wait for each other.
+func (p *PostgresService) AppendAuditEvent(ctx context.Context, event models.AuditEventRecord) (*models.AuditEventRecord, error) {
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditLockID).Error; err != nil {
+			return err
+		}
+
+		var last models.AuditEventRecord
+		result := tx.Order("sequence DESC").Limit(1).Find(&last)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		var prev *models.AuditEventRecord
+		if result.RowsAffected == 1 {
+			prev = &last
+		}
+
+		event = chainAuditEvent(prev, event)
+		return tx.Create(&event).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// QueryAuditEvents retrieves a page of the audit events matching the query
+func (p *PostgresService) QueryAuditEvents(ctx context.Context, query models.AuditEventQuery) (*models.AuditEventPage, error) {
+	db := p.db.WithContext(ctx)
+	if query.Actor != "" {
+		db = db.Where("actor = ?", query.Actor)
+	}
+	if query.Action != "" {
+		db = db.Where("action = ?", query.Action)
+	}
+	if query.SubjectType != "" {
+		db = db.Where("subject_type = ?", query.SubjectType)
+	}
+	if query.SubjectID != "" {
+		db = db.Where("subject_id = ?", query.SubjectID)
+	}
+	if query.RequestID != "" {
+		db = db.Where("request_id = ?", query.RequestID)
+	}
+	if query.CreatedFrom != nil {
+		db = db.Where("created_at >= ?", *query.CreatedFrom)
+	}
+	if query.CreatedTo != nil {
+		db = db.Where("created_at < ?", *query.CreatedTo)
+	}
+
+	order, comparison := "DESC", "<"
+	if query.Ascending {
+		order, comparison = "ASC", ">"
+	}
+	if query.AfterSequence > 0 {
+		db = db.Where("sequence "+comparison+" ?", query.AfterSequence)
+	}
+
+	var events []models.AuditEventRecord
+	result := db.Order("sequence " + order).Limit(query.Limit + 1).Find(&events)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return auditEventPage(events, query.Limit), nil
+}
+
+// GetAuditEventsAfter retrieves the events following a sequence number in chain order
+func (p *PostgresService) GetAuditEventsAfter(ctx context.Context, sequence int64, limit int) ([]models.AuditEventRecord, error) {
+	var events []models.AuditEventRecord
+	result := p.db.WithContext(ctx).Where("sequence > ?", sequence).Order("sequence").Limit(limit).Find(&events)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return events, nil
+}
+
+// auditEventPage trims the extra event fetched past the limit into a next cursor
+func auditEventPage(events []models.AuditEventRecord, limit int) *models.AuditEventPage {
+	page := &models.AuditEventPage{Events: []models.AuditEventRecord{}}
+	if len(events) > limit {
+		events = events[:limit]
+		last := events[len(events)-1]
+		page.NextCursor = models.HistoryCursor{CreatedAt: last.CreatedAt, ID: strconv.FormatInt(last.Sequence, 10)}.Encode()
+	}
+
+	page.Events = append(page.Events, events...)
+	return page
+}
+
+// maskCard converts a decrypted card record to its listing form
+func maskCard(card models.IssuedCardRecord) models.MaskedCard {
+	return models.MaskedCard{
+		CardID:        card.ID,
+		CardMaskedPAN: maskPAN(card.PAN),
+		CardExpiry:    card.ExpiryDate,
+		CardType:      card.CardType,
+		CardStatus:    card.Status,
+		CardCreatedAt: card.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// failedAttempt converts a failed attempt record to its listing form
+func failedAttempt(record models.FailedAttemptRecord) models.FailedAttempt {
+	return models.FailedAttempt{
+		AttemptID:     record.ID,
+		CardType:      record.CardType,
+		Status:        record.Status,
+		DeclineReason: record.DeclineReason,
+		CreatedAt:     record.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// maskPAN keeps the first 6 and last 4 digits of a PAN
+func maskPAN(pan string) string {
+	if len(pan) < 10 {
+		return strings.Repeat("*", len(pan))
+	}
+
+	return pan[:6] + strings.Repeat("*", len(pan)-10) + pan[len(pan)-4:]
+}
+
+// RotateDataKey creates a new active data key for card encryption
+func (p *PostgresService) RotateDataKey() (string, error) {
+	return p.cipher.RotateDataKey()
+}
+
+// RewrapDataKeys wraps the card data keys with a new master key
+func (p *PostgresService) RewrapDataKeys(newMasterKey []byte) error {
+	return p.cipher.RewrapDataKeys(newMasterKey)
+}
+
+// ReencryptCards re-encrypts every card not yet encrypted with the active data key, returning how many changed
+func (p *PostgresService) ReencryptCards(batchSize int) (int, error) {
+	reencrypted := 0
+	lastID := ""
+
+	for {
+		var cards []models.IssuedCardRecord
+		query := p.db.Unscoped().Order("id").Limit(batchSize)
+		if lastID != "" {
+			query = query.Where("id > ?", lastID)
+		}
+		if err := query.Find(&cards).Error; err != nil {
+			return reencrypted, err
+		}
+		if len(cards) == 0 {
+			return reencrypted, nil
+		}
+
+		for _, card := range cards {
+			lastID = card.ID
+			if !p.cipher.NeedsReencryption(card.PAN) && !p.cipher.NeedsReencryption(card.CVV) {
+				continue
+			}
+
+			if err := p.decryptCard(&card); err != nil {
+				return reencrypted, err
+			}
+			if err := p.encryptCard(&card); err != nil {
+				return reencrypted, err
+			}
+
+			err := p.db.Unscoped().Model(&models.IssuedCardRecord{}).
+				Where("id = ?", card.ID).
+				UpdateColumns(map[string]interface{}{"pan": card.PAN, "cvv": card.CVV}).Error
+			if err != nil {
+				return reencrypted, err
+			}
+			reencrypted++
+		}
+	}
+}
+
+// FingerprintCards sets the PAN fingerprint of cards stored before fingerprints existed, returning how many changed
+func (p *PostgresService) FingerprintCards(batchSize int) (int, error) {
+	fingerprinted := 0
+
+	for {
+		var cards []models.IssuedCardRecord
+		err := p.db.Unscoped().Where("pan_fingerprint IS NULL AND user_token NOT LIKE ?", erasedUserToken("%")).
+			Order("id").Limit(batchSize).Find(&cards).Error
+		if err != nil {
+			return fingerprinted, err
+		}
+		if len(cards) == 0 {
+			return fingerprinted, nil
+		}
+
+		for _, card := range cards {
+			if err := p.decryptCard(&card); err != nil {
+				return fingerprinted, err
+			}
+
+			err := p.db.Unscoped().Model(&models.IssuedCardRecord{}).
+				Where("id = ?", card.ID).
+				UpdateColumn("pan_fingerprint", p.cipher.Fingerprint(card.PAN)).Error
+			if err != nil {
+				return fingerprinted, err
+			}
+			fingerprinted++
+		}
+	}
+}
+
+// encryptCard encrypts the sensitive card fields in place
+func (p *PostgresService) encryptCard(card *models.IssuedCardRecord) error {
+	pan, err := p.cipher.Encrypt(card.PAN)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt PAN: %w", err)
+	}
+	cvv, err := p.cipher.Encrypt(card.CVV)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt CVV: %w", err)
+	}
+
+	card.PAN = pan
+	card.CVV = cvv
+	return nil
+}
+
+// decryptCard decrypts the sensitive card fields in place
+func (p *PostgresService) decryptCard(card *models.IssuedCardRecord) error {
+	pan, err := p.cipher.Decrypt(card.PAN)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt PAN: %w", err)
+	}
+	cvv, err := p.cipher.Decrypt(card.CVV)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt CVV: %w", err)
+	}
+
+	card.PAN = pan
+	card.CVV = cvv
+	return nil
 }
 
 // GetDB returns the GORM database instance for advanced queries if needed
@@ -0,0 +1,118 @@
+﻿package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"cards/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultLowBalanceThreshold = 1000
+	// prepaidUpdateAttempts is how many times a balance change is retried when another change wrote first
+	prepaidUpdateAttempts = 5
+)
+
+var (
+	// ErrInsufficientFunds is returned when a prepaid balance is too low for a debit
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrPrepaidBalanceConflict is returned when a balance kept changing under a change until it gave up
+	ErrPrepaidBalanceConflict = errors.New("prepaid balance changed concurrently")
+	// ErrAuthorizationNotRefundable is returned when refunding an authorization that was not approved
+	ErrAuthorizationNotRefundable = errors.New("authorization was not approved")
+	// ErrRefundExceedsAuthorization is returned when refunds would add up to more than the authorized amount
+	ErrRefundExceedsAuthorization = errors.New("refunds exceed the authorized amount")
+)
+
+// PrepaidAccounts moves money in and out of prepaid cards and tells when a balance runs low
+type PrepaidAccounts struct {
+	ledgerStore         LedgerStore
+	currency            string
+	lowBalanceThreshold int64
+}
+
+func NewPrepaidAccounts(ledgerStore LedgerStore, currency string) *PrepaidAccounts {
+	lowBalanceThreshold := int64(defaultLowBalanceThreshold)
+	if value, err := strconv.ParseInt(os.Getenv("PREPAID_LOW_BALANCE_THRESHOLD"), 10, 64); err == nil && value >= 0 {
+		lowBalanceThreshold = value
+	}
+
+	return &PrepaidAccounts{
+		ledgerStore:         ledgerStore,
+		currency:            currency,
+		lowBalanceThreshold: lowBalanceThreshold,
+	}
+}
+
+// Get returns the account of a prepaid card, an empty one when nothing was ever added
+func (p *PrepaidAccounts) Get(ctx context.Context, cardID string) (*models.PrepaidAccountRecord, error) {
+	account, err := p.ledgerStore.GetPrepaidAccount(ctx, cardID)
+	if errors.Is(err, ErrNotFound) {
+		return &models.PrepaidAccountRecord{CardID: cardID, Currency: p.currency}, nil
+	}
+	return account, err
+}
+
+// TopUp adds an amount to a prepaid card
+func (p *PrepaidAccounts) TopUp(ctx context.Context, cardID string, amount int64) (*models.PrepaidBalanceChangeRecord, error) {
+	return p.ledgerStore.ChangePrepaidBalance(ctx, newPrepaidChange(cardID, models.PrepaidChangeTopUp, amount, p.currency))
+}
+
+// Withdraw takes an amount from a prepaid card, failing with ErrInsufficientFunds if the balance is lower
+func (p *PrepaidAccounts) Withdraw(ctx context.Context, cardID string, amount int64) (*models.PrepaidBalanceChangeRecord, error) {
+	return p.ledgerStore.ChangePrepaidBalance(ctx, newPrepaidChange(cardID, models.PrepaidChangeWithdrawal, amount, p.currency))
+}
+
+// History returns a page of the balance changes of a prepaid card
+func (p *PrepaidAccounts) History(ctx context.Context, cardID string, query models.HistoryQuery) (*models.PrepaidBalanceChangePage, error) {
+	return p.ledgerStore.GetPrepaidBalanceChanges(ctx, cardID, query)
+}
+
+// CrossedLowBalance reports whether a debit took the balance from the threshold or above to below it,
+// so a low balance is only reported once until the card is topped up again
+func (p *PrepaidAccounts) CrossedLowBalance(amount, balanceAfter int64) bool {
+	return balanceAfter < p.lowBalanceThreshold && balanceAfter+amount >= p.lowBalanceThreshold
+}
+
+// LowBalanceThreshold is the balance below which owners are notified
+func (p *PrepaidAccounts) LowBalanceThreshold() int64 {
+	return p.lowBalanceThreshold
+}
+
+// newPrepaidChange creates a balance change for the store to apply
+func newPrepaidChange(cardID, changeType string, amount int64, currency string) models.PrepaidBalanceChangeRecord {
+	return models.PrepaidBalanceChangeRecord{
+		ID:        uuid.New().String(),
+		CardID:    cardID,
+		Type:      changeType,
+		Amount:    amount,
+		Currency:  currency,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// prepaidDelta is how much a change adds to the balance, negative for debits
+func prepaidDelta(change models.PrepaidBalanceChangeRecord) int64 {
+	switch change.Type {
+	case models.PrepaidChangeWithdrawal, models.PrepaidChangePurchase:
+		return -change.Amount
+	default:
+		return change.Amount
+	}
+}
+
+// prepaidTransaction posts a top-up or a withdrawal between the funding account and the card
+func prepaidTransaction(change models.PrepaidBalanceChangeRecord) models.LedgerTransactionRecord {
+	cardAccount := models.CardLedgerAccount(change.CardID)
+	if change.Type == models.PrepaidChangeWithdrawal {
+		return newLedgerTransaction(change.CardID, models.LedgerTransactionWithdrawal, change.Amount, change.Currency, "Withdrawal",
+			nil, cardAccount, models.LedgerAccountPrepaidFunding, change.CreatedAt)
+	}
+	return newLedgerTransaction(change.CardID, models.LedgerTransactionTopUp, change.Amount, change.Currency, "Top-up",
+		nil, models.LedgerAccountPrepaidFunding, cardAccount, change.CreatedAt)
+}
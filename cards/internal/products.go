@@ -0,0 +1,172 @@
+﻿package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"cards/models"
+)
+
+const (
+	defaultProductCatalogTTL     = 5 * time.Minute
+	productCatalogRetry          = 30 * time.Second
+	defaultProductCatalogTimeout = 5 * time.Second
+)
+
+var (
+	// ErrProductCatalogNotConfigured is returned when ISSUER_PRODUCTS_URL is not set
+	ErrProductCatalogNotConfigured = errors.New("ISSUER_PRODUCTS_URL not configured")
+	// ErrUnknownCardProduct is returned for a card type the issuer does not offer
+	ErrUnknownCardProduct = errors.New("unknown card product")
+)
+
+// ProductCatalog caches the card products of the issuer. When the issuer cannot be reached
+// the last catalog keeps being served, and the issuer is asked again after a short wait.
+type ProductCatalog struct {
+	url       string
+	client    *http.Client
+	ttl       time.Duration
+	mu        sync.Mutex
+	catalog   *models.CardProductCatalog
+	expiresAt time.Time
+	refresh   *catalogRefresh
+}
+
+// catalogRefresh is a fetch from the issuer that callers can wait on
+type catalogRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+func NewProductCatalog() *ProductCatalog {
+	ttl := defaultProductCatalogTTL
+	if value, err := time.ParseDuration(os.Getenv("PRODUCT_CATALOG_TTL")); err == nil && value > 0 {
+		ttl = value
+	}
+
+	timeout := defaultProductCatalogTimeout
+	if value, err := time.ParseDuration(os.Getenv("PRODUCT_CATALOG_TIMEOUT")); err == nil && value > 0 {
+		timeout = value
+	}
+
+	return &ProductCatalog{
+		url:    os.Getenv("ISSUER_PRODUCTS_URL"),
+		client: &http.Client{Timeout: timeout},
+		ttl:    ttl,
+	}
+}
+
+// Enabled reports whether card types are checked against the catalog
+func (p *ProductCatalog) Enabled() bool {
+	return p.url != ""
+}
+
+// Products returns the catalog, fetching it from the issuer when the cached one expired.
+// Only one fetch runs at a time and it is not tied to the caller, so a cancelled request
+// does not fail the refresh for the others. While it runs, the cached catalog is served.
+func (p *ProductCatalog) Products(ctx context.Context) (*models.CardProductCatalog, error) {
+	if !p.Enabled() {
+		return nil, ErrProductCatalogNotConfigured
+	}
+
+	p.mu.Lock()
+	if p.catalog != nil && time.Now().Before(p.expiresAt) {
+		catalog := p.catalog
+		p.mu.Unlock()
+		return catalog, nil
+	}
+	refresh := p.refresh
+	if refresh == nil {
+		refresh = &catalogRefresh{done: make(chan struct{})}
+		p.refresh = refresh
+		go p.runRefresh(context.WithoutCancel(ctx), refresh)
+	} else if p.catalog != nil {
+		catalog := p.catalog
+		p.mu.Unlock()
+		return catalog, nil
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-refresh.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.catalog == nil {
+		return nil, refresh.err
+	}
+	return p.catalog, nil
+}
+
+// runRefresh fetches the catalog and stores it, keeping the cached one when the issuer fails
+func (p *ProductCatalog) runRefresh(ctx context.Context, refresh *catalogRefresh) {
+	catalog, err := p.fetch(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		p.catalog = catalog
+		p.expiresAt = now.Add(p.ttl)
+	case p.catalog != nil:
+		log.Printf("Failed to refresh card product catalog, serving the cached one: %v", err)
+		p.expiresAt = now.Add(productCatalogRetry)
+	}
+	refresh.err = err
+	p.refresh = nil
+	close(refresh.done)
+}
+
+// Find returns the product of a card type, failing with ErrUnknownCardProduct when the issuer does not offer it
+func (p *ProductCatalog) Find(ctx context.Context, cardType string) (*models.CardProduct, error) {
+	catalog, err := p.Products(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, product := range catalog.Products {
+		if product.Type == cardType {
+			return &product, nil
+		}
+	}
+	return nil, ErrUnknownCardProduct
+}
+
+func (p *ProductCatalog) fetch(ctx context.Context) (*models.CardProductCatalog, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("issuer returned status %d", resp.StatusCode)
+	}
+
+	var catalog models.CardProductCatalog
+	if err := json.NewDecoder(resp.Body).Decode(&catalog); err != nil {
+		return nil, err
+	}
+	if catalog.Products == nil {
+		catalog.Products = []models.CardProduct{}
+	}
+
+	return &catalog, nil
+}
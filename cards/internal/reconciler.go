@@ -0,0 +1,162 @@
+﻿package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"cards/models"
+)
+
+const (
+	defaultReconcileInterval = time.Minute
+	defaultRequestDeadline   = 15 * time.Minute
+	reconcileBatchSize       = 100
+)
+
+// RequestTimeoutReason is the decline reason given to requests the issuer never answered
+const RequestTimeoutReason = "Request timed out waiting for the issuer"
+
+// RequestReconciler resubmits or expires issue requests that got no webhook before the deadline
+type RequestReconciler struct {
+	requestStore RequestStore
+	userStore    UserStore
+	notifier     *Notifier
+	auditor      *Auditor
+	interval     time.Duration
+	deadline     time.Duration
+	maxResubmits int
+}
+
+func NewRequestReconciler(requestStore RequestStore, userStore UserStore, notifier *Notifier, auditor *Auditor) *RequestReconciler {
+	interval := defaultReconcileInterval
+	if value, err := time.ParseDuration(os.Getenv("RECONCILE_INTERVAL")); err == nil && value > 0 {
+		interval = value
+	}
+
+	deadline := defaultRequestDeadline
+	if value, err := time.ParseDuration(os.Getenv("REQUEST_DEADLINE")); err == nil && value > 0 {
+		deadline = value
+	}
+
+	maxResubmits := 0
+	if value, err := strconv.Atoi(os.Getenv("REQUEST_MAX_RESUBMITS")); err == nil && value > 0 {
+		maxResubmits = value
+	}
+
+	return &RequestReconciler{
+		requestStore: requestStore,
+		userStore:    userStore,
+		notifier:     notifier,
+		auditor:      auditor,
+		interval:     interval,
+		deadline:     deadline,
+		maxResubmits: maxResubmits,
+	}
+}
+
+// Run checks for overdue requests every interval until the context is cancelled
+func (r *RequestReconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reconcile(ctx)
+		}
+	}
+}
+
+// reconcile handles overdue requests in batches until none is left
+func (r *RequestReconciler) reconcile(ctx context.Context) {
+	for {
+		requests, err := r.requestStore.GetOverdueCardRequests(ctx, time.Now().Add(-r.deadline), reconcileBatchSize)
+		if err != nil {
+			log.Printf("Failed to get overdue requests: %v", err)
+			return
+		}
+
+		handled := 0
+		for _, request := range requests {
+			if r.reconcileRequest(ctx, request) {
+				handled++
+			}
+		}
+
+		// Stop when the batch is done or nothing could be handled, failures are retried next tick
+		if len(requests) < reconcileBatchSize || handled == 0 {
+			return
+		}
+	}
+}
+
+func (r *RequestReconciler) reconcileRequest(ctx context.Context, request models.CardRequestRecord) bool {
+	if request.Resubmits < r.maxResubmits {
+		err := r.requestStore.ResubmitCardRequest(ctx, request.RequestUUID)
+		if err != nil && !errors.Is(err, ErrCardRequestNotPending) {
+			log.Printf("Failed to resubmit request %s: %v", request.RequestUUID, err)
+			return false
+		}
+
+		if err == nil {
+			log.Printf("Resubmitted request %s (resubmit %d of %d)", request.RequestUUID, request.Resubmits+1, r.maxResubmits)
+			r.audit(ctx, models.AuditActionCardRequestResubmitted, request.RequestUUID, map[string]interface{}{"resubmits": request.Resubmits + 1})
+		}
+		return true
+	}
+
+	userRecord, err := r.userStore.GetUserByToken(ctx, request.UserToken)
+	if err != nil {
+		log.Printf("Failed to get user for request %s: %v", request.RequestUUID, err)
+		return false
+	}
+
+	response := models.IssuerResponse{
+		DeclineReason: &models.DeclineReason{Reason: RequestTimeoutReason},
+		RequestUUID:   request.RequestUUID,
+		Status:        models.CardRequestStatusExpired,
+	}
+	failedAttemptRecord := CreateFailedAttemptRecord(userRecord.ID, request.UserToken, request.CardType, response)
+
+	if err := r.requestStore.ExpireCardRequest(ctx, request.RequestUUID, failedAttemptRecord); err != nil {
+		if errors.Is(err, ErrCardRequestNotPending) {
+			// The webhook arrived in the meantime
+			return true
+		}
+		log.Printf("Failed to expire request %s: %v", request.RequestUUID, err)
+		return false
+	}
+
+	log.Printf("Request %s expired after %d resubmits", request.RequestUUID, request.Resubmits)
+	r.audit(ctx, models.AuditActionCardRequestExpired, request.RequestUUID, map[string]interface{}{
+		"user_id":    userRecord.ID,
+		"attempt_id": failedAttemptRecord.ID,
+		"status":     models.CardRequestStatusExpired,
+	})
+
+	if err := r.notifier.NotifyIssuerResponse(ctx, request.UserToken, response); err != nil {
+		log.Printf("Failed to notify user for expired request %s: %v", request.RequestUUID, err)
+	}
+
+	return true
+}
+
+// audit records a change the reconciler made to a card request, logging a failure
+func (r *RequestReconciler) audit(ctx context.Context, action, requestUUID string, after interface{}) {
+	err := r.auditor.Record(ctx, AuditEvent{
+		Actor:       models.AuditActorReconciler,
+		Action:      action,
+		SubjectType: models.AuditSubjectCardRequest,
+		SubjectID:   requestUUID,
+		After:       after,
+	})
+	if err != nil {
+		log.Printf("Failed to record audit event %s for request %s: %v", action, requestUUID, err)
+	}
+}
@@ -0,0 +1,96 @@
+﻿package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"cards/models"
+
+	"github.com/google/uuid"
+)
+
+// CreateIssuedCardRecord creates a record for successful card issuance
+func CreateIssuedCardRecord(
+	userID string,
+	userToken string,
+	response models.IssuerResponse,
+) models.IssuedCardRecord {
+	return models.IssuedCardRecord{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		UserToken:  userToken,
+		PAN:        response.IssuedCard.PAN,
+		CVV:        response.IssuedCard.CVV,
+		ExpiryDate: response.IssuedCard.ExpiryDate,
+		CardType:   response.IssuedCard.CardType,
+		Status:     models.CardStatusActive,
+	}
+}
+
+// supersededReason explains the status change of a card superseded by a newly issued one
+func supersededReason(status, cardID string) string {
+	if status == models.CardStatusRenewed {
+		return "Renewed by card " + cardID
+	}
+	return "Replaced by card " + cardID
+}
+
+// CreateCardRequestRecord creates a submitted issue request with the outbox message that sends it to the issuer
+func CreateCardRequestRecord(user models.User, userToken, cardType, replacesCardID string) (models.CardRequestRecord, models.OutboxMessageRecord, error) {
+	requestUUID := uuid.New().String()
+
+	issueRequest := models.IssueRequest{
+		Name:            user.Name,
+		Lastname:        user.Lastname,
+		BirthDate:       user.BirthDate,
+		CountryCode:     user.CountryCode,
+		CardType:        cardType,
+		SuscriptorToken: os.Getenv("SUSCRIPTOR_TOKEN"),
+		RequestUUID:     requestUUID,
+	}
+
+	requestJSON, err := json.Marshal(issueRequest)
+	if err != nil {
+		return models.CardRequestRecord{}, models.OutboxMessageRecord{}, errors.New("Failed to marshal request")
+	}
+
+	requestRecord := models.CardRequestRecord{
+		RequestUUID: requestUUID,
+		UserToken:   userToken,
+		CardType:    cardType,
+		Status:      models.CardRequestStatusSubmitted,
+	}
+	if replacesCardID != "" {
+		requestRecord.ReplacesCardID = &replacesCardID
+	}
+
+	outboxMessage := models.OutboxMessageRecord{
+		ID:            uuid.New().String(),
+		AggregateID:   requestUUID,
+		Topic:         models.OutboxTopicIssueRequest,
+		Payload:       string(requestJSON),
+		Status:        models.OutboxStatusPending,
+		NextAttemptAt: time.Now(),
+	}
+
+	return requestRecord, outboxMessage, nil
+}
+
+// CreateFailedAttemptRecord creates a record for failed card issuance
+func CreateFailedAttemptRecord(
+	userID string,
+	userToken string,
+	cardType string,
+	response models.IssuerResponse,
+) models.FailedAttemptRecord {
+	return models.FailedAttemptRecord{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		UserToken:     userToken,
+		CardType:      cardType,
+		DeclineReason: response.DeclineReason.Reason,
+		Status:        response.Status,
+	}
+}
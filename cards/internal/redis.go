@@ -10,6 +10,15 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
+// incrementScript increments a counter and starts its window on the first increment, in one atomic step
+var incrementScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
 type RedisService struct {
 	client *redis.Client
 }
@@ -20,19 +29,22 @@ func NewRedisService(client *redis.Client) *RedisService {
 	}
 }
 
-func (r *RedisService) StoreUser(ctx context.Context, token string, user models.User) error {
+func (r *RedisService) StoreUser(ctx context.Context, token string, user models.User, ttl time.Duration) error {
 	userJSON, err := json.Marshal(user)
 	if err != nil {
 		return err
 	}
 
 	key := "user:" + token
-	return r.client.Set(ctx, key, userJSON, 24*time.Hour).Err()
+	return r.client.Set(ctx, key, userJSON, ttl).Err()
 }
 
 func (r *RedisService) GetUser(ctx context.Context, token string) (*models.User, error) {
 	key := "user:" + token
 	userJSON, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -46,6 +58,11 @@ func (r *RedisService) GetUser(ctx context.Context, token string) (*models.User,
 	return &user, nil
 }
 
+func (r *RedisService) DeleteUser(ctx context.Context, token string) error {
+	key := "user:" + token
+	return r.client.Del(ctx, key).Err()
+}
+
 func (r *RedisService) StoreRequest(ctx context.Context, uuid string, data models.RequestData) error {
 	requestJSON, err := json.Marshal(data)
 	if err != nil {
@@ -59,6 +76,9 @@ func (r *RedisService) StoreRequest(ctx context.Context, uuid string, data model
 func (r *RedisService) GetRequest(ctx context.Context, uuid string) (*models.RequestData, error) {
 	key := "request:" + uuid
 	requestJSON, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -77,6 +97,58 @@ func (r *RedisService) DeleteRequest(ctx context.Context, uuid string) error {
 	return r.client.Del(ctx, key).Err()
 }
 
+func (r *RedisService) StoreRevealChallenge(ctx context.Context, cardID string, challenge models.RevealChallenge, ttl time.Duration) error {
+	challengeJSON, err := json.Marshal(challenge)
+	if err != nil {
+		return err
+	}
+
+	key := "reveal:" + cardID
+	return r.client.Set(ctx, key, challengeJSON, ttl).Err()
+}
+
+func (r *RedisService) GetRevealChallenge(ctx context.Context, cardID string) (*models.RevealChallenge, error) {
+	key := "reveal:" + cardID
+	challengeJSON, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var challenge models.RevealChallenge
+	err = json.Unmarshal([]byte(challengeJSON), &challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+// IncrementRevealAttempts counts a guess of the one-time code of a card, returning the guesses made in the window
+func (r *RedisService) IncrementRevealAttempts(ctx context.Context, cardID string, window time.Duration) (int64, error) {
+	return r.increment(ctx, "reveal_attempts:"+cardID, window)
+}
+
+func (r *RedisService) ResetRevealAttempts(ctx context.Context, cardID string) error {
+	return r.client.Del(ctx, "reveal_attempts:"+cardID).Err()
+}
+
+// IncrementRevealChallenges counts a code sent for a card, returning the codes sent in the window
+func (r *RedisService) IncrementRevealChallenges(ctx context.Context, cardID string, window time.Duration) (int64, error) {
+	return r.increment(ctx, "reveal_challenges:"+cardID, window)
+}
+
+func (r *RedisService) increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return incrementScript.Run(ctx, r.client, []string{key}, window.Milliseconds()).Int64()
+}
+
+func (r *RedisService) DeleteRevealChallenge(ctx context.Context, cardID string) error {
+	key := "reveal:" + cardID
+	return r.client.Del(ctx, key).Err()
+}
+
 func (r *RedisService) GetAllUserKeys(ctx context.Context) ([]string, error) {
 	return r.client.Keys(ctx, "user:*").Result()
 }
@@ -0,0 +1,130 @@
+﻿package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"cards/models"
+)
+
+const (
+	defaultRenewalInterval   = time.Hour
+	defaultRenewalWindowDays = 60
+	renewalBatchSize         = 100
+)
+
+// CardRenewer requests new cards for cards about to expire. The requests go to the issuer like any other,
+// and the webhook marks the expiring card as renewed when its successor arrives.
+// A card gets one renewal request, a declined renewal is not retried.
+type CardRenewer struct {
+	cardStore    CardStore
+	requestStore RequestStore
+	users        *UserRepository
+	auditor      *Auditor
+	interval     time.Duration
+	windowDays   int
+}
+
+func NewCardRenewer(cardStore CardStore, requestStore RequestStore, users *UserRepository, auditor *Auditor) *CardRenewer {
+	interval := defaultRenewalInterval
+	if value, err := time.ParseDuration(os.Getenv("RENEWAL_INTERVAL")); err == nil && value > 0 {
+		interval = value
+	}
+
+	windowDays := defaultRenewalWindowDays
+	if value, err := strconv.Atoi(os.Getenv("RENEWAL_WINDOW_DAYS")); err == nil && value > 0 {
+		windowDays = value
+	}
+
+	return &CardRenewer{
+		cardStore:    cardStore,
+		requestStore: requestStore,
+		users:        users,
+		auditor:      auditor,
+		interval:     interval,
+		windowDays:   windowDays,
+	}
+}
+
+// Run looks for expiring cards every interval until the context is cancelled
+func (r *CardRenewer) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.renew(ctx)
+		}
+	}
+}
+
+// renew submits renewal requests in batches until every expiring card was tried once.
+// Cards that could not be renewed are skipped and tried again next tick.
+func (r *CardRenewer) renew(ctx context.Context) {
+	expiresBefore := time.Now().UTC().AddDate(0, 0, r.windowDays)
+	var after *models.IssuedCardRecord
+	for {
+		cards, err := r.cardStore.GetExpiringCards(ctx, expiresBefore, after, renewalBatchSize)
+		if err != nil {
+			log.Printf("Failed to get expiring cards: %v", err)
+			return
+		}
+
+		for _, card := range cards {
+			r.renewCard(ctx, card)
+		}
+
+		if len(cards) < renewalBatchSize {
+			return
+		}
+		after = &cards[len(cards)-1]
+	}
+}
+
+func (r *CardRenewer) renewCard(ctx context.Context, card models.IssuedCardRecord) {
+	user, err := r.users.Get(ctx, card.UserToken)
+	if err != nil {
+		log.Printf("Failed to get user of expiring card %s: %v", card.ID, err)
+		return
+	}
+
+	requestRecord, outboxMessage, err := CreateCardRequestRecord(*user, card.UserToken, card.CardType, card.ID)
+	if err != nil {
+		log.Printf("Failed to build renewal request for card %s: %v", card.ID, err)
+		return
+	}
+
+	if err := r.requestStore.CreateCardRequest(ctx, requestRecord, outboxMessage, nil); err != nil {
+		// The owner is waiting for a card of this type, the renewal is submitted once it arrives or is declined
+		if errors.Is(err, ErrPendingCardRequest) {
+			log.Printf("Card %s has a pending request of its type, renewing it next tick", card.ID)
+			return
+		}
+		log.Printf("Failed to store renewal request for card %s: %v", card.ID, err)
+		return
+	}
+
+	log.Printf("Submitted renewal request %s for card %s expiring on %s", requestRecord.RequestUUID, card.ID, card.ExpiryDate)
+	err = r.auditor.Record(ctx, AuditEvent{
+		Actor:       models.AuditActorRenewals,
+		Action:      models.AuditActionCardRequestSubmitted,
+		SubjectType: models.AuditSubjectCardRequest,
+		SubjectID:   requestRecord.RequestUUID,
+		After: map[string]interface{}{
+			"user_id":          card.UserID,
+			"card_type":        card.CardType,
+			"status":           requestRecord.Status,
+			"replaces_card_id": card.ID,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to record audit event for renewal request %s: %v", requestRecord.RequestUUID, err)
+	}
+}
@@ -0,0 +1,95 @@
+﻿package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultWebhookSignatureTolerance = 5 * time.Minute
+
+// Webhook signature verification errors
+var (
+	ErrWebhookSecretNotConfigured = errors.New("WEBHOOK_SIGNING_SECRET not configured")
+	ErrWebhookSignatureMissing    = errors.New("missing signature headers")
+	ErrWebhookTimestampInvalid    = errors.New("invalid signature timestamp")
+	ErrWebhookTimestampExpired    = errors.New("signature timestamp outside tolerance")
+	ErrWebhookSignatureInvalid    = errors.New("invalid signature")
+)
+
+// webhookSignatureFailures counts rejected webhook events by reason, published at /admin/v1/debug/vars
+var webhookSignatureFailures = expvar.NewMap("webhook_signature_failures")
+
+// WebhookVerifier checks the HMAC signature the webhook service adds to forwarded events
+type WebhookVerifier struct {
+	secret    []byte
+	tolerance time.Duration
+}
+
+func NewWebhookVerifier() *WebhookVerifier {
+	tolerance := defaultWebhookSignatureTolerance
+	if value, err := time.ParseDuration(os.Getenv("WEBHOOK_SIGNATURE_TOLERANCE")); err == nil && value > 0 {
+		tolerance = value
+	}
+
+	secret := os.Getenv("WEBHOOK_SIGNING_SECRET")
+	if secret == "" {
+		log.Println("WEBHOOK_SIGNING_SECRET not configured, webhook events will be rejected")
+	}
+
+	return &WebhookVerifier{
+		secret:    []byte(secret),
+		tolerance: tolerance,
+	}
+}
+
+// Verify checks a "v1=<hex hmac>" signature of "<timestamp>.<body>" and that the
+// unix timestamp is within the tolerance window, so captured events cannot be replayed later
+func (v *WebhookVerifier) Verify(timestamp, signature string, body []byte) error {
+	err := v.verify(timestamp, signature, body)
+	if err != nil {
+		webhookSignatureFailures.Add(err.Error(), 1)
+	}
+	return err
+}
+
+func (v *WebhookVerifier) verify(timestamp, signature string, body []byte) error {
+	if len(v.secret) == 0 {
+		return ErrWebhookSecretNotConfigured
+	}
+
+	if timestamp == "" || signature == "" {
+		return ErrWebhookSignatureMissing
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrWebhookTimestampInvalid
+	}
+
+	age := time.Since(time.Unix(seconds, 0))
+	if age > v.tolerance || age < -v.tolerance {
+		return ErrWebhookTimestampExpired
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "v1="))
+	if err != nil || !strings.HasPrefix(signature, "v1=") {
+		return ErrWebhookSignatureInvalid
+	}
+
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return ErrWebhookSignatureInvalid
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+﻿package internal
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"cards/models"
+)
+
+// A4 pages in points, written in 10 point Courier so columns line up without font metrics
+const (
+	pdfPageWidth     = 595
+	pdfPageHeight    = 842
+	pdfMargin        = 50
+	pdfFontSize      = 10
+	pdfLineHeight    = 14
+	pdfLinesPerPage  = (pdfPageHeight - 2*pdfMargin) / pdfLineHeight
+	pdfDescriptionAt = 30
+)
+
+// pdfLine is one line of text, bold for headings
+type pdfLine struct {
+	text string
+	bold bool
+}
+
+// StatementPDF renders a statement and its transactions as a PDF document.
+// Only the last four digits of the card number are printed.
+func StatementPDF(statement models.CreditStatement, pan string) []byte {
+	currency := statement.Currency
+	amount := func(label string, value int64) pdfLine {
+		return pdfLine{text: fmt.Sprintf("%-28s %s %14s", label, currency, FormatAmount(value))}
+	}
+
+	lines := []pdfLine{
+		{text: "CREDIT CARD STATEMENT", bold: true},
+		{},
+		{text: fmt.Sprintf("%-16s **** **** **** %s", "Card", pan[max(len(pan)-4, 0):])},
+		{text: fmt.Sprintf("%-16s %s", "Statement", statement.ID)},
+		{text: fmt.Sprintf("%-16s %s to %s", "Period", statement.PeriodStart.UTC().Format("2006-01-02"), statement.PeriodEnd.UTC().Format("2006-01-02"))},
+		{text: fmt.Sprintf("%-16s %s", "Payment due", statement.DueDate)},
+		{},
+		{text: "SUMMARY", bold: true},
+		amount("Opening balance", statement.OpeningBalance),
+		amount("Purchases", statement.Purchases),
+		amount("Refunds", -statement.Refunds),
+		amount("Payments", -statement.Payments),
+		amount(fmt.Sprintf("Interest (%s%% APR)", FormatAmount(int64(statement.APRBasisPoints))), statement.Interest),
+		{text: fmt.Sprintf("%-28s %s %14s", "Closing balance", currency, FormatAmount(statement.ClosingBalance)), bold: true},
+		{text: fmt.Sprintf("%-28s %s %14s", "Minimum payment", currency, FormatAmount(statement.MinimumPayment)), bold: true},
+		amount("Paid since closing", statement.PaidAmount),
+		amount("Credit limit", statement.CreditLimit),
+		{text: fmt.Sprintf("%-28s %s", "Status", statement.Status)},
+		{},
+		{text: "TRANSACTIONS", bold: true},
+		{text: fmt.Sprintf("%-10s  %-*s  %-10s  %14s", "Date", pdfDescriptionAt, "Description", "Type", "Amount")},
+	}
+
+	for _, transaction := range statement.Transactions {
+		value := transaction.Amount
+		if transaction.Type == models.LedgerTransactionRefund || transaction.Type == models.LedgerTransactionPayment {
+			value = -value
+		}
+		description := []rune(transaction.Description)
+		if len(description) > pdfDescriptionAt {
+			description = description[:pdfDescriptionAt]
+		}
+		lines = append(lines, pdfLine{text: fmt.Sprintf("%-10s  %-*s  %-10s  %14s",
+			transaction.CreatedAt.UTC().Format("2006-01-02"), pdfDescriptionAt, string(description), transaction.Type, FormatAmount(value))})
+	}
+	if len(statement.Transactions) == 0 {
+		lines = append(lines, pdfLine{text: "No transactions in this period"})
+	}
+
+	return renderPDF(lines)
+}
+
+// renderPDF writes lines of text to as many pages as they need. Objects 1 to 4 are the catalog,
+// the page tree and the two fonts, then every page is followed by its content stream.
+func renderPDF(lines []pdfLine) []byte {
+	var pages [][]pdfLine
+	for len(lines) > pdfLinesPerPage {
+		pages = append(pages, lines[:pdfLinesPerPage])
+		lines = lines[pdfLinesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT\n%d TL\n%d %d Td\n", pdfLineHeight, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, line := range page {
+			font := "F1"
+			if line.bold {
+				font = "F2"
+			}
+			fmt.Fprintf(&content, "/%s %d Tf\n(%s) Tj\nT*\n", font, pdfFontSize, pdfEscape(line.text))
+		}
+		content.WriteString("ET")
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes()
+}
+
+// pdfEscape makes text safe inside a PDF string, replacing what the standard fonts cannot show
+func pdfEscape(text string) string {
+	var escaped strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			escaped.WriteRune('\\')
+			escaped.WriteRune(r)
+		case r < ' ' || r > '~':
+			escaped.WriteRune('?')
+		default:
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,144 @@
+﻿package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"cards/models"
+)
+
+const (
+	defaultStatementInterval = time.Hour
+	statementBatchSize       = 100
+)
+
+// StatementGenerator closes the billing cycles of credit lines as they come due and notifies the card owners
+type StatementGenerator struct {
+	ledgerStore LedgerStore
+	cardStore   CardStore
+	credit      *CreditLines
+	notifier    *Notifier
+	auditor     *Auditor
+	interval    time.Duration
+}
+
+func NewStatementGenerator(ledgerStore LedgerStore, cardStore CardStore, credit *CreditLines, notifier *Notifier, auditor *Auditor) *StatementGenerator {
+	interval := defaultStatementInterval
+	if value, err := time.ParseDuration(os.Getenv("STATEMENT_INTERVAL")); err == nil && value > 0 {
+		interval = value
+	}
+
+	return &StatementGenerator{
+		ledgerStore: ledgerStore,
+		cardStore:   cardStore,
+		credit:      credit,
+		notifier:    notifier,
+		auditor:     auditor,
+		interval:    interval,
+	}
+}
+
+// Run generates the due statements every interval until the context is cancelled
+func (g *StatementGenerator) Run(ctx context.Context) {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.generate(ctx)
+		}
+	}
+}
+
+// generate closes due billing cycles in batches until none is left
+func (g *StatementGenerator) generate(ctx context.Context) {
+	for {
+		closedAt := time.Now().UTC()
+		lines, err := g.ledgerStore.GetDueCreditLines(ctx, closedAt, statementBatchSize)
+		if err != nil {
+			log.Printf("Failed to get due credit lines: %v", err)
+			return
+		}
+
+		generated := 0
+		for _, line := range lines {
+			if g.generateStatement(ctx, line.CardID, closedAt) {
+				generated++
+			}
+		}
+
+		// Stop when the batch is done or nothing could be generated, failures are retried next tick
+		if len(lines) < statementBatchSize || generated == 0 {
+			return
+		}
+	}
+}
+
+func (g *StatementGenerator) generateStatement(ctx context.Context, cardID string, closedAt time.Time) bool {
+	statement, err := g.ledgerStore.CloseBillingCycle(ctx, cardID, closedAt, func(line models.CreditLineRecord, previous *models.CreditStatementRecord) (models.CreditStatementRecord, time.Time) {
+		return g.credit.BuildStatement(line, previous, closedAt)
+	})
+	if errors.Is(err, ErrBillingCycleNotDue) {
+		return true
+	}
+	if err != nil {
+		log.Printf("Failed to generate statement of card %s: %v", cardID, err)
+		return false
+	}
+
+	log.Printf("Generated statement %s of card %s", statement.ID, cardID)
+	err = g.auditor.Record(ctx, AuditEvent{
+		Actor:       models.AuditActorStatements,
+		Action:      models.AuditActionStatementGenerated,
+		SubjectType: models.AuditSubjectStatement,
+		SubjectID:   statement.ID,
+		After: map[string]interface{}{
+			"card_id":         cardID,
+			"closing_balance": statement.ClosingBalance,
+			"minimum_payment": statement.MinimumPayment,
+			"interest":        statement.Interest,
+			"due_date":        statement.DueDate,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to record audit event for statement %s: %v", statement.ID, err)
+	}
+
+	g.notify(ctx, statement)
+	return true
+}
+
+// notify tells the card owner a statement is ready, a failure is only logged
+func (g *StatementGenerator) notify(ctx context.Context, statement *models.CreditStatementRecord) {
+	card, err := g.cardStore.GetIssuedCardByID(ctx, statement.CardID)
+	if err != nil {
+		log.Printf("Failed to get card of statement %s: %v", statement.ID, err)
+		return
+	}
+
+	event := models.NotificationEvent{
+		Type: "card.statement_ready",
+		Message: fmt.Sprintf("The statement of your credit card ending in %s is ready: %s %s due by %s, minimum payment %s %s",
+			card.PAN[max(len(card.PAN)-4, 0):], FormatAmount(statement.ClosingBalance), statement.Currency, statement.DueDate,
+			FormatAmount(statement.MinimumPayment), statement.Currency),
+		Data: map[string]string{
+			"card_id":         card.ID,
+			"statement_id":    statement.ID,
+			"closing_balance": fmt.Sprint(statement.ClosingBalance),
+			"minimum_payment": fmt.Sprint(statement.MinimumPayment),
+			"currency":        statement.Currency,
+			"due_date":        statement.DueDate,
+		},
+	}
+
+	if err := g.notifier.NotifyEvent(ctx, card.UserToken, event); err != nil {
+		log.Printf("Failed to notify statement %s: %v", statement.ID, err)
+	}
+}
@@ -0,0 +1,117 @@
+﻿package internal
+
+import (
+	"context"
+	"time"
+
+	"cards/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned by every store when a record does not exist
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// UserStore persists registered users. Soft-deleted users are only returned by GetUserByID and SearchUsers.
+type UserStore interface {
+	StoreUser(ctx context.Context, userToken string, user models.User) (*models.UserRecord, error)
+	GetUserByToken(ctx context.Context, userToken string) (*models.UserRecord, error)
+	GetUserByCitizenID(ctx context.Context, citizenID string) (*models.UserRecord, error)
+	GetUserByID(ctx context.Context, userID string) (*models.UserRecord, error)
+	SearchUsers(ctx context.Context, query models.UserSearchQuery) (*models.UserPage, error)
+	SoftDeleteUser(ctx context.Context, userID string) error
+	RestoreUser(ctx context.Context, userID string) error
+	EraseUser(ctx context.Context, userID string, erasure models.UserErasureRecord) error
+}
+
+// CardStore persists issued cards, failed attempts, card PINs, spending controls and the changes made to cards
+type CardStore interface {
+	StoreIssuedCard(ctx context.Context, requestUUID string, record models.IssuedCardRecord) (bool, error)
+	GetIssuedCardByID(ctx context.Context, cardID string) (*models.IssuedCardRecord, error)
+	GetOwnedCard(ctx context.Context, cardID, userToken string) (*models.IssuedCardRecord, error)
+	GetIssuedCardByPAN(ctx context.Context, pan string) (*models.IssuedCardRecord, error)
+	GetExpiringCards(ctx context.Context, expiresBefore time.Time, after *models.IssuedCardRecord, limit int) ([]models.IssuedCardRecord, error)
+	ChangeCardStatus(ctx context.Context, cardID, from, to, changedBy, reason string) error
+	StoreFailedAttempt(ctx context.Context, requestUUID string, record models.FailedAttemptRecord) error
+	GetCardsByUserID(ctx context.Context, userID string, query models.HistoryQuery) (*models.CardPage, error)
+	GetFailedAttemptsByUserID(ctx context.Context, userID string, query models.HistoryQuery) (*models.FailedAttemptPage, error)
+	CountCardsByUserToken(ctx context.Context, userToken, cardType string, statuses []string) (int64, error)
+	GetFullCard(ctx context.Context, cardID string) (*models.FullCard, error)
+	StoreRevealAudit(ctx context.Context, record models.CardRevealAuditRecord) error
+	GetCardPIN(ctx context.Context, cardID string) (*models.CardPINRecord, error)
+	CreateCardPIN(ctx context.Context, cardID, pinHash string) error
+	ChangeCardPIN(ctx context.Context, cardID, pinHash string) error
+	RecordCardPINAttempt(ctx context.Context, cardID string, maxAttempts int) (*models.CardPINRecord, error)
+	ResetCardPINAttempts(ctx context.Context, cardID string, attempts int) error
+	UnlockCardPIN(ctx context.Context, cardID string) error
+	GetCardControls(ctx context.Context, cardID string) (*models.CardControlsRecord, error)
+	SaveCardControls(ctx context.Context, controls models.CardControlsRecord) (*models.CardControlsRecord, error)
+	DeleteCardControls(ctx context.Context, cardID string) error
+}
+
+// RequestStore persists issue requests, their outbox messages and idempotency keys
+type RequestStore interface {
+	CreateCardRequest(ctx context.Context, request models.CardRequestRecord, message models.OutboxMessageRecord, admit func() error) error
+	GetCardRequest(ctx context.Context, requestUUID string) (*models.CardRequestRecord, error)
+	GetOverdueCardRequests(ctx context.Context, submittedBefore time.Time, limit int) ([]models.CardRequestRecord, error)
+	CountPendingCardRequests(ctx context.Context, userToken, cardType string) (int64, error)
+	HasPendingReplacement(ctx context.Context, cardID string) (bool, error)
+	GetCardRequestsByUserToken(ctx context.Context, userToken string) ([]models.CardRequestRecord, error)
+	GetLastDeclinedCardRequest(ctx context.Context, userToken, cardType string) (*models.CardRequestRecord, error)
+	ResubmitCardRequest(ctx context.Context, requestUUID string) error
+	ExpireCardRequest(ctx context.Context, requestUUID string, record models.FailedAttemptRecord) error
+	ProcessNextOutboxMessage(ctx context.Context, deliver func(context.Context, models.OutboxMessageRecord) error, backoff func(attempts int) time.Duration, maxAttempts int) (bool, error)
+	ClaimIdempotencyKey(ctx context.Context, scope, key, requestHash string, lockTimeout, ttl time.Duration) (*models.IdempotencyKeyRecord, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, scope, key string, statusCode int, contentType, responseBody string) error
+	ReleaseIdempotencyKey(ctx context.Context, scope, key string) error
+}
+
+// AuditStore appends to and reads the hash-chained audit log
+type AuditStore interface {
+	AppendAuditEvent(ctx context.Context, event models.AuditEventRecord) (*models.AuditEventRecord, error)
+	QueryAuditEvents(ctx context.Context, query models.AuditEventQuery) (*models.AuditEventPage, error)
+	GetAuditEventsAfter(ctx context.Context, sequence int64, limit int) ([]models.AuditEventRecord, error)
+}
+
+// LedgerStore records card authorizations, prepaid balances, credit lines and the double-entry ledger they post to
+type LedgerStore interface {
+	RecordCardAuthorization(ctx context.Context, record models.CardAuthorizationRecord, decide func(spending models.CardSpending) string) (*models.CardAuthorizationRecord, error)
+	RefundCardAuthorization(ctx context.Context, authorizationID string, amount int64) (*models.LedgerTransactionRecord, *models.PrepaidBalanceChangeRecord, error)
+	GetCardAuthorizations(ctx context.Context, cardID string, query models.HistoryQuery) (*models.CardAuthorizationPage, error)
+	GetCardBalance(ctx context.Context, cardID, currency string) (*models.CardBalance, error)
+	GetLedgerTransactions(ctx context.Context, cardID string, query models.HistoryQuery) (*models.LedgerTransactionPage, error)
+	GetPrepaidAccount(ctx context.Context, cardID string) (*models.PrepaidAccountRecord, error)
+	ChangePrepaidBalance(ctx context.Context, change models.PrepaidBalanceChangeRecord) (*models.PrepaidBalanceChangeRecord, error)
+	GetPrepaidBalanceChanges(ctx context.Context, cardID string, query models.HistoryQuery) (*models.PrepaidBalanceChangePage, error)
+	GetCreditLine(ctx context.Context, cardID string) (*models.CreditLineRecord, error)
+	GetDueCreditLines(ctx context.Context, before time.Time, limit int) ([]models.CreditLineRecord, error)
+	CloseBillingCycle(ctx context.Context, cardID string, closedAt time.Time, build func(line models.CreditLineRecord, previous *models.CreditStatementRecord) (models.CreditStatementRecord, time.Time)) (*models.CreditStatementRecord, error)
+	GetCreditStatements(ctx context.Context, cardID string, query models.HistoryQuery) (*models.CreditStatementPage, error)
+	GetCreditStatement(ctx context.Context, statementID string) (*models.CreditStatementRecord, error)
+	PayCreditStatement(ctx context.Context, statementID string, amount int64) (*models.CreditStatementRecord, *models.LedgerTransactionRecord, error)
+}
+
+// SessionStore holds short-lived data: cached users, in-flight requests, reveal challenges and their counters
+type SessionStore interface {
+	StoreUser(ctx context.Context, token string, user models.User, ttl time.Duration) error
+	GetUser(ctx context.Context, token string) (*models.User, error)
+	DeleteUser(ctx context.Context, token string) error
+	StoreRequest(ctx context.Context, uuid string, data models.RequestData) error
+	GetRequest(ctx context.Context, uuid string) (*models.RequestData, error)
+	DeleteRequest(ctx context.Context, uuid string) error
+	StoreRevealChallenge(ctx context.Context, cardID string, challenge models.RevealChallenge, ttl time.Duration) error
+	GetRevealChallenge(ctx context.Context, cardID string) (*models.RevealChallenge, error)
+	IncrementRevealAttempts(ctx context.Context, cardID string, window time.Duration) (int64, error)
+	ResetRevealAttempts(ctx context.Context, cardID string) error
+	IncrementRevealChallenges(ctx context.Context, cardID string, window time.Duration) (int64, error)
+	DeleteRevealChallenge(ctx context.Context, cardID string) error
+}
+
+var (
+	_ UserStore    = (*PostgresService)(nil)
+	_ CardStore    = (*PostgresService)(nil)
+	_ RequestStore = (*PostgresService)(nil)
+	_ AuditStore   = (*PostgresService)(nil)
+	_ LedgerStore  = (*PostgresService)(nil)
+	_ SessionStore = (*RedisService)(nil)
+)
@@ -0,0 +1,210 @@
+﻿package internal
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"cards/models"
+
+	"github.com/google/uuid"
+)
+
+// testStore is a store implementation the shared store tests run against
+type testStore interface {
+	UserStore
+	CardStore
+	RequestStore
+}
+
+// testStores returns the stores that must behave alike: the in-memory store, and PostgreSQL when
+// TEST_POSTGRES_URL and TEST_MASTER_KEY_FILE point to a database and the master key of its data keys
+func testStores(t *testing.T) map[string]testStore {
+	t.Helper()
+	stores := map[string]testStore{"memory": NewMemoryStore()}
+
+	postgresURL := os.Getenv("TEST_POSTGRES_URL")
+	if postgresURL == "" {
+		t.Log("TEST_POSTGRES_URL not set, only checking the in-memory store")
+		return stores
+	}
+	t.Setenv("POSTGRES_URL", postgresURL)
+	t.Setenv("MASTER_KEY_FILE", os.Getenv("TEST_MASTER_KEY_FILE"))
+	t.Setenv("MIGRATE_ON_START", "true")
+	stores["postgres"] = NewPostgresService()
+
+	return stores
+}
+
+// storeTestUser stores a user with a fresh token and citizen ID, so runs against one database do not collide
+func storeTestUser(t *testing.T, store testStore) *models.UserRecord {
+	t.Helper()
+	citizenID := strconv.FormatInt(time.Now().UnixNano(), 10)
+	userRecord, err := store.StoreUser(t.Context(), uuid.New().String(), models.User{
+		Name:        "Ana",
+		Lastname:    "Perez",
+		BirthDate:   "1990-01-01",
+		CountryCode: "AR",
+		CitizenID:   citizenID,
+	})
+	if err != nil {
+		t.Fatalf("store user: %v", err)
+	}
+	return userRecord
+}
+
+func submitTestRequest(t *testing.T, store testStore, userRecord *models.UserRecord, cardType, replacesCardID string, admit func() error) (models.CardRequestRecord, error) {
+	t.Helper()
+	request, message, err := CreateCardRequestRecord(models.User{Name: userRecord.Name}, userRecord.UserToken, cardType, replacesCardID)
+	if err != nil {
+		t.Fatalf("build request: %v", err)
+	}
+	return request, store.CreateCardRequest(t.Context(), request, message, admit)
+}
+
+// issueTestCard submits a request and stores the card issued for it
+func issueTestCard(t *testing.T, store testStore, userRecord *models.UserRecord, replacesCardID string) (models.IssuedCardRecord, bool) {
+	t.Helper()
+	request, err := submitTestRequest(t, store, userRecord, "debit", replacesCardID, nil)
+	if err != nil {
+		t.Fatalf("submit request: %v", err)
+	}
+
+	card := CreateIssuedCardRecord(userRecord.ID, userRecord.UserToken, models.IssuerResponse{
+		RequestUUID: request.RequestUUID,
+		IssuedCard: &models.IssuedCard{
+			PAN:        "4111" + strconv.FormatInt(time.Now().UnixNano()%1e12, 10),
+			CVV:        "123",
+			ExpiryDate: "2030-01-31",
+			CardType:   "debit",
+		},
+	})
+	if replacesCardID != "" {
+		card.ReplacesCardID = &replacesCardID
+	}
+
+	superseded, err := store.StoreIssuedCard(t.Context(), request.RequestUUID, card)
+	if err != nil {
+		t.Fatalf("store issued card: %v", err)
+	}
+	return card, superseded
+}
+
+func TestCreateCardRequestAdmitsOnePendingRequestPerType(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			userRecord := storeTestUser(t, store)
+
+			admitted := false
+			if _, err := submitTestRequest(t, store, userRecord, "debit", "", func() error {
+				admitted = true
+				return nil
+			}); err != nil {
+				t.Fatalf("first request: %v", err)
+			}
+			if !admitted {
+				t.Errorf("admit not called")
+			}
+
+			if _, err := submitTestRequest(t, store, userRecord, "debit", "", nil); !errors.Is(err, ErrPendingCardRequest) {
+				t.Errorf("second pending request of the type: err = %v, want ErrPendingCardRequest", err)
+			}
+
+			// A refused request is not stored
+			refused := errors.New("refused")
+			if _, err := submitTestRequest(t, store, userRecord, "credit", "", func() error { return refused }); !errors.Is(err, refused) {
+				t.Errorf("refused request: err = %v, want the admit error", err)
+			}
+			count, err := store.CountPendingCardRequests(t.Context(), userRecord.UserToken, "")
+			if err != nil {
+				t.Fatalf("count pending requests: %v", err)
+			}
+			if count != 1 {
+				t.Errorf("pending requests = %d, want 1", count)
+			}
+
+			if _, err := submitTestRequest(t, store, userRecord, "credit", "", nil); err != nil {
+				t.Errorf("request of another type: %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreIssuedCardSupersedesReplacedCard(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			userRecord := storeTestUser(t, store)
+			card, _ := issueTestCard(t, store, userRecord, "")
+			if err := store.ChangeCardStatus(t.Context(), card.ID, card.Status, models.CardStatusStolen, "test", "stolen"); err != nil {
+				t.Fatalf("report card stolen: %v", err)
+			}
+
+			replacement, superseded := issueTestCard(t, store, userRecord, card.ID)
+			if !superseded {
+				t.Errorf("stolen card not superseded")
+			}
+
+			stored, err := store.GetIssuedCardByID(t.Context(), card.ID)
+			if err != nil {
+				t.Fatalf("get replaced card: %v", err)
+			}
+			if stored.Status != models.CardStatusReplaced {
+				t.Errorf("replaced card status = %s, want replaced", stored.Status)
+			}
+			if _, err := store.GetIssuedCardByID(t.Context(), replacement.ID); err != nil {
+				t.Errorf("replacement not stored: %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreIssuedCardKeepsCardThatCannotBeSuperseded(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			userRecord := storeTestUser(t, store)
+			card, _ := issueTestCard(t, store, userRecord, "")
+
+			request, err := submitTestRequest(t, store, userRecord, "debit", card.ID, nil)
+			if err != nil {
+				t.Fatalf("submit renewal: %v", err)
+			}
+			pending, err := store.HasPendingReplacement(t.Context(), card.ID)
+			if err != nil || !pending {
+				t.Errorf("pending replacement = %v, %v, want true", pending, err)
+			}
+			if err := store.ChangeCardStatus(t.Context(), card.ID, card.Status, models.CardStatusCancelled, "test", "cancel"); err != nil {
+				t.Fatalf("cancel card: %v", err)
+			}
+
+			renewal := CreateIssuedCardRecord(userRecord.ID, userRecord.UserToken, models.IssuerResponse{
+				RequestUUID: request.RequestUUID,
+				IssuedCard:  &models.IssuedCard{PAN: "4222222222222222", CVV: "123", ExpiryDate: "2031-01-31", CardType: "debit"},
+			})
+			renewal.ReplacesCardID = &card.ID
+			superseded, err := store.StoreIssuedCard(t.Context(), request.RequestUUID, renewal)
+			if err != nil {
+				t.Fatalf("store renewal: %v", err)
+			}
+			if superseded {
+				t.Errorf("cancelled card reported as superseded")
+			}
+
+			stored, err := store.GetIssuedCardByID(t.Context(), card.ID)
+			if err != nil {
+				t.Fatalf("get cancelled card: %v", err)
+			}
+			if stored.Status != models.CardStatusCancelled {
+				t.Errorf("cancelled card status = %s, want cancelled", stored.Status)
+			}
+			if _, err := store.GetIssuedCardByID(t.Context(), renewal.ID); err != nil {
+				t.Errorf("renewal not stored: %v", err)
+			}
+			issued, err := store.GetCardRequest(t.Context(), request.RequestUUID)
+			if err != nil || issued.Status != models.CardRequestStatusIssued {
+				t.Errorf("renewal request = %+v, %v, want it issued", issued, err)
+			}
+		})
+	}
+}
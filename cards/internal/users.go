@@ -0,0 +1,92 @@
+﻿package internal
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"cards/models"
+)
+
+const defaultUserCacheTTL = 24 * time.Hour
+
+// UserRepository stores users in the user store and caches them in the session store.
+// The user store is the source of truth, a cached entry only exists for a stored user.
+type UserRepository struct {
+	sessionStore SessionStore
+	userStore    UserStore
+	cacheTTL     time.Duration
+}
+
+func NewUserRepository(sessionStore SessionStore, userStore UserStore) *UserRepository {
+	cacheTTL := defaultUserCacheTTL
+	if value, err := time.ParseDuration(os.Getenv("USER_CACHE_TTL")); err == nil && value > 0 {
+		cacheTTL = value
+	}
+
+	return &UserRepository{
+		sessionStore: sessionStore,
+		userStore:    userStore,
+		cacheTTL:     cacheTTL,
+	}
+}
+
+// Create stores the user in PostgreSQL and then caches it
+func (r *UserRepository) Create(ctx context.Context, token string, user models.User) (*models.UserRecord, error) {
+	userRecord, err := r.userStore.StoreUser(ctx, token, user)
+	if err != nil {
+		return nil, err
+	}
+
+	user.ID = userRecord.ID
+	r.cache(ctx, token, user)
+	return userRecord, nil
+}
+
+// Get reads the user from Redis, falling back to PostgreSQL and caching the result.
+// Users cached before they carried their ID are read again from PostgreSQL.
+func (r *UserRepository) Get(ctx context.Context, token string) (*models.User, error) {
+	user, err := r.sessionStore.GetUser(ctx, token)
+	if err == nil && user.ID != "" {
+		return user, nil
+	}
+
+	userRecord, err := r.userStore.GetUserByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	user = userFromRecord(userRecord)
+	r.cache(ctx, token, *user)
+	return user, nil
+}
+
+// Invalidate removes the cached user so the next read goes to PostgreSQL
+func (r *UserRepository) Invalidate(ctx context.Context, token string) error {
+	return r.sessionStore.DeleteUser(ctx, token)
+}
+
+// cache stores the user in Redis, a failure only costs a database read later
+func (r *UserRepository) cache(ctx context.Context, token string, user models.User) {
+	if err := r.sessionStore.StoreUser(ctx, token, user, r.cacheTTL); err != nil {
+		log.Printf("Failed to cache user %s in Redis: %v", token, err)
+	}
+}
+
+func userFromRecord(userRecord *models.UserRecord) *models.User {
+	// Date columns are read back as timestamps, the issuer expects YYYY-MM-DD
+	birthDate := userRecord.BirthDate
+	if parsed, err := time.Parse(time.RFC3339, birthDate); err == nil {
+		birthDate = parsed.Format("2006-01-02")
+	}
+
+	return &models.User{
+		ID:          userRecord.ID,
+		Name:        userRecord.Name,
+		Lastname:    userRecord.Lastname,
+		BirthDate:   birthDate,
+		CountryCode: userRecord.CountryCode,
+		CitizenID:   userRecord.CitizenID,
+	}
+}
@@ -1,9 +1,17 @@
 ﻿package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -21,31 +29,75 @@ func main() {
 		log.Println("No .env file found, using system environment variables")
 	}
 
-	// Initialize Redis client
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     os.Getenv("REDIS_ADDR"),
-		Password: os.Getenv("REDIS_PASSWORD"),
-		DB:       0,
-	})
-
-	// Test Redis connection
-	if err := redisClient.Ping(redisClient.Context()).Err(); err != nil {
-		log.Fatal("Failed to connect to Redis:", err)
+	// Run a maintenance command instead of the server if one was given
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
 	}
-	log.Println("Redis client succesful ping")
 
-	// Initialize PostgreSQL service with auto-migration
-	postgresService := internal.NewPostgresService()
-	log.Println("Database schema migrated successfully")
+	// Stop the background jobs and drain the server on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Initialize storage, PostgreSQL and Redis unless STORAGE=memory
+	storage := newStorage()
 
 	// Initialize services
-	redisService := internal.NewRedisService(redisClient)
+	notifier := internal.NewNotifier()
+	auditor := internal.NewAuditor(storage.audit)
+	userRepository := internal.NewUserRepository(storage.sessions, storage.users)
+	spendingControls := internal.NewSpendingControls(storage.cards)
+	authorizer := internal.NewAuthorizer(storage.cards, storage.ledger, spendingControls)
+	prepaidAccounts := internal.NewPrepaidAccounts(storage.ledger, authorizer.Currency())
+	creditLines := internal.NewCreditLines(storage.ledger, authorizer.Currency())
 
 	// Initialize handlers
-	registerHandler := handlers.NewRegisterHandler(redisService, postgresService)
-	issueHandler := handlers.NewIssueHandler(redisService, postgresService)
-	webhookHandler := handlers.NewWebhookHandler(redisService, postgresService)
-	cardsHandler := handlers.NewCardsHandler(postgresService)
+	registerHandler := handlers.NewRegisterHandler(userRepository, auditor)
+	issuancePolicy := internal.NewIssuancePolicy(storage.cards, storage.requests)
+	productCatalog := internal.NewProductCatalog()
+	issueHandler := handlers.NewIssueHandler(storage.sessions, storage.requests, userRepository, issuancePolicy, productCatalog, auditor)
+	webhookHandler := handlers.NewWebhookHandler(storage.sessions, storage.users, storage.cards, storage.requests, notifier, internal.NewWebhookVerifier(), auditor, creditLines)
+	cardsHandler := handlers.NewCardsHandler(storage.users, storage.cards, auditor)
+	lifecycleHandler := handlers.NewCardLifecycleHandler(storage.cards, storage.sessions, storage.requests, userRepository, issuancePolicy, auditor)
+	revealHandler := handlers.NewRevealHandler(storage.sessions, storage.cards, notifier, auditor)
+	pinHandler := handlers.NewPINHandler(storage.cards, notifier, auditor)
+	controlsHandler := handlers.NewControlsHandler(storage.cards, spendingControls, auditor)
+	authorizationHandler := handlers.NewAuthorizationHandler(authorizer, prepaidAccounts, notifier, auditor)
+	ledgerHandler := handlers.NewLedgerHandler(storage.cards, storage.ledger, authorizer, auditor)
+	prepaidHandler := handlers.NewPrepaidHandler(storage.cards, prepaidAccounts, notifier, auditor)
+	creditHandler := handlers.NewCreditHandler(storage.cards, creditLines, auditor)
+	idempotencyHandler := handlers.NewIdempotencyHandler(storage.requests)
+	requestsHandler := handlers.NewRequestsHandler(storage.requests)
+	productsHandler := handlers.NewProductsHandler(productCatalog)
+	adminHandler := handlers.NewAdminHandler(storage.users, storage.cards, storage.requests, userRepository, auditor)
+	privacyHandler := handlers.NewPrivacyHandler(storage.users, storage.cards, storage.requests, storage.ledger, storage.sessions, notifier, auditor)
+	auditHandler := handlers.NewAuditHandler(storage.audit, auditor)
+
+	// Background jobs stop on shutdown, which waits for them to return
+	var jobs sync.WaitGroup
+	runJob := func(run func(context.Context)) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			run(ctx)
+		}()
+	}
+
+	// Deliver outbox messages in the background
+	outboxDispatcher := internal.NewOutboxDispatcher(storage.requests, auditor)
+	runJob(outboxDispatcher.Run)
+
+	// Resubmit or expire requests the issuer never answered
+	requestReconciler := internal.NewRequestReconciler(storage.requests, storage.users, notifier, auditor)
+	runJob(requestReconciler.Run)
+
+	// Close the billing cycles of credit lines and generate their statements
+	statementGenerator := internal.NewStatementGenerator(storage.ledger, storage.cards, creditLines, notifier, auditor)
+	runJob(statementGenerator.Run)
+
+	// Request new cards for cards about to expire
+	cardRenewer := internal.NewCardRenewer(storage.cards, storage.requests, userRepository, auditor)
+	runJob(cardRenewer.Run)
 
 	// Setup router
 	router := gin.Default()
@@ -59,13 +111,78 @@ func main() {
 		AllowCredentials: false,
 	}))
 
+	// Tag every request with an ID that audit events refer to
+	router.Use(handlers.RequestID)
+
 	v1 := router.Group("/v1")
 
 	// Register routes
-	v1.POST("/register", registerHandler.Register)
-	v1.POST("/issue", issueHandler.Issue)
+	v1.POST("/register", idempotencyHandler.Middleware, registerHandler.Register)
+	v1.POST("/issue", idempotencyHandler.Middleware, issueHandler.Issue)
 	v1.POST("/webhook", webhookHandler.Webhook)
 	v1.GET("/:citizen_id/cards", cardsHandler.GetCardsByCitizenID)
+	v1.GET("/:citizen_id/attempts", cardsHandler.GetAttemptsByCitizenID)
+	v1.GET("/requests/:request_uuid", requestsHandler.GetRequest)
+	v1.GET("/products", productsHandler.List)
+
+	// Card lifecycle routes
+	v1.POST("/cards/:card_id/block", lifecycleHandler.Block)
+	v1.POST("/cards/:card_id/unblock", lifecycleHandler.Unblock)
+	v1.POST("/cards/:card_id/cancel", lifecycleHandler.Cancel)
+	v1.POST("/cards/:card_id/replace", lifecycleHandler.Replace)
+
+	// Card details reveal routes
+	v1.POST("/cards/:card_id/reveal/challenge", revealHandler.Challenge)
+	v1.POST("/cards/:card_id/reveal", revealHandler.Reveal)
+
+	// Card PIN routes
+	v1.POST("/cards/:card_id/pin", pinHandler.Set)
+	v1.POST("/cards/:card_id/pin/change", pinHandler.Change)
+	v1.POST("/cards/:card_id/pin/verify", pinHandler.Verify)
+
+	// Card spending controls routes
+	v1.GET("/cards/:card_id/controls", controlsHandler.Get)
+	v1.PUT("/cards/:card_id/controls", controlsHandler.Put)
+	v1.DELETE("/cards/:card_id/controls", controlsHandler.Delete)
+
+	// Card balance and transaction history routes
+	v1.GET("/cards/:card_id/balance", ledgerHandler.Balance)
+	v1.GET("/cards/:card_id/transactions", ledgerHandler.Transactions)
+
+	// Prepaid balance routes
+	v1.GET("/cards/:card_id/prepaid", prepaidHandler.Get)
+	v1.POST("/cards/:card_id/prepaid/top-up", idempotencyHandler.Middleware, prepaidHandler.TopUp)
+	v1.POST("/cards/:card_id/prepaid/withdraw", idempotencyHandler.Middleware, prepaidHandler.Withdraw)
+	v1.GET("/cards/:card_id/prepaid/history", prepaidHandler.History)
+
+	// Credit line and statement routes
+	v1.GET("/cards/:card_id/credit", creditHandler.Credit)
+	v1.GET("/cards/:card_id/statements", creditHandler.Statements)
+	v1.GET("/cards/:card_id/statements/:statement_id", creditHandler.Statement)
+	v1.POST("/cards/:card_id/statements/:statement_id/payments", idempotencyHandler.Middleware, creditHandler.Pay)
+
+	// Card network routes, authenticated with NETWORK_API_TOKEN
+	networkAuth := handlers.NewNetworkAuth()
+	v1.POST("/authorizations", networkAuth.Middleware, authorizationHandler.Authorize)
+	v1.POST("/authorizations/:authorization_id/refund", networkAuth.Middleware, idempotencyHandler.Middleware, authorizationHandler.Refund)
+
+	// Admin routes, authenticated with ADMIN_API_TOKEN
+	admin := router.Group("/admin/v1", handlers.NewAdminAuth().Middleware)
+	admin.GET("/users", adminHandler.SearchUsers)
+	admin.GET("/users/:user_id", adminHandler.GetUser)
+	admin.GET("/users/:user_id/cards", adminHandler.GetUserCards)
+	admin.GET("/users/:user_id/attempts", adminHandler.GetUserAttempts)
+	admin.DELETE("/users/:user_id", adminHandler.DeleteUser)
+	admin.POST("/users/:user_id/restore", adminHandler.RestoreUser)
+	admin.POST("/users/:user_id/expire-session", adminHandler.ExpireSession)
+	admin.GET("/citizens/:citizen_id/export", privacyHandler.Export)
+	admin.POST("/citizens/:citizen_id/erase", privacyHandler.Erase)
+	admin.POST("/cards/:card_id/pin/unlock", pinHandler.Unlock)
+	admin.GET("/audit-events", auditHandler.QueryEvents)
+	admin.GET("/audit-events/verify", auditHandler.VerifyChain)
+
+	// Runtime counters, including rejected webhook signatures
+	admin.GET("/debug/vars", gin.WrapH(expvar.Handler()))
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
@@ -78,8 +195,205 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Starting Service A on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Printf("Starting Service A on port %s", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down, draining in-flight requests")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to drain requests: %v", err)
+	}
+
+	jobsDone := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		close(jobsDone)
+	}()
+	select {
+	case <-jobsDone:
+		log.Println("Shutdown complete")
+	case <-shutdownCtx.Done():
+		log.Println("Shutdown timed out waiting for background jobs")
+	}
+}
+
+// shutdownTimeout is how long SHUTDOWN_TIMEOUT lets requests and background jobs finish, 15 seconds by default
+func shutdownTimeout() time.Duration {
+	if value, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && value > 0 {
+		return value
+	}
+	return 15 * time.Second
+}
+
+// storage groups the stores used by the handlers
+type storage struct {
+	users    internal.UserStore
+	cards    internal.CardStore
+	requests internal.RequestStore
+	sessions internal.SessionStore
+	audit    internal.AuditStore
+	ledger   internal.LedgerStore
+}
+
+// newStorage connects to PostgreSQL and Redis, or keeps everything in memory with STORAGE=memory
+func newStorage() storage {
+	if os.Getenv("STORAGE") == "memory" {
+		log.Println("Using in-memory storage, all data is lost on restart")
+		memoryStore := internal.NewMemoryStore()
+		return storage{
+			users:    memoryStore,
+			cards:    memoryStore,
+			requests: memoryStore,
+			sessions: internal.NewMemorySessionStore(),
+			audit:    memoryStore,
+			ledger:   memoryStore,
+		}
+	}
+
+	// Initialize Redis client
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     os.Getenv("REDIS_ADDR"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+		DB:       0,
+	})
+
+	// Test Redis connection
+	if err := redisClient.Ping(redisClient.Context()).Err(); err != nil {
+		log.Fatal("Failed to connect to Redis:", err)
+	}
+	log.Println("Redis client succesful ping")
+
+	// Initialize PostgreSQL service, it refuses to start on an unexpected schema version
+	postgresService := internal.NewPostgresService()
+	log.Println("Database schema version checked successfully")
+
+	return storage{
+		users:    postgresService,
+		cards:    postgresService,
+		requests: postgresService,
+		sessions: internal.NewRedisService(redisClient),
+		audit:    postgresService,
+		ledger:   postgresService,
+	}
+}
+
+// runCommand runs a maintenance command, e.g. "cards keys rotate"
+func runCommand(args []string) {
+	switch args[0] {
+	case "keys":
+		runKeysCommand(args[1:])
+	case "migrate":
+		runMigrateCommand(args[1:])
+	default:
+		log.Fatalf("Unknown command: %s", args[0])
+	}
+}
+
+// runMigrateCommand applies, rolls back or lists the database schema migrations
+func runMigrateCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: cards migrate up|down|status")
+	}
+
+	migrator := internal.NewMigrator()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal("Failed to apply migrations:", err)
+		}
+		log.Printf("Database schema is at version %d", migrator.LatestVersion())
+
+	case "down":
+		migration, err := migrator.Down()
+		if err != nil {
+			log.Fatal("Failed to roll back migration:", err)
+		}
+		log.Printf("Rolled back migration %d_%s", migration.Version, migration.Name)
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatal("Failed to get migration status:", err)
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+
+	default:
+		log.Fatalf("Unknown migrate command: %s", args[0])
+	}
+}
+
+// runKeysCommand manages the keys used to encrypt card data
+func runKeysCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: cards keys rotate|reencrypt|fingerprint|rewrap <new master key file>")
+	}
+
+	postgresService := internal.NewPostgresService()
+
+	switch args[0] {
+	case "rotate":
+		// New cards are encrypted with the new key, existing ones keep theirs until reencrypt
+		keyID, err := postgresService.RotateDataKey()
+		if err != nil {
+			log.Fatal("Failed to rotate data key:", err)
+		}
+		log.Printf("Data key %s is now active", keyID)
+
+	case "reencrypt":
+		count, err := postgresService.ReencryptCards(100)
+		if err != nil {
+			log.Fatal("Failed to re-encrypt cards:", err)
+		}
+		log.Printf("Re-encrypted %d cards with the active data key", count)
+
+	case "fingerprint":
+		// Cards stored before PAN fingerprints existed cannot be authorized until they have one
+		count, err := postgresService.FingerprintCards(100)
+		if err != nil {
+			log.Fatal("Failed to fingerprint cards:", err)
+		}
+		log.Printf("Fingerprinted %d cards", count)
+
+	case "rewrap":
+		if len(args) < 2 {
+			log.Fatal("Usage: cards keys rewrap <new master key file>")
+		}
+		newMasterKey, err := internal.LoadMasterKey(args[1])
+		if err != nil {
+			log.Fatal("Failed to load new master key:", err)
+		}
+		if err := postgresService.RewrapDataKeys(newMasterKey); err != nil {
+			log.Fatal("Failed to rewrap data keys:", err)
+		}
+		log.Printf("Data keys rewrapped, set MASTER_KEY_FILE to %s before restarting", args[1])
+
+	default:
+		log.Fatalf("Unknown keys command: %s", args[0])
 	}
 }
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS failed_attempts;
+DROP TABLE IF EXISTS issued_cards;
+DROP TABLE IF EXISTS users;
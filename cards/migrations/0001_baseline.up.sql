@@ -0,0 +1,46 @@
+-- Tables created by the service before versioned migrations
+CREATE TABLE IF NOT EXISTS users (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_token text NOT NULL,
+    name text NOT NULL,
+    lastname text NOT NULL,
+    birth_date date NOT NULL,
+    country_code text NOT NULL,
+    citizen_id text NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_user_token ON users (user_token);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_citizen_id ON users (citizen_id);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS issued_cards (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid NOT NULL,
+    user_token text NOT NULL,
+    pan text NOT NULL,
+    cvv text NOT NULL,
+    expiry_date date NOT NULL,
+    card_type text NOT NULL,
+    status text NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    CONSTRAINT fk_issued_cards_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_issued_cards_deleted_at ON issued_cards (deleted_at);
+
+CREATE TABLE IF NOT EXISTS failed_attempts (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid NOT NULL,
+    user_token text NOT NULL,
+    card_type text NOT NULL,
+    decline_reason text NOT NULL,
+    status text NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    CONSTRAINT fk_failed_attempts_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_failed_attempts_deleted_at ON failed_attempts (deleted_at);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS card_status_changes;
+
+DROP INDEX IF EXISTS idx_issued_cards_replaces_card_id;
+ALTER TABLE issued_cards
+    DROP COLUMN IF EXISTS status_changed_at,
+    DROP COLUMN IF EXISTS status_changed_by,
+    DROP COLUMN IF EXISTS replaces_card_id;
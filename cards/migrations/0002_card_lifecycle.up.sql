@@ -0,0 +1,19 @@
+ALTER TABLE issued_cards
+    ADD COLUMN IF NOT EXISTS status_changed_at timestamptz,
+    ADD COLUMN IF NOT EXISTS status_changed_by text,
+    ADD COLUMN IF NOT EXISTS replaces_card_id uuid;
+CREATE INDEX IF NOT EXISTS idx_issued_cards_replaces_card_id ON issued_cards (replaces_card_id);
+
+-- Cards issued before status tracking were stored without a status
+UPDATE issued_cards SET status = 'active' WHERE status = '';
+
+CREATE TABLE IF NOT EXISTS card_status_changes (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    card_id uuid NOT NULL,
+    from_status text NOT NULL,
+    to_status text NOT NULL,
+    changed_by text NOT NULL,
+    reason text,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_card_status_changes_card_id ON card_status_changes (card_id);
@@ -0,0 +1,2 @@
+-- Cards encrypted with these keys can no longer be read after this runs
+DROP TABLE IF EXISTS data_keys;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS data_keys (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    wrapped_key text NOT NULL,
+    active boolean NOT NULL DEFAULT false,
+    created_at timestamptz,
+    updated_at timestamptz
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS card_reveal_audits (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    card_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    action text NOT NULL,
+    success boolean NOT NULL,
+    reason text,
+    client_ip text,
+    user_agent text,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_card_reveal_audits_card_id ON card_reveal_audits (card_id);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS card_requests (
+    request_uuid uuid PRIMARY KEY,
+    user_token text NOT NULL,
+    card_type text NOT NULL,
+    replaces_card_id uuid,
+    status text NOT NULL,
+    resubmits bigint NOT NULL DEFAULT 0,
+    resubmitted_at timestamptz,
+    issued_card_id uuid,
+    decline_reason text,
+    forwarded_at timestamptz,
+    issued_at timestamptz,
+    declined_at timestamptz,
+    expired_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_card_requests_user_token ON card_requests (user_token);
+CREATE INDEX IF NOT EXISTS idx_card_requests_status ON card_requests (status);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    scope text NOT NULL,
+    key text NOT NULL,
+    request_hash text NOT NULL,
+    status text NOT NULL,
+    status_code bigint,
+    content_type text,
+    response_body text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (scope, key)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_failed_attempts_user_created;
+DROP INDEX IF EXISTS idx_issued_cards_user_created;
@@ -0,0 +1,3 @@
+-- Keyset pagination of a citizen's cards and failed attempts
+CREATE INDEX IF NOT EXISTS idx_issued_cards_user_created ON issued_cards (user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_failed_attempts_user_created ON failed_attempts (user_id, created_at, id);
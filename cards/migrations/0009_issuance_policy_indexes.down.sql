@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_issued_cards_user_token;
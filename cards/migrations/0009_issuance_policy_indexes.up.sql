@@ -0,0 +1,2 @@
+-- Issuance policy counts cards by user token
+CREATE INDEX IF NOT EXISTS idx_issued_cards_user_token ON issued_cards (user_token, card_type);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_erasures;
+ALTER TABLE users DROP COLUMN IF EXISTS erased_at;
@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS erased_at timestamptz;
+
+CREATE TABLE IF NOT EXISTS user_erasures (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid NOT NULL,
+    reason text NOT NULL,
+    requested_by text NOT NULL,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_user_erasures_user_id ON user_erasures (user_id);
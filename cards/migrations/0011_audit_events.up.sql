@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+    sequence bigint PRIMARY KEY,
+    actor text NOT NULL,
+    action text NOT NULL,
+    subject_type text NOT NULL,
+    subject_id text NOT NULL,
+    before text,
+    after text,
+    request_id text,
+    created_at timestamptz NOT NULL,
+    prev_hash text NOT NULL,
+    hash text NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_subject ON audit_events (subject_type, subject_id, sequence);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events (actor, sequence);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action, sequence);
+CREATE INDEX IF NOT EXISTS idx_audit_events_request_id ON audit_events (request_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+
+-- The audit log is append-only, rows can only be removed by dropping the table
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS card_pins (
+    card_id uuid PRIMARY KEY,
+    pin_hash text NOT NULL,
+    failed_attempts integer NOT NULL DEFAULT 0,
+    locked_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    CONSTRAINT fk_card_pins_card FOREIGN KEY (card_id) REFERENCES issued_cards (id)
+);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS card_controls (
+    card_id uuid PRIMARY KEY,
+    per_transaction_limit bigint,
+    daily_limit bigint,
+    monthly_limit bigint,
+    allowed_countries jsonb NOT NULL DEFAULT '[]',
+    allowed_mccs jsonb NOT NULL DEFAULT '[]',
+    blocked_mccs jsonb NOT NULL DEFAULT '[]',
+    online_enabled boolean NOT NULL DEFAULT true,
+    atm_enabled boolean NOT NULL DEFAULT true,
+    created_at timestamptz,
+    updated_at timestamptz,
+    CONSTRAINT fk_card_controls_card FOREIGN KEY (card_id) REFERENCES issued_cards (id),
+    CONSTRAINT chk_card_controls_limits CHECK (
+        (per_transaction_limit IS NULL OR per_transaction_limit > 0)
+        AND (daily_limit IS NULL OR daily_limit > 0)
+        AND (monthly_limit IS NULL OR monthly_limit > 0)
+    )
+);
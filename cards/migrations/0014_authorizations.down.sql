@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS ledger_transactions;
+DROP TABLE IF EXISTS card_authorizations;
+DROP FUNCTION IF EXISTS ledger_append_only();
+DROP INDEX IF EXISTS idx_issued_cards_pan_fingerprint;
+ALTER TABLE issued_cards DROP COLUMN IF EXISTS pan_fingerprint;
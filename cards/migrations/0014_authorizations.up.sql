@@ -0,0 +1,64 @@
+ALTER TABLE issued_cards ADD COLUMN IF NOT EXISTS pan_fingerprint text;
+CREATE INDEX IF NOT EXISTS idx_issued_cards_pan_fingerprint ON issued_cards (pan_fingerprint);
+
+CREATE TABLE IF NOT EXISTS card_authorizations (
+    id uuid PRIMARY KEY,
+    card_id uuid,
+    amount bigint NOT NULL,
+    currency text NOT NULL,
+    channel text NOT NULL,
+    merchant_name text NOT NULL,
+    merchant_mcc text NOT NULL,
+    merchant_country text NOT NULL,
+    status text NOT NULL,
+    reason_code text NOT NULL,
+    created_at timestamptz,
+    CONSTRAINT fk_card_authorizations_card FOREIGN KEY (card_id) REFERENCES issued_cards (id)
+);
+CREATE INDEX IF NOT EXISTS idx_card_authorizations_card_created ON card_authorizations (card_id, created_at);
+
+CREATE TABLE IF NOT EXISTS ledger_transactions (
+    id uuid PRIMARY KEY,
+    card_id uuid NOT NULL,
+    type text NOT NULL,
+    authorization_id uuid,
+    amount bigint NOT NULL,
+    currency text NOT NULL,
+    description text NOT NULL,
+    created_at timestamptz,
+    CONSTRAINT fk_ledger_transactions_card FOREIGN KEY (card_id) REFERENCES issued_cards (id),
+    CONSTRAINT fk_ledger_transactions_authorization FOREIGN KEY (authorization_id) REFERENCES card_authorizations (id)
+);
+CREATE INDEX IF NOT EXISTS idx_ledger_transactions_card_created ON ledger_transactions (card_id, created_at, id);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id bigserial PRIMARY KEY,
+    transaction_id uuid NOT NULL,
+    account text NOT NULL,
+    direction text NOT NULL,
+    amount bigint NOT NULL,
+    currency text NOT NULL,
+    created_at timestamptz,
+    CONSTRAINT fk_ledger_entries_transaction FOREIGN KEY (transaction_id) REFERENCES ledger_transactions (id),
+    CONSTRAINT chk_ledger_entries_direction CHECK (direction IN ('debit', 'credit')),
+    CONSTRAINT chk_ledger_entries_amount CHECK (amount > 0)
+);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_transaction ON ledger_entries (transaction_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_account ON ledger_entries (account);
+
+-- Ledger rows are never changed, a correction is a new transaction
+CREATE OR REPLACE FUNCTION ledger_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ledger_transactions_append_only ON ledger_transactions;
+CREATE TRIGGER ledger_transactions_append_only
+    BEFORE UPDATE OR DELETE ON ledger_transactions
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
+
+DROP TRIGGER IF EXISTS ledger_entries_append_only ON ledger_entries;
+CREATE TRIGGER ledger_entries_append_only
+    BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
@@ -0,0 +1,3 @@
+ALTER TABLE card_authorizations DROP COLUMN IF EXISTS available_balance;
+DROP TABLE IF EXISTS prepaid_balance_changes;
+DROP TABLE IF EXISTS prepaid_accounts;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS prepaid_accounts (
+    card_id uuid PRIMARY KEY,
+    balance bigint NOT NULL DEFAULT 0,
+    currency text NOT NULL,
+    version bigint NOT NULL DEFAULT 0,
+    created_at timestamptz,
+    updated_at timestamptz,
+    CONSTRAINT fk_prepaid_accounts_card FOREIGN KEY (card_id) REFERENCES issued_cards (id),
+    CONSTRAINT chk_prepaid_accounts_balance CHECK (balance >= 0)
+);
+
+CREATE TABLE IF NOT EXISTS prepaid_balance_changes (
+    id uuid PRIMARY KEY,
+    card_id uuid NOT NULL,
+    type text NOT NULL,
+    amount bigint NOT NULL,
+    currency text NOT NULL,
+    balance_after bigint NOT NULL,
+    version bigint NOT NULL,
+    ledger_transaction_id uuid NOT NULL,
+    created_at timestamptz,
+    CONSTRAINT fk_prepaid_balance_changes_account FOREIGN KEY (card_id) REFERENCES prepaid_accounts (card_id),
+    CONSTRAINT fk_prepaid_balance_changes_ledger_transaction FOREIGN KEY (ledger_transaction_id) REFERENCES ledger_transactions (id),
+    CONSTRAINT uq_prepaid_balance_changes_version UNIQUE (card_id, version)
+);
+CREATE INDEX IF NOT EXISTS idx_prepaid_balance_changes_card_created ON prepaid_balance_changes (card_id, created_at, id);
+
+ALTER TABLE card_authorizations ADD COLUMN IF NOT EXISTS available_balance bigint;
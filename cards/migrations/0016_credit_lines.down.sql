@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS credit_statements;
+DROP TABLE IF EXISTS credit_lines;
@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS credit_lines (
+    card_id uuid PRIMARY KEY,
+    credit_limit bigint NOT NULL,
+    apr_basis_points integer NOT NULL,
+    balance bigint NOT NULL DEFAULT 0,
+    cycle_purchases bigint NOT NULL DEFAULT 0,
+    cycle_refunds bigint NOT NULL DEFAULT 0,
+    cycle_payments bigint NOT NULL DEFAULT 0,
+    cycle_start timestamptz NOT NULL,
+    next_statement_at timestamptz NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    CONSTRAINT fk_credit_lines_card FOREIGN KEY (card_id) REFERENCES issued_cards (id),
+    CONSTRAINT chk_credit_lines_limit CHECK (credit_limit > 0),
+    CONSTRAINT chk_credit_lines_apr CHECK (apr_basis_points BETWEEN 0 AND 10000),
+    CONSTRAINT chk_credit_lines_balance CHECK (balance <= credit_limit)
+);
+CREATE INDEX IF NOT EXISTS idx_credit_lines_next_statement_at ON credit_lines (next_statement_at);
+
+CREATE TABLE IF NOT EXISTS credit_statements (
+    id uuid PRIMARY KEY,
+    card_id uuid NOT NULL,
+    period_start timestamptz NOT NULL,
+    period_end timestamptz NOT NULL,
+    currency text NOT NULL,
+    credit_limit bigint NOT NULL,
+    apr_basis_points integer NOT NULL,
+    opening_balance bigint NOT NULL,
+    purchases bigint NOT NULL,
+    refunds bigint NOT NULL,
+    payments bigint NOT NULL,
+    interest bigint NOT NULL,
+    closing_balance bigint NOT NULL,
+    minimum_payment bigint NOT NULL,
+    due_date date NOT NULL,
+    paid_amount bigint NOT NULL DEFAULT 0,
+    status text NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    CONSTRAINT fk_credit_statements_credit_line FOREIGN KEY (card_id) REFERENCES credit_lines (card_id),
+    CONSTRAINT uq_credit_statements_period UNIQUE (card_id, period_end),
+    CONSTRAINT chk_credit_statements_status CHECK (status IN ('open', 'minimum_paid', 'paid'))
+);
+CREATE INDEX IF NOT EXISTS idx_credit_statements_card_created ON credit_statements (card_id, created_at, id);
+
+-- Credit cards issued before credit lines existed get the default line, their first cycle starting now
+INSERT INTO credit_lines (card_id, credit_limit, apr_basis_points, cycle_start, next_statement_at, created_at, updated_at)
+SELECT id, 50000, 2499, now(), now() + interval '1 month', now(), now()
+FROM issued_cards
+WHERE card_type = 'credit'
+ON CONFLICT (card_id) DO NOTHING;
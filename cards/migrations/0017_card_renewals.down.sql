@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_card_requests_replaces_card_id;
+DROP INDEX IF EXISTS idx_issued_cards_renewal;
@@ -0,0 +1,3 @@
+-- The renewal job looks for cards in use that expire soon and have no request superseding them
+CREATE INDEX IF NOT EXISTS idx_issued_cards_renewal ON issued_cards (expiry_date, id) WHERE status IN ('active', 'blocked');
+CREATE INDEX IF NOT EXISTS idx_card_requests_replaces_card_id ON card_requests (replaces_card_id);
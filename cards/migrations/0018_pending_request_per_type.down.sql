@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_card_requests_pending_per_type;
@@ -0,0 +1,2 @@
+-- A user can have one pending request per card type, concurrent submissions cannot both be stored
+CREATE UNIQUE INDEX IF NOT EXISTS idx_card_requests_pending_per_type ON card_requests (user_token, card_type) WHERE status IN ('submitted', 'forwarded');
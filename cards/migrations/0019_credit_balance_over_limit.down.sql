@@ -0,0 +1,3 @@
+ALTER TABLE credit_lines DROP CONSTRAINT IF EXISTS chk_credit_lines_balance;
+-- NOT VALID, lines already over the limit would otherwise block the rollback
+ALTER TABLE credit_lines ADD CONSTRAINT chk_credit_lines_balance CHECK (balance <= credit_limit) NOT VALID;
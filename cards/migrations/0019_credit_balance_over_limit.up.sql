@@ -0,0 +1,3 @@
+-- Interest is charged on top of the balance, so a card at its limit can owe more than the limit.
+-- Purchases are still held to the limit when they are authorized.
+ALTER TABLE credit_lines DROP CONSTRAINT IF EXISTS chk_credit_lines_balance;
@@ -0,0 +1,5 @@
+-- Replicas that created their first data key at the same time may have left several active, keep the newest
+UPDATE data_keys SET active = false
+WHERE active AND id <> (SELECT id FROM data_keys WHERE active ORDER BY created_at DESC, id DESC LIMIT 1);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_data_keys_single_active ON data_keys (active) WHERE active;
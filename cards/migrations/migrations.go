@@ -0,0 +1,8 @@
+﻿// Package migrations embeds the numbered SQL files that build the cards database schema.
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var Files embed.FS
@@ -0,0 +1,68 @@
+﻿package models
+
+import "time"
+
+// Deleted user filters for the admin user search
+const (
+	UserDeletedExclude = "exclude"
+	UserDeletedInclude = "include"
+	UserDeletedOnly    = "only"
+)
+
+// UserSearchQuery filters and pages the admin user search. CardType and Status of the
+// embedded history query are not used.
+type UserSearchQuery struct {
+	HistoryQuery
+	// Matched against the name, the last name or both, case insensitive
+	Name        string
+	CitizenID   string
+	CountryCode string
+	Deleted     string
+}
+
+// AdminUser represents a user as shown to administrators, without its token
+type AdminUser struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Lastname    string     `json:"lastname"`
+	BirthDate   string     `json:"birth_date"`
+	CountryCode string     `json:"country_code"`
+	CitizenID   string     `json:"citizen_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	ErasedAt    *time.Time `json:"erased_at,omitempty"`
+}
+
+// NewAdminUser converts a user record to its admin form
+func NewAdminUser(userRecord UserRecord) AdminUser {
+	user := AdminUser{
+		ID:          userRecord.ID,
+		Name:        userRecord.Name,
+		Lastname:    userRecord.Lastname,
+		BirthDate:   userRecord.BirthDate,
+		CountryCode: userRecord.CountryCode,
+		CitizenID:   userRecord.CitizenID,
+		CreatedAt:   userRecord.CreatedAt,
+		UpdatedAt:   userRecord.UpdatedAt,
+		ErasedAt:    userRecord.ErasedAt,
+	}
+	if userRecord.DeletedAt.Valid {
+		deletedAt := userRecord.DeletedAt.Time
+		user.DeletedAt = &deletedAt
+	}
+	return user
+}
+
+// UserPage is a page of the admin user search
+type UserPage struct {
+	Users      []AdminUser `json:"users"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// AdminUserDetails represents a user with the first page of their cards and failed attempts
+type AdminUserDetails struct {
+	User     AdminUser         `json:"user"`
+	Cards    CardPage          `json:"cards"`
+	Attempts FailedAttemptPage `json:"attempts"`
+}
@@ -0,0 +1,124 @@
+﻿package models
+
+import "time"
+
+// Audit actors other than users, which are recorded as "user:<user_id>"
+const (
+	AuditActorAdmin      = "admin"
+	AuditActorIssuer     = "issuer"
+	AuditActorAnonymous  = "anonymous"
+	AuditActorReconciler = "system:reconciler"
+	AuditActorOutbox     = "system:outbox"
+	AuditActorNetwork    = "network"
+	AuditActorStatements = "system:statements"
+	AuditActorRenewals   = "system:renewals"
+)
+
+// Audit subject types
+const (
+	AuditSubjectUser          = "user"
+	AuditSubjectCard          = "card"
+	AuditSubjectCardRequest   = "card_request"
+	AuditSubjectAuditLog      = "audit_log"
+	AuditSubjectAuthorization = "authorization"
+	AuditSubjectStatement     = "statement"
+)
+
+// Audit actions, state changes first and sensitive reads after
+const (
+	AuditActionUserRegistered         = "user.registered"
+	AuditActionUserDeleted            = "user.deleted"
+	AuditActionUserRestored           = "user.restored"
+	AuditActionUserSessionExpired     = "user.session_expired"
+	AuditActionUserErased             = "user.erased"
+	AuditActionCardRequestSubmitted   = "card_request.submitted"
+	AuditActionCardRequestForwarded   = "card_request.forwarded"
+	AuditActionCardRequestResubmitted = "card_request.resubmitted"
+	AuditActionCardRequestDeclined    = "card_request.declined"
+	AuditActionCardRequestExpired     = "card_request.expired"
+	AuditActionCardIssued             = "card.issued"
+	AuditActionCardStatusChanged      = "card.status_changed"
+	AuditActionCardSupersedeSkipped   = "card.supersede_skipped"
+	AuditActionCardRevealChallenged   = "card.reveal_challenged"
+	AuditActionCardPINSet             = "card.pin_set"
+	AuditActionCardPINChanged         = "card.pin_changed"
+	AuditActionCardPINVerified        = "card.pin_verified"
+	AuditActionCardPINUnlocked        = "card.pin_unlocked"
+	AuditActionCardControlsUpdated    = "card.controls_updated"
+	AuditActionCardControlsDeleted    = "card.controls_deleted"
+	AuditActionCardAuthorized         = "card.authorized"
+	AuditActionCardRefunded           = "card.refunded"
+	AuditActionPrepaidToppedUp        = "card.prepaid_topped_up"
+	AuditActionPrepaidWithdrawn       = "card.prepaid_withdrawn"
+	AuditActionStatementGenerated     = "statement.generated"
+	AuditActionStatementPaid          = "statement.paid"
+
+	AuditActionCardRevealed         = "card.revealed"
+	AuditActionCardsListed          = "cards.listed"
+	AuditActionBalanceViewed        = "card.balance_viewed"
+	AuditActionTransactionsListed   = "card.transactions_listed"
+	AuditActionPrepaidHistoryListed = "card.prepaid_history_listed"
+	AuditActionStatementsListed     = "card.statements_listed"
+	AuditActionStatementViewed      = "statement.viewed"
+	AuditActionAttemptsListed       = "attempts.listed"
+	AuditActionUsersSearched        = "users.searched"
+	AuditActionUserViewed           = "user.viewed"
+	AuditActionUserExported         = "user.exported"
+	AuditActionAuditLogQueried      = "audit_log.queried"
+	AuditActionAuditChainVerified   = "audit_log.verified"
+)
+
+// AuditEventRecord represents a state change or sensitive read in the append-only audit log.
+// Every event holds the hash of the previous one, so editing or removing a row breaks the chain.
+// Before and After hold JSON snapshots of identifiers and statuses, never personal data.
+type AuditEventRecord struct {
+	Sequence    int64     `json:"sequence" gorm:"primaryKey;autoIncrement:false"`
+	Actor       string    `json:"actor" gorm:"not null"`
+	Action      string    `json:"action" gorm:"not null"`
+	SubjectType string    `json:"subject_type" gorm:"not null"`
+	SubjectID   string    `json:"subject_id" gorm:"not null"`
+	Before      string    `json:"before,omitempty" gorm:"type:text"`
+	After       string    `json:"after,omitempty" gorm:"type:text"`
+	RequestID   string    `json:"request_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at" gorm:"not null"`
+	PrevHash    string    `json:"prev_hash" gorm:"not null"`
+	Hash        string    `json:"hash" gorm:"not null"`
+}
+
+func (AuditEventRecord) TableName() string {
+	return "audit_events"
+}
+
+// AuditEventQuery filters and pages the audit log, ordered by sequence
+type AuditEventQuery struct {
+	Actor       string
+	Action      string
+	SubjectType string
+	SubjectID   string
+	RequestID   string
+	// Created range, CreatedFrom is inclusive and CreatedTo exclusive
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// Oldest first when true, newest first otherwise
+	Ascending bool
+	Limit     int
+	// Sequence after which the page starts, 0 for the first page
+	AfterSequence int64
+}
+
+// AuditEventPage is a page of the audit log
+type AuditEventPage struct {
+	Events     []AuditEventRecord `json:"events"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// AuditChainVerification is the result of checking the hashes of the audit log
+type AuditChainVerification struct {
+	Valid         bool   `json:"valid"`
+	EventsChecked int64  `json:"events_checked"`
+	LastSequence  int64  `json:"last_sequence"`
+	LastHash      string `json:"last_hash,omitempty"`
+	// First event that does not match the chain, only set when the chain is broken
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
@@ -0,0 +1,89 @@
+﻿package models
+
+import "time"
+
+// Authorization statuses
+const (
+	AuthorizationStatusApproved = "approved"
+	AuthorizationStatusDeclined = "declined"
+)
+
+// Authorization reason codes, a declined transaction broken by a spending control
+// is reported with the control rule instead, e.g. daily_limit
+const (
+	AuthorizationReasonApproved             = "approved"
+	AuthorizationReasonInvalidCard          = "invalid_card"
+	AuthorizationReasonInvalidExpiry        = "invalid_expiry"
+	AuthorizationReasonInvalidCVV           = "invalid_cvv"
+	AuthorizationReasonCardNotActive        = "card_not_active"
+	AuthorizationReasonExpiredCard          = "expired_card"
+	AuthorizationReasonCurrencyNotSupported = "currency_not_supported"
+	AuthorizationReasonInsufficientFunds    = "insufficient_funds"
+	AuthorizationReasonCreditLimitExceeded  = "credit_limit_exceeded"
+)
+
+// AuthorizationRequest represents a card network asking to authorize a transaction.
+// The amount is in minor currency units and the expiry date is MM/YY, YYYY-MM or YYYY-MM-DD.
+type AuthorizationRequest struct {
+	PAN        string                `json:"pan" binding:"required"`
+	CVV        string                `json:"cvv" binding:"required"`
+	ExpiryDate string                `json:"expiry_date" binding:"required"`
+	Amount     int64                 `json:"amount"`
+	Currency   string                `json:"currency"`
+	Channel    string                `json:"channel"`
+	Merchant   AuthorizationMerchant `json:"merchant"`
+}
+
+// AuthorizationMerchant describes the merchant a transaction is made at
+type AuthorizationMerchant struct {
+	Name    string `json:"name"`
+	MCC     string `json:"mcc"`
+	Country string `json:"country"`
+}
+
+// CardCredentials are the card details an authorization is checked with, the expiry as YYYY-MM
+type CardCredentials struct {
+	PAN         string
+	CVV         string
+	ExpiryMonth string
+}
+
+// CardAuthorizationRecord represents the outcome of an authorization in the database.
+// CardID is empty when the PAN matched no card, the PAN itself is never stored.
+type CardAuthorizationRecord struct {
+	ID              string  `json:"authorization_id" gorm:"type:uuid;primary_key"`
+	CardID          *string `json:"card_id,omitempty" gorm:"type:uuid;index"`
+	Amount          int64   `json:"amount" gorm:"not null"`
+	Currency        string  `json:"currency" gorm:"not null"`
+	Channel         string  `json:"channel" gorm:"not null"`
+	MerchantName    string  `json:"merchant_name" gorm:"not null"`
+	MerchantMCC     string  `json:"merchant_mcc" gorm:"column:merchant_mcc;not null"`
+	MerchantCountry string  `json:"merchant_country" gorm:"not null"`
+	Status          string  `json:"status" gorm:"not null"`
+	ReasonCode      string  `json:"reason_code" gorm:"not null"`
+	// Balance left on a prepaid card, or credit left on a credit card, once the authorization is decided
+	AvailableBalance *int64    `json:"available_balance,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+func (CardAuthorizationRecord) TableName() string {
+	return "card_authorizations"
+}
+
+// CardAuthorizationPage is a page of the authorizations of a card
+type CardAuthorizationPage struct {
+	Authorizations []CardAuthorizationRecord `json:"authorizations"`
+	NextCursor     string                    `json:"next_cursor,omitempty"`
+}
+
+// AuthorizationResponse is the decision returned to the card network
+type AuthorizationResponse struct {
+	AuthorizationID string `json:"authorization_id"`
+	Status          string `json:"status"`
+	ReasonCode      string `json:"reason_code"`
+	Message         string `json:"message,omitempty"`
+	Amount          int64  `json:"amount"`
+	Currency        string `json:"currency"`
+	// Only set for prepaid and credit cards
+	AvailableBalance *int64 `json:"available_balance,omitempty"`
+}
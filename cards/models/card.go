@@ -13,6 +13,8 @@ type IssuedCard struct {
 	CVV        string `json:"cvv"`
 	ExpiryDate string `json:"expiry_date"`
 	CardType   string `json:"card_type"`
+	// Only set for credit cards
+	CreditLine *CreditLine `json:"credit_line,omitempty"`
 }
 
 // IssuerResponse represents the response from the issuer
@@ -34,8 +36,16 @@ type WebhookEvent struct {
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
 }
 
+// NotificationEvent represents a notification other than an issuance result
+type NotificationEvent struct {
+	Type    string            `json:"type"`
+	Message string            `json:"message"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
 // NotificationRequest represents the request to notifications service
 type NotificationRequest struct {
-	UserToken      string         `json:"user_token"`
-	IssuerResponse IssuerResponse `json:"issuer_response"`
+	UserToken      string             `json:"user_token"`
+	IssuerResponse *IssuerResponse    `json:"issuer_response,omitempty"`
+	Event          *NotificationEvent `json:"event,omitempty"`
 }
@@ -0,0 +1,115 @@
+﻿package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Channels a card transaction can be made through
+const (
+	TransactionChannelPOS    = "pos"
+	TransactionChannelOnline = "online"
+	TransactionChannelATM    = "atm"
+)
+
+// CardControlsRequest represents the request from frontend to set the spending controls of a card.
+// Limits are in minor currency units and a missing limit or an empty list does not restrict anything.
+// Online and ATM use stay enabled unless they are turned off.
+type CardControlsRequest struct {
+	UserToken           string   `json:"user_token" binding:"required"`
+	PerTransactionLimit *int64   `json:"per_transaction_limit"`
+	DailyLimit          *int64   `json:"daily_limit"`
+	MonthlyLimit        *int64   `json:"monthly_limit"`
+	AllowedCountries    []string `json:"allowed_countries"`
+	AllowedMCCs         []string `json:"allowed_mccs"`
+	BlockedMCCs         []string `json:"blocked_mccs"`
+	OnlineEnabled       *bool    `json:"online_enabled"`
+	ATMEnabled          *bool    `json:"atm_enabled"`
+}
+
+// StringList is a list of strings stored as a JSON array
+type StringList []string
+
+// Value encodes the list as a JSON array, an empty list included
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan decodes a JSON array read from the database
+func (l *StringList) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*l = StringList{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", value)
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// CardControlsRecord represents the spending controls of a card in the database
+type CardControlsRecord struct {
+	CardID              string     `json:"card_id" gorm:"type:uuid;primary_key"`
+	PerTransactionLimit *int64     `json:"per_transaction_limit"`
+	DailyLimit          *int64     `json:"daily_limit"`
+	MonthlyLimit        *int64     `json:"monthly_limit"`
+	AllowedCountries    StringList `json:"allowed_countries" gorm:"type:jsonb;not null"`
+	AllowedMCCs         StringList `json:"allowed_mccs" gorm:"column:allowed_mccs;type:jsonb;not null"`
+	BlockedMCCs         StringList `json:"blocked_mccs" gorm:"column:blocked_mccs;type:jsonb;not null"`
+	OnlineEnabled       bool       `json:"online_enabled" gorm:"not null"`
+	ATMEnabled          bool       `json:"atm_enabled" gorm:"column:atm_enabled;not null"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+func (CardControlsRecord) TableName() string {
+	return "card_controls"
+}
+
+// DefaultCardControls returns the controls of a card nobody has restricted
+func DefaultCardControls(cardID string) CardControlsRecord {
+	return CardControlsRecord{
+		CardID:           cardID,
+		AllowedCountries: StringList{},
+		AllowedMCCs:      StringList{},
+		BlockedMCCs:      StringList{},
+		OnlineEnabled:    true,
+		ATMEnabled:       true,
+	}
+}
+
+// CardTransaction describes a transaction checked against the controls of a card
+type CardTransaction struct {
+	Amount          int64
+	Currency        string
+	MerchantName    string
+	MerchantCountry string
+	MCC             string
+	Channel         string
+}
+
+// CardSpending is what a card already spent in the current day and month, in minor currency units
+type CardSpending struct {
+	Today     int64
+	ThisMonth int64
+}
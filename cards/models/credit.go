@@ -0,0 +1,101 @@
+﻿package models
+
+import "time"
+
+// CardTypeCredit is the card type that spends from a credit line
+const CardTypeCredit = "credit"
+
+// Statement statuses
+const (
+	StatementStatusOpen        = "open"
+	StatementStatusMinimumPaid = "minimum_paid"
+	StatementStatusPaid        = "paid"
+)
+
+// CreditLine is the credit line the issuer grants a credit card, the limit in minor currency units
+// and the annual interest rate in basis points
+type CreditLine struct {
+	Limit          int64 `json:"limit"`
+	APRBasisPoints int   `json:"apr_basis_points"`
+}
+
+// CreditPaymentRequest represents the request from frontend to pay a statement, the amount in minor currency units
+type CreditPaymentRequest struct {
+	UserToken string `json:"user_token" binding:"required"`
+	Amount    int64  `json:"amount" binding:"required"`
+}
+
+// CreditLineRecord represents the credit line of a credit card in the database.
+// Balance is what the card owes, the cycle totals are reset when a statement closes the billing cycle.
+// Purchases cannot take the balance over the limit, but interest can.
+type CreditLineRecord struct {
+	CardID          string    `json:"card_id" gorm:"type:uuid;primary_key"`
+	CreditLimit     int64     `json:"credit_limit" gorm:"not null"`
+	APRBasisPoints  int       `json:"apr_basis_points" gorm:"column:apr_basis_points;not null"`
+	Balance         int64     `json:"balance" gorm:"not null"`
+	CyclePurchases  int64     `json:"cycle_purchases" gorm:"not null"`
+	CycleRefunds    int64     `json:"cycle_refunds" gorm:"not null"`
+	CyclePayments   int64     `json:"cycle_payments" gorm:"not null"`
+	CycleStart      time.Time `json:"cycle_start" gorm:"not null"`
+	NextStatementAt time.Time `json:"next_statement_at" gorm:"not null;index"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func (CreditLineRecord) TableName() string {
+	return "credit_lines"
+}
+
+// CreditSummary is the credit line of a card as shown to its owner
+type CreditSummary struct {
+	CreditLineRecord
+	Currency        string `json:"currency"`
+	AvailableCredit int64  `json:"available_credit"`
+}
+
+// CreditStatementRecord represents the statement closing a billing cycle in the database.
+// The closing balance is the opening balance plus purchases and interest minus refunds and payments.
+// PaidAmount counts the payments made against the statement after it closed.
+type CreditStatementRecord struct {
+	ID             string    `json:"statement_id" gorm:"type:uuid;primary_key"`
+	CardID         string    `json:"card_id" gorm:"type:uuid;not null;index"`
+	PeriodStart    time.Time `json:"period_start" gorm:"not null"`
+	PeriodEnd      time.Time `json:"period_end" gorm:"not null"`
+	Currency       string    `json:"currency" gorm:"not null"`
+	CreditLimit    int64     `json:"credit_limit" gorm:"not null"`
+	APRBasisPoints int       `json:"apr_basis_points" gorm:"column:apr_basis_points;not null"`
+	OpeningBalance int64     `json:"opening_balance" gorm:"not null"`
+	Purchases      int64     `json:"purchases" gorm:"not null"`
+	Refunds        int64     `json:"refunds" gorm:"not null"`
+	Payments       int64     `json:"payments" gorm:"not null"`
+	Interest       int64     `json:"interest" gorm:"not null"`
+	ClosingBalance int64     `json:"closing_balance" gorm:"not null"`
+	MinimumPayment int64     `json:"minimum_payment" gorm:"not null"`
+	DueDate        string    `json:"due_date" gorm:"type:date;not null"`
+	PaidAmount     int64     `json:"paid_amount" gorm:"not null"`
+	Status         string    `json:"status" gorm:"not null"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (CreditStatementRecord) TableName() string {
+	return "credit_statements"
+}
+
+// CreditStatement is a statement with the ledger transactions of its billing cycle
+type CreditStatement struct {
+	CreditStatementRecord
+	Transactions []LedgerTransactionRecord `json:"transactions"`
+}
+
+// CreditStatementPage is a page of the statements of a credit card
+type CreditStatementPage struct {
+	Statements []CreditStatementRecord `json:"statements"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+// CreditPaymentResponse is a statement after a payment, with the ledger transaction of the payment
+type CreditPaymentResponse struct {
+	Statement   CreditStatementRecord   `json:"statement"`
+	Transaction LedgerTransactionRecord `json:"transaction"`
+}
@@ -0,0 +1,77 @@
+﻿package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a next_cursor value cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// HistoryQuery filters, sorts and pages the cards or failed attempts of a citizen
+type HistoryQuery struct {
+	CardType string
+	Status   string
+	// Created range, CreatedFrom is inclusive and CreatedTo exclusive
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// Oldest first when true, newest first otherwise
+	Ascending bool
+	Limit     int
+	// Position after which the page starts, nil for the first page
+	After *HistoryCursor
+}
+
+// HistoryCursor is the position of the last item of a page, ordered by creation time and then ID
+type HistoryCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Encode returns the opaque next_cursor value for the position
+func (c HistoryCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID))
+}
+
+// DecodeHistoryCursor parses a next_cursor value returned by a previous page
+func DecodeHistoryCursor(value string) (*HistoryCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, id, ok := strings.Cut(string(decoded), "|")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	parsed, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &HistoryCursor{CreatedAt: parsed, ID: id}, nil
+}
+
+// FailedAttempt represents a declined or expired issue request safe to list
+type FailedAttempt struct {
+	AttemptID     string `json:"attempt_id"`
+	CardType      string `json:"card_type"`
+	Status        string `json:"status"`
+	DeclineReason string `json:"decline_reason"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// CardPage is a page of the cards of a citizen
+type CardPage struct {
+	Cards      []MaskedCard `json:"cards"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// FailedAttemptPage is a page of the failed attempts of a citizen
+type FailedAttemptPage struct {
+	Attempts   []FailedAttempt `json:"attempts"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
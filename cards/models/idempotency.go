@@ -0,0 +1,26 @@
+﻿package models
+
+import "time"
+
+// Idempotency key statuses
+const (
+	IdempotencyStatusInProgress = "in_progress"
+	IdempotencyStatusCompleted  = "completed"
+)
+
+// IdempotencyKeyRecord represents a client supplied Idempotency-Key and the first response sent for it
+type IdempotencyKeyRecord struct {
+	Scope        string    `json:"scope" gorm:"primaryKey"`
+	Key          string    `json:"key" gorm:"primaryKey"`
+	RequestHash  string    `json:"request_hash" gorm:"not null"`
+	Status       string    `json:"status" gorm:"not null"`
+	StatusCode   int       `json:"status_code"`
+	ContentType  string    `json:"content_type"`
+	ResponseBody string    `json:"response_body" gorm:"type:text"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (IdempotencyKeyRecord) TableName() string {
+	return "idempotency_keys"
+}
@@ -0,0 +1,16 @@
+﻿package models
+
+import "time"
+
+// DataKeyRecord represents a data encryption key wrapped by the master key
+type DataKeyRecord struct {
+	ID         string    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	WrappedKey string    `json:"-" gorm:"not null"`
+	Active     bool      `json:"active" gorm:"not null;default:false"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (DataKeyRecord) TableName() string {
+	return "data_keys"
+}
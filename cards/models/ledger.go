@@ -0,0 +1,85 @@
+﻿package models
+
+import "time"
+
+// Ledger entry directions
+const (
+	LedgerDebit  = "debit"
+	LedgerCredit = "credit"
+)
+
+// Ledger transaction types
+const (
+	LedgerTransactionPurchase   = "purchase"
+	LedgerTransactionRefund     = "refund"
+	LedgerTransactionTopUp      = "top_up"
+	LedgerTransactionWithdrawal = "withdrawal"
+	LedgerTransactionPayment    = "payment"
+	LedgerTransactionInterest   = "interest"
+)
+
+// Ledger accounts other than the card accounts
+const (
+	// Owed what cards spend at merchants
+	LedgerAccountMerchantSettlement = "merchant_settlement"
+	// Where prepaid top-ups come from and withdrawals go to
+	LedgerAccountPrepaidFunding = "prepaid_funding"
+	// Where credit card owners pay their statements from
+	LedgerAccountCreditPayments = "credit_payments"
+	// Earns the interest charged on unpaid statement balances
+	LedgerAccountInterestIncome = "interest_income"
+)
+
+// CardLedgerAccount returns the ledger account of a card
+func CardLedgerAccount(cardID string) string {
+	return "card:" + cardID
+}
+
+// LedgerTransactionRecord represents a balanced set of ledger entries in the database
+type LedgerTransactionRecord struct {
+	ID              string              `json:"transaction_id" gorm:"type:uuid;primary_key"`
+	CardID          string              `json:"card_id" gorm:"type:uuid;not null;index"`
+	Type            string              `json:"type" gorm:"not null"`
+	AuthorizationID *string             `json:"authorization_id,omitempty" gorm:"type:uuid"`
+	Amount          int64               `json:"amount" gorm:"not null"`
+	Currency        string              `json:"currency" gorm:"not null"`
+	Description     string              `json:"description" gorm:"not null"`
+	Entries         []LedgerEntryRecord `json:"entries" gorm:"foreignKey:TransactionID"`
+	CreatedAt       time.Time           `json:"created_at"`
+}
+
+func (LedgerTransactionRecord) TableName() string {
+	return "ledger_transactions"
+}
+
+// LedgerEntryRecord represents one side of a ledger transaction in the database, amounts are always positive
+type LedgerEntryRecord struct {
+	ID            int64     `json:"-" gorm:"primary_key;autoIncrement"`
+	TransactionID string    `json:"-" gorm:"type:uuid;not null;index"`
+	Account       string    `json:"account" gorm:"not null;index"`
+	Direction     string    `json:"direction" gorm:"not null"`
+	Amount        int64     `json:"amount" gorm:"not null"`
+	Currency      string    `json:"currency" gorm:"not null"`
+	CreatedAt     time.Time `json:"-"`
+}
+
+func (LedgerEntryRecord) TableName() string {
+	return "ledger_entries"
+}
+
+// CardBalance sums the ledger entries of a card account. Balance is credits minus debits,
+// so a card that only made purchases has a negative balance.
+type CardBalance struct {
+	CardID   string `json:"card_id"`
+	Account  string `json:"account"`
+	Currency string `json:"currency"`
+	Debits   int64  `json:"debits"`
+	Credits  int64  `json:"credits"`
+	Balance  int64  `json:"balance"`
+}
+
+// LedgerTransactionPage is a page of the ledger transactions of a card
+type LedgerTransactionPage struct {
+	Transactions []LedgerTransactionRecord `json:"transactions"`
+	NextCursor   string                    `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,77 @@
+﻿package models
+
+import "time"
+
+// Card statuses
+const (
+	CardStatusActive    = "active"
+	CardStatusBlocked   = "blocked"
+	CardStatusCancelled = "cancelled"
+	CardStatusLost      = "lost"
+	CardStatusStolen    = "stolen"
+	CardStatusReplaced  = "replaced"
+	CardStatusRenewed   = "renewed"
+)
+
+// IsCardStatus reports whether status is a known card status
+func IsCardStatus(status string) bool {
+	switch status {
+	case CardStatusActive, CardStatusBlocked, CardStatusCancelled, CardStatusLost, CardStatusStolen, CardStatusReplaced, CardStatusRenewed:
+		return true
+	}
+	return false
+}
+
+// cardStatusTransitions lists the statuses each card status can move to
+var cardStatusTransitions = map[string][]string{
+	CardStatusActive:  {CardStatusBlocked, CardStatusCancelled, CardStatusLost, CardStatusStolen, CardStatusRenewed},
+	CardStatusBlocked: {CardStatusActive, CardStatusCancelled, CardStatusLost, CardStatusStolen, CardStatusRenewed},
+	CardStatusLost:    {CardStatusReplaced},
+	CardStatusStolen:  {CardStatusReplaced},
+}
+
+// CanTransitionCardStatus reports whether a card can move from one status to another
+func CanTransitionCardStatus(from, to string) bool {
+	for _, allowed := range cardStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// SupersededCardStatus is the status a card moves to when the card issued in its place arrives.
+// Lost and stolen cards are replaced, cards still in use were renewed before they expired.
+func SupersededCardStatus(status string) string {
+	if status == CardStatusLost || status == CardStatusStolen {
+		return CardStatusReplaced
+	}
+	return CardStatusRenewed
+}
+
+// CardStatusChangeRecord represents a card status change in the database
+type CardStatusChangeRecord struct {
+	ID         string    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CardID     string    `json:"card_id" gorm:"type:uuid;not null;index"`
+	FromStatus string    `json:"from_status" gorm:"not null"`
+	ToStatus   string    `json:"to_status" gorm:"not null"`
+	ChangedBy  string    `json:"changed_by" gorm:"not null"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (CardStatusChangeRecord) TableName() string {
+	return "card_status_changes"
+}
+
+// CardStatusChangeRequest represents the request from frontend to change a card status
+type CardStatusChangeRequest struct {
+	UserToken string `json:"user_token" binding:"required"`
+	Reason    string `json:"reason"`
+}
+
+// ReplaceCardRequest represents the request from frontend to replace a lost or stolen card
+type ReplaceCardRequest struct {
+	UserToken string `json:"user_token" binding:"required"`
+	Reason    string `json:"reason" binding:"required,oneof=lost stolen"`
+}
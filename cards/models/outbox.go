@@ -0,0 +1,34 @@
+﻿package models
+
+import "time"
+
+// Outbox message statuses
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusFailed  = "failed"
+)
+
+// Outbox message topics
+const (
+	OutboxTopicIssueRequest = "card.issue_request"
+)
+
+// OutboxMessageRecord represents a message waiting to be delivered to another service
+type OutboxMessageRecord struct {
+	ID            string     `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	AggregateID   string     `json:"aggregate_id" gorm:"not null;index"`
+	Topic         string     `json:"topic" gorm:"not null"`
+	Payload       string     `json:"payload" gorm:"type:jsonb;not null"`
+	Status        string     `json:"status" gorm:"not null;index:idx_outbox_messages_due,priority:1"`
+	Attempts      int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"not null;index:idx_outbox_messages_due,priority:2"`
+	LastError     string     `json:"last_error"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (OutboxMessageRecord) TableName() string {
+	return "outbox_messages"
+}
@@ -0,0 +1,37 @@
+﻿package models
+
+import "time"
+
+// SetPINRequest represents the request from frontend to set the first PIN of a card
+type SetPINRequest struct {
+	UserToken string `json:"user_token" binding:"required"`
+	PIN       string `json:"pin" binding:"required"`
+}
+
+// ChangePINRequest represents the request from frontend to replace the PIN of a card
+type ChangePINRequest struct {
+	UserToken  string `json:"user_token" binding:"required"`
+	CurrentPIN string `json:"current_pin" binding:"required"`
+	NewPIN     string `json:"new_pin" binding:"required"`
+}
+
+// VerifyPINRequest represents the request to check a PIN entered for a card
+type VerifyPINRequest struct {
+	UserToken string `json:"user_token" binding:"required"`
+	PIN       string `json:"pin" binding:"required"`
+}
+
+// CardPINRecord represents the PIN of a card in the database, stored as a bcrypt hash.
+// The PIN locks once FailedAttempts reaches the limit, until an admin unlocks it.
+type CardPINRecord struct {
+	CardID         string     `json:"card_id" gorm:"type:uuid;primary_key"`
+	PINHash        string     `json:"-" gorm:"not null"`
+	FailedAttempts int        `json:"failed_attempts" gorm:"not null;default:0"`
+	LockedAt       *time.Time `json:"locked_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func (CardPINRecord) TableName() string {
+	return "card_pins"
+}
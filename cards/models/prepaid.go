@@ -0,0 +1,71 @@
+﻿package models
+
+import "time"
+
+// CardTypePrepaid is the card type that holds a balance
+const CardTypePrepaid = "prepaid"
+
+// Prepaid balance change types
+const (
+	PrepaidChangeTopUp      = "top_up"
+	PrepaidChangeWithdrawal = "withdrawal"
+	PrepaidChangePurchase   = "purchase"
+	PrepaidChangeRefund     = "refund"
+)
+
+// PrepaidAmountRequest represents the request from frontend to top up or withdraw from a prepaid card,
+// the amount is in minor currency units
+type PrepaidAmountRequest struct {
+	UserToken string `json:"user_token" binding:"required"`
+	Amount    int64  `json:"amount" binding:"required"`
+}
+
+// RefundRequest represents a card network refunding part or all of an approved authorization
+type RefundRequest struct {
+	Amount int64 `json:"amount" binding:"required"`
+}
+
+// RefundResponse is the ledger transaction of a refund, with the balance change when the card is prepaid
+type RefundResponse struct {
+	Transaction   LedgerTransactionRecord     `json:"transaction"`
+	BalanceChange *PrepaidBalanceChangeRecord `json:"balance_change,omitempty"`
+}
+
+// PrepaidAccountRecord represents the balance of a prepaid card in the database.
+// Version grows with every change, a change is only written if the version it read is still current.
+type PrepaidAccountRecord struct {
+	CardID    string    `json:"card_id" gorm:"type:uuid;primary_key"`
+	Balance   int64     `json:"balance" gorm:"not null"`
+	Currency  string    `json:"currency" gorm:"not null"`
+	Version   int64     `json:"version" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (PrepaidAccountRecord) TableName() string {
+	return "prepaid_accounts"
+}
+
+// PrepaidBalanceChangeRecord represents one change of a prepaid balance in the database.
+// Amount is always positive, the type says whether it was added or taken.
+type PrepaidBalanceChangeRecord struct {
+	ID                  string    `json:"change_id" gorm:"type:uuid;primary_key"`
+	CardID              string    `json:"card_id" gorm:"type:uuid;not null;index"`
+	Type                string    `json:"type" gorm:"not null"`
+	Amount              int64     `json:"amount" gorm:"not null"`
+	Currency            string    `json:"currency" gorm:"not null"`
+	BalanceAfter        int64     `json:"balance_after" gorm:"not null"`
+	Version             int64     `json:"version" gorm:"not null"`
+	LedgerTransactionID string    `json:"ledger_transaction_id" gorm:"type:uuid;not null"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+func (PrepaidBalanceChangeRecord) TableName() string {
+	return "prepaid_balance_changes"
+}
+
+// PrepaidBalanceChangePage is a page of the balance history of a prepaid card
+type PrepaidBalanceChangePage struct {
+	Changes    []PrepaidBalanceChangeRecord `json:"changes"`
+	NextCursor string                       `json:"next_cursor,omitempty"`
+}
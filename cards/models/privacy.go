@@ -0,0 +1,91 @@
+﻿package models
+
+import "time"
+
+// UserErasureRecord represents the audit record of an irreversible user erasure
+type UserErasureRecord struct {
+	ID          string    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      string    `json:"user_id" gorm:"type:uuid;not null;index"`
+	Reason      string    `json:"reason" gorm:"not null"`
+	RequestedBy string    `json:"requested_by" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (UserErasureRecord) TableName() string {
+	return "user_erasures"
+}
+
+// EraseCitizenRequest represents the admin request to erase a citizen's personal data
+type EraseCitizenRequest struct {
+	Reason      string `json:"reason" binding:"required"`
+	RequestedBy string `json:"requested_by" binding:"required"`
+	// Must repeat the citizen ID in the path, so an erasure is never sent by mistake
+	ConfirmCitizenID string `json:"confirm_citizen_id" binding:"required"`
+}
+
+// NotificationHistoryEntry represents a notification kept by the notifications service
+type NotificationHistoryEntry struct {
+	Type        string    `json:"type"`
+	RequestUUID string    `json:"request_uuid,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	Delivered   bool      `json:"delivered"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ExportedCardRequest represents a card request in a citizen export, without the user token
+type ExportedCardRequest struct {
+	RequestUUID    string     `json:"request_uuid"`
+	CardType       string     `json:"card_type"`
+	ReplacesCardID *string    `json:"replaces_card_id,omitempty"`
+	Status         string     `json:"status"`
+	Resubmits      int        `json:"resubmits"`
+	ResubmittedAt  *time.Time `json:"resubmitted_at,omitempty"`
+	IssuedCardID   *string    `json:"issued_card_id,omitempty"`
+	DeclineReason  string     `json:"decline_reason,omitempty"`
+	ForwardedAt    *time.Time `json:"forwarded_at,omitempty"`
+	IssuedAt       *time.Time `json:"issued_at,omitempty"`
+	DeclinedAt     *time.Time `json:"declined_at,omitempty"`
+	ExpiredAt      *time.Time `json:"expired_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// NewExportedCardRequest converts a card request record to its export form
+func NewExportedCardRequest(request CardRequestRecord) ExportedCardRequest {
+	return ExportedCardRequest{
+		RequestUUID:    request.RequestUUID,
+		CardType:       request.CardType,
+		ReplacesCardID: request.ReplacesCardID,
+		Status:         request.Status,
+		Resubmits:      request.Resubmits,
+		ResubmittedAt:  request.ResubmittedAt,
+		IssuedCardID:   request.IssuedCardID,
+		DeclineReason:  request.DeclineReason,
+		ForwardedAt:    request.ForwardedAt,
+		IssuedAt:       request.IssuedAt,
+		DeclinedAt:     request.DeclinedAt,
+		ExpiredAt:      request.ExpiredAt,
+		CreatedAt:      request.CreatedAt,
+		UpdatedAt:      request.UpdatedAt,
+	}
+}
+
+// CitizenExport represents everything held about a citizen.
+// The user token is a credential, so no section carries it, and PINs are exported without their hash.
+type CitizenExport struct {
+	ExportedAt            time.Time                    `json:"exported_at"`
+	User                  AdminUser                    `json:"user"`
+	IssuedCards           []MaskedCard                 `json:"issued_cards"`
+	FailedAttempts        []FailedAttempt              `json:"failed_attempts"`
+	CardRequests          []ExportedCardRequest        `json:"card_requests"`
+	CardPINs              []CardPINRecord              `json:"card_pins"`
+	CardControls          []CardControlsRecord         `json:"card_controls"`
+	Authorizations        []CardAuthorizationRecord    `json:"authorizations"`
+	LedgerTransactions    []LedgerTransactionRecord    `json:"ledger_transactions"`
+	PrepaidAccounts       []PrepaidAccountRecord       `json:"prepaid_accounts"`
+	PrepaidBalanceChanges []PrepaidBalanceChangeRecord `json:"prepaid_balance_changes"`
+	CreditLines           []CreditLineRecord           `json:"credit_lines"`
+	CreditStatements      []CreditStatementRecord      `json:"credit_statements"`
+	RedisKeys             map[string]interface{}       `json:"redis_keys"`
+	Notifications         []NotificationHistoryEntry   `json:"notifications"`
+}
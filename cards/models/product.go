@@ -0,0 +1,42 @@
+﻿package models
+
+// CardProduct is a card product of the issuer's catalog, amounts in minor units of the fee currency
+type CardProduct struct {
+	Type        string                 `json:"type"`
+	Name        string                 `json:"name"`
+	Network     string                 `json:"network"`
+	Eligibility CardProductEligibility `json:"eligibility"`
+	Fees        CardProductFees        `json:"fees"`
+	Limits      CardProductLimits      `json:"limits"`
+}
+
+// CardProductEligibility tells who can get a card product, the minimum age by country code
+type CardProductEligibility struct {
+	Summary    string         `json:"summary"`
+	Countries  []string       `json:"countries"`
+	MinimumAge map[string]int `json:"minimum_age"`
+}
+
+// CardProductFees are the fees the issuer charges for a card product
+type CardProductFees struct {
+	Currency                      string `json:"currency"`
+	Issuance                      int64  `json:"issuance"`
+	Annual                        int64  `json:"annual"`
+	ATMWithdrawal                 int64  `json:"atm_withdrawal"`
+	Replacement                   int64  `json:"replacement"`
+	ForeignTransactionBasisPoints int    `json:"foreign_transaction_basis_points"`
+}
+
+// CardProductLimits are the spending limits of a card product, the credit and balance limits only apply to some types
+type CardProductLimits struct {
+	DailySpend     int64 `json:"daily_spend"`
+	MonthlySpend   int64 `json:"monthly_spend"`
+	CreditLimitMin int64 `json:"credit_limit_min,omitempty"`
+	CreditLimitMax int64 `json:"credit_limit_max,omitempty"`
+	MaxBalance     int64 `json:"max_balance,omitempty"`
+}
+
+// CardProductCatalog is the list of card products the issuer offers
+type CardProductCatalog struct {
+	Products []CardProduct `json:"products"`
+}
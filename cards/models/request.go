@@ -1,5 +1,16 @@
 ﻿package models
 
+import "time"
+
+// Card request statuses
+const (
+	CardRequestStatusSubmitted = "submitted"
+	CardRequestStatusForwarded = "forwarded"
+	CardRequestStatusIssued    = "issued"
+	CardRequestStatusDeclined  = "declined"
+	CardRequestStatusExpired   = "expired"
+)
+
 // IssueRequest represents the request to issue a card
 type IssueRequest struct {
 	Name            string `json:"name"`
@@ -22,4 +33,37 @@ type RequestData struct {
 	User      User   `json:"user"`
 	CardType  string `json:"card_type"`
 	UserToken string `json:"user_token"`
+	// Card to be replaced by the issued card, if any
+	ReplacesCardID string `json:"replaces_card_id,omitempty"`
+}
+
+// CardRequestRecord represents a card issue request in the database
+type CardRequestRecord struct {
+	RequestUUID    string  `json:"request_uuid" gorm:"type:uuid;primary_key"`
+	UserToken      string  `json:"user_token" gorm:"not null;index"`
+	CardType       string  `json:"card_type" gorm:"not null"`
+	ReplacesCardID *string `json:"replaces_card_id,omitempty" gorm:"type:uuid"`
+	Status         string  `json:"status" gorm:"not null;index"`
+	// Times the request was sent again after getting no answer
+	Resubmits     int        `json:"resubmits" gorm:"not null;default:0"`
+	ResubmittedAt *time.Time `json:"resubmitted_at,omitempty"`
+	// Outcome of the request, set once the issuer answers
+	IssuedCardID  *string `json:"issued_card_id,omitempty" gorm:"type:uuid"`
+	DeclineReason string  `json:"decline_reason,omitempty"`
+	// Lifecycle timestamps, submission is CreatedAt
+	ForwardedAt *time.Time `json:"forwarded_at,omitempty"`
+	IssuedAt    *time.Time `json:"issued_at,omitempty"`
+	DeclinedAt  *time.Time `json:"declined_at,omitempty"`
+	ExpiredAt   *time.Time `json:"expired_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// IsPending reports whether the request is still waiting for the issuer
+func (r CardRequestRecord) IsPending() bool {
+	return r.Status == CardRequestStatusSubmitted || r.Status == CardRequestStatusForwarded
+}
+
+func (CardRequestRecord) TableName() string {
+	return "card_requests"
 }
@@ -0,0 +1,43 @@
+﻿package models
+
+import "time"
+
+// Reveal audit actions
+const (
+	RevealActionChallenge = "challenge"
+	RevealActionReveal    = "reveal"
+)
+
+// RevealChallengeRequest represents the request from frontend to receive a one-time code
+type RevealChallengeRequest struct {
+	UserToken string `json:"user_token" binding:"required"`
+}
+
+// RevealCardRequest represents the request from frontend to reveal the full card details
+type RevealCardRequest struct {
+	UserToken string `json:"user_token" binding:"required"`
+	Code      string `json:"code" binding:"required"`
+}
+
+// RevealChallenge represents the one-time code stored in Redis for a card
+type RevealChallenge struct {
+	CodeHash  string `json:"code_hash"`
+	UserToken string `json:"user_token"`
+}
+
+// CardRevealAuditRecord represents an attempt to reveal card details in the database
+type CardRevealAuditRecord struct {
+	ID        string    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CardID    string    `json:"card_id" gorm:"type:uuid;not null;index"`
+	UserID    string    `json:"user_id" gorm:"type:uuid;not null"`
+	Action    string    `json:"action" gorm:"not null"`
+	Success   bool      `json:"success" gorm:"not null"`
+	Reason    string    `json:"reason"`
+	ClientIP  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (CardRevealAuditRecord) TableName() string {
+	return "card_reveal_audits"
+}
@@ -8,20 +8,22 @@ import (
 
 // User represents a registered user
 type User struct {
+	ID          string `json:"id,omitempty"` // Set once the user is stored
 	Name        string `json:"name"`
 	Lastname    string `json:"lastname"`
 	BirthDate   string `json:"birth_date"`
 	CountryCode string `json:"country_code"`
-	CitizenID   string `json:"citizen_id"` // Social Security ID (digits only)
+	CitizenID   string `json:"citizen_id"` // Normalized citizen ID, letters and digits only
 }
 
-// RegisterRequest represents the request to register a user
+// RegisterRequest represents the request to register a user.
+// Fields are checked by the validation package, which reports every invalid field at once.
 type RegisterRequest struct {
-	Name        string `json:"name" binding:"required"`
-	Lastname    string `json:"lastname" binding:"required"`
-	BirthDate   string `json:"birth_date" binding:"required"`
-	CountryCode string `json:"country_code" binding:"required"`
-	CitizenID   string `json:"citizen_id" binding:"required"` // Social Security ID (digits only)
+	Name        string `json:"name"`
+	Lastname    string `json:"lastname"`
+	BirthDate   string `json:"birth_date"`
+	CountryCode string `json:"country_code"`
+	CitizenID   string `json:"citizen_id"` // Format depends on the country, e.g. SSN, SIN, CURP or cédula
 }
 
 // RegisterResponse represents the response after user registration
@@ -37,26 +39,37 @@ type UserRecord struct {
 	Lastname    string         `json:"lastname" gorm:"not null"`
 	BirthDate   string         `json:"birth_date" gorm:"type:date;not null"`
 	CountryCode string         `json:"country_code" gorm:"not null"`
-	CitizenID   string         `json:"citizen_id" gorm:"uniqueIndex;not null"` // Social Security ID (digits only)
+	CitizenID   string         `json:"citizen_id" gorm:"uniqueIndex;not null"` // Normalized citizen ID, letters and digits only
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+	// Set once the personal data of the user is erased, an erased user cannot be restored
+	ErasedAt *time.Time `json:"erased_at,omitempty"`
 }
 
 // IssuedCardRecord represents an issued card record in the database
 type IssuedCardRecord struct {
-	ID         string         `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	UserID     string         `json:"user_id" gorm:"type:uuid;not null"`
-	User       UserRecord     `json:"user" gorm:"foreignKey:UserID;references:ID"`
-	UserToken  string         `json:"user_token" gorm:"not null"`
-	PAN        string         `json:"pan" gorm:"not null"`
-	CVV        string         `json:"cvv" gorm:"not null"`
-	ExpiryDate string         `json:"expiry_date" gorm:"type:date;not null"`
-	CardType   string         `json:"card_type" gorm:"not null"`
-	Status     string         `json:"status" gorm:"not null"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+	ID        string     `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    string     `json:"user_id" gorm:"type:uuid;not null"`
+	User      UserRecord `json:"user" gorm:"foreignKey:UserID;references:ID"`
+	UserToken string     `json:"user_token" gorm:"not null"`
+	PAN       string     `json:"pan" gorm:"not null"`
+	// Keyed hash of the PAN, to find the card of an authorization without decrypting every PAN
+	PANFingerprint *string `json:"-" gorm:"index"`
+	CVV            string  `json:"cvv" gorm:"not null"`
+	ExpiryDate     string  `json:"expiry_date" gorm:"type:date;not null"`
+	CardType       string  `json:"card_type" gorm:"not null"`
+	Status         string  `json:"status" gorm:"not null"`
+	// Status change tracking
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	StatusChangedBy string     `json:"status_changed_by,omitempty"`
+	// Card this one replaces, if it was issued as a replacement
+	ReplacesCardID *string `json:"replaces_card_id,omitempty" gorm:"type:uuid;index"`
+	// Credit line stored with a new credit card
+	CreditLine *CreditLineRecord `json:"-" gorm:"-"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt    `json:"deleted_at" gorm:"index"`
 }
 
 // FailedAttemptRecord represents a failed attempt record in the database
@@ -86,24 +99,22 @@ func (FailedAttemptRecord) TableName() string {
 	return "failed_attempts"
 }
 
-// FullCard represents the complete card information with user details
-type FullCard struct {
-	// User fields
-	UserID          string `json:"user_id"`
-	UserToken       string `json:"user_token"`
-	UserName        string `json:"user_name"`
-	UserLastname    string `json:"user_lastname"`
-	UserBirthDate   string `json:"user_birth_date"`
-	UserCountryCode string `json:"user_country_code"`
-	UserSocialID    string `json:"user_social_id"`
-	UserCreatedAt   string `json:"user_created_at"`
-
-	// Card fields
+// MaskedCard represents the card information safe to list, with the PAN masked
+type MaskedCard struct {
 	CardID        string `json:"card_id"`
-	CardPAN       string `json:"card_pan"`
-	CardCVV       string `json:"card_cvv"`
+	CardMaskedPAN string `json:"card_masked_pan"`
 	CardExpiry    string `json:"card_expiry"`
 	CardType      string `json:"card_type"`
 	CardStatus    string `json:"card_status"`
 	CardCreatedAt string `json:"card_created_at"`
 }
+
+// FullCard represents the complete card details, only returned by the reveal endpoint
+type FullCard struct {
+	CardID     string `json:"card_id"`
+	CardPAN    string `json:"card_pan"`
+	CardCVV    string `json:"card_cvv"`
+	CardExpiry string `json:"card_expiry"`
+	CardType   string `json:"card_type"`
+	CardStatus string `json:"card_status"`
+}
@@ -0,0 +1,96 @@
+﻿package validation
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"cards/models"
+)
+
+const maxMerchantNameLength = 100
+
+var (
+	panPattern      = regexp.MustCompile(`^[0-9]{12,19}$`)
+	cvvPattern      = regexp.MustCompile(`^[0-9]{3,4}$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// expiryLayouts are the accepted expiry date formats, from the printed MM/YY to a full date
+var expiryLayouts = []string{"01/06", "2006-01", dateLayout}
+
+// Authorization validates an authorization request, returning the card details to check
+// and the transaction with its currency and country upper-cased. The channel defaults to pos.
+func Authorization(req models.AuthorizationRequest) (models.CardCredentials, models.CardTransaction, Errors) {
+	var errs Errors
+
+	credentials := models.CardCredentials{
+		PAN: strings.ReplaceAll(strings.TrimSpace(req.PAN), " ", ""),
+		CVV: strings.TrimSpace(req.CVV),
+	}
+	if !panPattern.MatchString(credentials.PAN) {
+		errs.Add("pan", "must be 12 to 19 digits")
+	}
+	if !cvvPattern.MatchString(credentials.CVV) {
+		errs.Add("cvv", "must be 3 or 4 digits")
+	}
+
+	expiryMonth, ok := ExpiryMonth(req.ExpiryDate)
+	if !ok {
+		errs.Add("expiry_date", "must be MM/YY, YYYY-MM or YYYY-MM-DD")
+	}
+	credentials.ExpiryMonth = expiryMonth
+
+	transaction := models.CardTransaction{
+		Amount:       req.Amount,
+		Currency:     strings.ToUpper(strings.TrimSpace(req.Currency)),
+		MerchantName: strings.TrimSpace(req.Merchant.Name),
+		Channel:      strings.ToLower(strings.TrimSpace(req.Channel)),
+	}
+	if transaction.Amount <= 0 {
+		errs.Add("amount", "must be greater than 0")
+	}
+	if !currencyPattern.MatchString(transaction.Currency) {
+		errs.Add("currency", "must be an ISO 4217 currency code")
+	}
+
+	switch transaction.Channel {
+	case "":
+		transaction.Channel = models.TransactionChannelPOS
+	case models.TransactionChannelPOS, models.TransactionChannelOnline, models.TransactionChannelATM:
+	default:
+		errs.Add("channel", "must be pos, online or atm")
+	}
+
+	switch {
+	case transaction.MerchantName == "":
+		errs.Add("merchant.name", "is required")
+	case len([]rune(transaction.MerchantName)) > maxMerchantNameLength:
+		errs.Add("merchant.name", "must be at most 100 characters")
+	}
+
+	mccCode, message := mcc(req.Merchant.MCC)
+	if message != "" {
+		errs.Add("merchant.mcc", message)
+	}
+	transaction.MCC = mccCode
+
+	country, err := CountryCode(req.Merchant.Country)
+	if err != nil {
+		errs.Add("merchant.country", err.Error())
+	}
+	transaction.MerchantCountry = country
+
+	return credentials, transaction, errs
+}
+
+// ExpiryMonth parses a card expiry date in any accepted format and returns it as YYYY-MM
+func ExpiryMonth(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range expiryLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed.Format("2006-01"), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,128 @@
+﻿package validation
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	citizenIDSeparators = strings.NewReplacer(" ", "", "-", "", ".", "")
+	citizenIDPattern    = regexp.MustCompile(`^[A-Z0-9]+$`)
+	digitsPattern       = regexp.MustCompile(`^\d+$`)
+	curpPattern         = regexp.MustCompile(`^[A-Z]{4}(\d{6})[HMX]([A-Z]{2})[B-DF-HJ-NP-TV-Z]{3}[A-Z0-9]\d$`)
+)
+
+// curpStates are the state codes of a CURP, NE for people born abroad
+var curpStates = map[string]bool{
+	"AS": true, "BC": true, "BS": true, "CC": true, "CL": true, "CM": true, "CS": true, "CH": true,
+	"DF": true, "DG": true, "GT": true, "GR": true, "HG": true, "JC": true, "MC": true, "MN": true,
+	"MS": true, "NT": true, "NL": true, "OC": true, "PL": true, "QT": true, "QR": true, "SP": true,
+	"SL": true, "SR": true, "TC": true, "TS": true, "TL": true, "VZ": true, "YN": true, "ZS": true,
+	"NE": true,
+}
+
+// citizenIDRules check the normalized citizen ID of a country, returning an error message.
+// The birth date is nil when it is invalid itself.
+var citizenIDRules = map[string]func(citizenID string, birthDate *time.Time) string{
+	"US": checkSSN,
+	"CA": checkSIN,
+	"MX": checkCURP,
+	"CO": checkCedula,
+}
+
+// NormalizeCitizenID removes the spaces, dashes and dots citizen IDs are often written with
+// and upper-cases letters, so 123-45-6789 and 123456789 find the same citizen
+func NormalizeCitizenID(value string) string {
+	return strings.ToUpper(citizenIDSeparators.Replace(strings.TrimSpace(value)))
+}
+
+// IsCitizenID reports whether a normalized citizen ID only holds letters and digits,
+// the form every citizen ID is stored in
+func IsCitizenID(citizenID string) bool {
+	return citizenIDPattern.MatchString(citizenID)
+}
+
+// checkCitizenID applies the rule of the country, other countries only accept digits
+func checkCitizenID(countryCode, citizenID string, birthDate *time.Time) string {
+	if rule, ok := citizenIDRules[countryCode]; ok {
+		return rule(citizenID, birthDate)
+	}
+
+	if !digitsPattern.MatchString(citizenID) {
+		return "must contain only digits"
+	}
+	return ""
+}
+
+// checkSSN checks a US Social Security number: 9 digits, without the area numbers
+// 000, 666 and 900-999, group 00 or serial 0000 that are never assigned
+func checkSSN(citizenID string, _ *time.Time) string {
+	if len(citizenID) != 9 || !digitsPattern.MatchString(citizenID) {
+		return "must be a Social Security number in the format 123-45-6789"
+	}
+
+	area, group, serial := citizenID[:3], citizenID[3:5], citizenID[5:]
+	if area == "000" || area == "666" || area[0] == '9' || group == "00" || serial == "0000" {
+		return "is not a valid Social Security number"
+	}
+	return ""
+}
+
+// checkSIN checks a Canadian Social Insurance number: 9 digits passing the Luhn check
+func checkSIN(citizenID string, _ *time.Time) string {
+	if len(citizenID) != 9 || !digitsPattern.MatchString(citizenID) {
+		return "must be a Social Insurance number of 9 digits"
+	}
+
+	// 0 is never assigned as the first digit
+	if citizenID[0] == '0' || !luhnValid(citizenID) {
+		return "is not a valid Social Insurance number"
+	}
+	return ""
+}
+
+// checkCURP checks the structure of a Mexican CURP and that its embedded birth date
+// matches the one registered
+func checkCURP(citizenID string, birthDate *time.Time) string {
+	match := curpPattern.FindStringSubmatch(citizenID)
+	if match == nil {
+		return "must be a CURP of 18 letters and digits"
+	}
+
+	embeddedDate, state := match[1], match[2]
+	if !curpStates[state] {
+		return "has an unknown state code"
+	}
+	if _, err := time.Parse("060102", embeddedDate); err != nil {
+		return "has an invalid birth date"
+	}
+	if birthDate != nil && birthDate.Format("060102") != embeddedDate {
+		return "does not match the birth date"
+	}
+	return ""
+}
+
+// checkCedula checks a Colombian cédula de ciudadanía, 6 to 10 digits
+func checkCedula(citizenID string, _ *time.Time) string {
+	if !digitsPattern.MatchString(citizenID) || len(citizenID) < 6 || len(citizenID) > 10 {
+		return "must be a cédula of 6 to 10 digits"
+	}
+	return ""
+}
+
+// luhnValid reports whether a string of digits passes the Luhn checksum
+func luhnValid(digits string) bool {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := int(digits[i] - '0')
+		if (len(digits)-i)%2 == 0 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,116 @@
+﻿package validation
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"cards/models"
+)
+
+const maxControlListLength = 250
+
+var mccPattern = regexp.MustCompile(`^[0-9]{4}$`)
+
+// CardControls validates a spending controls request and returns the controls of the card with
+// country codes upper-cased and duplicates removed. Limits must be positive and no larger than
+// the wider limits, and a merchant category code cannot be both allowed and blocked.
+func CardControls(cardID string, req models.CardControlsRequest) (models.CardControlsRecord, Errors) {
+	var errs Errors
+
+	controls := models.DefaultCardControls(cardID)
+	controls.PerTransactionLimit = req.PerTransactionLimit
+	controls.DailyLimit = req.DailyLimit
+	controls.MonthlyLimit = req.MonthlyLimit
+
+	validateLimit(&errs, "per_transaction_limit", req.PerTransactionLimit)
+	validateLimit(&errs, "daily_limit", req.DailyLimit)
+	validateLimit(&errs, "monthly_limit", req.MonthlyLimit)
+	if exceeds(req.PerTransactionLimit, req.DailyLimit) {
+		errs.Add("per_transaction_limit", "must not exceed daily_limit")
+	}
+	if exceeds(req.PerTransactionLimit, req.MonthlyLimit) {
+		errs.Add("per_transaction_limit", "must not exceed monthly_limit")
+	}
+	if exceeds(req.DailyLimit, req.MonthlyLimit) {
+		errs.Add("daily_limit", "must not exceed monthly_limit")
+	}
+
+	controls.AllowedCountries = validateList(&errs, "allowed_countries", req.AllowedCountries, func(value string) (string, string) {
+		code, err := CountryCode(value)
+		if err != nil {
+			return "", err.Error()
+		}
+		return code, ""
+	})
+	controls.AllowedMCCs = validateList(&errs, "allowed_mccs", req.AllowedMCCs, mcc)
+	controls.BlockedMCCs = validateList(&errs, "blocked_mccs", req.BlockedMCCs, mcc)
+
+	for _, code := range controls.BlockedMCCs {
+		if contains(controls.AllowedMCCs, code) {
+			errs.Add("blocked_mccs", code+" is also in allowed_mccs")
+		}
+	}
+
+	if req.OnlineEnabled != nil {
+		controls.OnlineEnabled = *req.OnlineEnabled
+	}
+	if req.ATMEnabled != nil {
+		controls.ATMEnabled = *req.ATMEnabled
+	}
+
+	return controls, errs
+}
+
+func validateLimit(errs *Errors, field string, limit *int64) {
+	if limit != nil && *limit <= 0 {
+		errs.Add(field, "must be greater than 0")
+	}
+}
+
+// exceeds reports whether both limits are set and the narrower one is above the wider one
+func exceeds(narrower, wider *int64) bool {
+	return narrower != nil && wider != nil && *narrower > *wider
+}
+
+// validateList checks every value of a list with check, which returns the normalized value or an error message.
+// The result is sorted and has no duplicates.
+func validateList(errs *Errors, field string, values []string, check func(string) (string, string)) models.StringList {
+	if len(values) > maxControlListLength {
+		errs.Add(field, "must have at most 250 entries")
+		return models.StringList{}
+	}
+
+	list := models.StringList{}
+	for _, value := range values {
+		normalized, message := check(value)
+		if message != "" {
+			errs.Add(field, value+" "+message)
+			continue
+		}
+		if !contains(list, normalized) {
+			list = append(list, normalized)
+		}
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// mcc checks an ISO 18245 merchant category code
+func mcc(value string) (string, string) {
+	code := strings.TrimSpace(value)
+	if !mccPattern.MatchString(code) {
+		return "", "must be a 4 digit merchant category code"
+	}
+	return code, ""
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
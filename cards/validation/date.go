@@ -0,0 +1,38 @@
+﻿package validation
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	// maxAgeYears rejects birth dates no living citizen can have
+	maxAgeYears = 130
+)
+
+// BirthDate parses a YYYY-MM-DD birth date, rejecting impossible days, future dates
+// and dates more than 130 years ago
+func BirthDate(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, errors.New("is required")
+	}
+
+	// The layout requires zero padded months and days, and rejects days a month does not have
+	birthDate, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, errors.New("must be a valid date in YYYY-MM-DD format")
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if birthDate.After(today) {
+		return time.Time{}, errors.New("must not be in the future")
+	}
+	if birthDate.Before(today.AddDate(-maxAgeYears, 0, 0)) {
+		return time.Time{}, errors.New("must be within the last 130 years")
+	}
+
+	return birthDate, nil
+}
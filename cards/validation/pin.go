@@ -0,0 +1,35 @@
+﻿package validation
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	minPINLength = 4
+	maxPINLength = 12
+)
+
+// PIN checks a card PIN: 4 to 12 digits, neither a single repeated digit
+// nor an ascending or descending run such as 1234 or 9876
+func PIN(pin string) error {
+	if len(pin) < minPINLength || len(pin) > maxPINLength || !digitsPattern.MatchString(pin) {
+		return errors.New("must be 4 to 12 digits")
+	}
+
+	if strings.Count(pin, pin[:1]) == len(pin) {
+		return errors.New("must not repeat a single digit")
+	}
+
+	ascending, descending := true, true
+	for i := 1; i < len(pin); i++ {
+		step := int(pin[i]) - int(pin[i-1])
+		ascending = ascending && step == 1
+		descending = descending && step == -1
+	}
+	if ascending || descending {
+		return errors.New("must not be a sequence of consecutive digits")
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+﻿// Package validation checks and normalizes the personal data citizens register with.
+// Every check reports a FieldError, so a request gets all its problems in one response.
+package validation
+
+import (
+	"strings"
+	"time"
+
+	"cards/models"
+)
+
+const maxNameLength = 100
+
+// FieldError describes why one field of a request is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors collects the field errors of a request
+type Errors []FieldError
+
+// Add records an error for a field
+func (e *Errors) Add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldError := range e {
+		messages = append(messages, fieldError.Field+": "+fieldError.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Registration validates a registration request and returns the user with its fields normalized.
+// now is the time birth dates are checked against.
+func Registration(req models.RegisterRequest, now time.Time) (models.User, Errors) {
+	var errs Errors
+
+	user := models.User{
+		Name:     strings.TrimSpace(req.Name),
+		Lastname: strings.TrimSpace(req.Lastname),
+	}
+
+	validateName(&errs, "name", user.Name)
+	validateName(&errs, "lastname", user.Lastname)
+
+	countryCode, err := CountryCode(req.CountryCode)
+	if err != nil {
+		errs.Add("country_code", err.Error())
+	}
+	user.CountryCode = countryCode
+
+	birthDate, err := BirthDate(req.BirthDate, now)
+	if err != nil {
+		errs.Add("birth_date", err.Error())
+	} else {
+		user.BirthDate = birthDate.Format(dateLayout)
+	}
+
+	// Citizen ID rules depend on the country, and some on the birth date
+	citizenID := NormalizeCitizenID(req.CitizenID)
+	if citizenID == "" {
+		errs.Add("citizen_id", "is required")
+	} else if countryCode != "" {
+		var birth *time.Time
+		if err == nil {
+			birth = &birthDate
+		}
+		if message := checkCitizenID(countryCode, citizenID, birth); message != "" {
+			errs.Add("citizen_id", message)
+		}
+	}
+	user.CitizenID = citizenID
+
+	return user, errs
+}
+
+func validateName(errs *Errors, field, value string) {
+	switch {
+	case value == "":
+		errs.Add(field, "is required")
+	case len([]rune(value)) > maxNameLength:
+		errs.Add(field, "must be at most 100 characters")
+	}
+}
@@ -2,12 +2,14 @@
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"log"
 	"math/rand"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"issuer/models"
@@ -19,21 +21,36 @@ var countryMinAge = map[string]int{
 	"US": 18,
 	"CO": 14,
 	"MX": 16,
-	"CA" : 20,
-}
-
-var cardTypes = map[string]bool{
-	"debit":   true,
-	"credit":  true,
-	"prepaid": true,
+	"CA": 20,
 }
 
 type Handlers struct {
 	webhookURL string
+	client     *http.Client
+	inFlight   sync.WaitGroup
 }
 
-func NewHandlers(webhookURL string) *Handlers {
-	return &Handlers{webhookURL: webhookURL}
+func NewHandlers(webhookURL string, webhookTimeout time.Duration) *Handlers {
+	return &Handlers{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// Wait blocks until every issue request being processed sent its webhook, or the context is done
+func (h *Handlers) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (h *Handlers) IssueCard(c *gin.Context) {
@@ -51,7 +68,7 @@ func (h *Handlers) IssueCard(c *gin.Context) {
 	if !exists {
 		log.Printf("Country not eligible: %s", req.CountryCode)
 		// Send webhook asynchronously for decline
-		go h.processCardIssueAsync(req, &models.DeclineReason{Reason: "Country not eligible"})
+		h.startCardIssue(c, req, &models.DeclineReason{Reason: "Country not eligible"}, nil)
 		c.JSON(http.StatusOK, gin.H{"status": "request_received", "message": "Request is being processed"})
 		return
 	}
@@ -68,28 +85,46 @@ func (h *Handlers) IssueCard(c *gin.Context) {
 	if age < minAge {
 		log.Printf("User not eligible due to age: %d < %d", age, minAge)
 		// Send webhook asynchronously for decline
-		go h.processCardIssueAsync(req, &models.DeclineReason{Reason: "User not eligible due to age"})
+		h.startCardIssue(c, req, &models.DeclineReason{Reason: "User not eligible due to age"}, nil)
 		c.JSON(http.StatusOK, gin.H{"status": "request_received", "message": "Request is being processed"})
 		return
 	}
 
 	// Validate card type
-	if _, ok := cardTypes[req.CardType]; !ok {
+	if _, ok := findProduct(req.CardType); !ok {
 		log.Printf("Card type not eligible: %s", req.CardType)
 		// Send webhook asynchronously for decline
-		go h.processCardIssueAsync(req, &models.DeclineReason{Reason: "Card type not eligible"})
+		h.startCardIssue(c, req, &models.DeclineReason{Reason: "Card type not eligible"}, nil)
 		c.JSON(http.StatusOK, gin.H{"status": "request_received", "message": "Request is being processed"})
 		return
 	}
 
+	// Credit cards come with a credit line decided on the applicant's age
+	var creditLine *models.CreditLine
+	if req.CardType == "credit" {
+		creditLine = decideCreditLine(age)
+	}
+
 	// Start async processing for successful case
-	go h.processCardIssueAsync(req, nil)
+	h.startCardIssue(c, req, nil, creditLine)
 
 	// Return immediately
 	c.JSON(http.StatusOK, gin.H{"status": "request_received", "message": "Request is being processed"})
 }
 
-func (h *Handlers) processCardIssueAsync(req models.IssueRequest, declineReason *models.DeclineReason) {
+// startCardIssue processes the request in the background, tracked so shutdown waits for its webhook.
+// The processing keeps the request's values but outlives it.
+func (h *Handlers) startCardIssue(c *gin.Context, req models.IssueRequest, declineReason *models.DeclineReason, creditLine *models.CreditLine) {
+	ctx := context.WithoutCancel(c.Request.Context())
+
+	h.inFlight.Add(1)
+	go func() {
+		defer h.inFlight.Done()
+		h.processCardIssueAsync(ctx, req, declineReason, creditLine)
+	}()
+}
+
+func (h *Handlers) processCardIssueAsync(ctx context.Context, req models.IssueRequest, declineReason *models.DeclineReason, creditLine *models.CreditLine) {
 	log.Printf("Starting async processing for request: %s", req.RequestUUID)
 	// Simulate processing time (6 seconds)
 	time.Sleep(6 * time.Second)
@@ -97,7 +132,7 @@ func (h *Handlers) processCardIssueAsync(req models.IssueRequest, declineReason
 	// If we already have a decline reason, send it immediately
 	if declineReason != nil {
 		log.Printf("Sending decline webhook for request: %s", req.RequestUUID)
-		h.sendWebhookResponse(req, declineReason, nil)
+		h.sendWebhookResponse(ctx, req, declineReason, nil)
 		return
 	}
 
@@ -111,12 +146,26 @@ func (h *Handlers) processCardIssueAsync(req models.IssueRequest, declineReason
 		CVV:        cvv,
 		ExpiryDate: expiryDate,
 		CardType:   req.CardType,
+		CreditLine: creditLine,
 	}
 
 	log.Printf("Card generated successfully for %s %s", req.Name, req.Lastname)
 	// Send webhook response
 	log.Printf("Sending success webhook for request: %s", req.RequestUUID)
-	h.sendWebhookResponse(req, nil, issuedCard)
+	h.sendWebhookResponse(ctx, req, nil, issuedCard)
+}
+
+// decideCreditLine grants younger applicants a smaller limit at a higher rate,
+// limits in cents and rates in basis points
+func decideCreditLine(age int) *models.CreditLine {
+	switch {
+	case age < 25:
+		return &models.CreditLine{Limit: 30000, APRBasisPoints: 2999}
+	case age < 40:
+		return &models.CreditLine{Limit: 100000, APRBasisPoints: 2499}
+	default:
+		return &models.CreditLine{Limit: 250000, APRBasisPoints: 1999}
+	}
 }
 
 func generatePAN() string {
@@ -147,7 +196,7 @@ func generateExpiryDate() string {
 	return expiry.Format("2006-01-02")
 }
 
-func (h *Handlers) sendWebhookResponse(req models.IssueRequest, declineReason *models.DeclineReason, issuedCard *models.IssuedCard) {
+func (h *Handlers) sendWebhookResponse(ctx context.Context, req models.IssueRequest, declineReason *models.DeclineReason, issuedCard *models.IssuedCard) {
 	if h.webhookURL == "" {
 		log.Printf("WEBHOOK_URL not set, skipping webhook call")
 		return
@@ -167,7 +216,14 @@ func (h *Handlers) sendWebhookResponse(req models.IssueRequest, declineReason *m
 	}
 
 	log.Printf("Sending webhook to: %s", h.webhookURL)
-	resp, err := http.Post(h.webhookURL, "application/json", bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.webhookURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		log.Printf("Error creating webhook request: %v", err)
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(httpReq)
 	if err != nil {
 		log.Printf("Error sending webhook: %v", err)
 		return
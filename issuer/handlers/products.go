@@ -0,0 +1,73 @@
+﻿package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"issuer/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// products is the card catalog, every card type the issuer can issue
+var products = []models.Product{
+	{
+		Type:    "debit",
+		Name:    "Debit Card",
+		Network: "visa",
+		Fees:    models.ProductFees{Currency: "USD", ATMWithdrawal: 250, Replacement: 500, ForeignTransactionBasisPoints: 100},
+		Limits:  models.ProductLimits{DailySpend: 200000, MonthlySpend: 1000000},
+	},
+	{
+		Type:    "credit",
+		Name:    "Credit Card",
+		Network: "visa",
+		Fees:    models.ProductFees{Currency: "USD", Annual: 4900, ATMWithdrawal: 500, Replacement: 1000, ForeignTransactionBasisPoints: 300},
+		Limits:  models.ProductLimits{DailySpend: 250000, MonthlySpend: 250000, CreditLimitMin: 30000, CreditLimitMax: 250000},
+	},
+	{
+		Type:    "prepaid",
+		Name:    "Prepaid Card",
+		Network: "visa",
+		Fees:    models.ProductFees{Currency: "USD", Issuance: 500, ATMWithdrawal: 300, Replacement: 500, ForeignTransactionBasisPoints: 200},
+		Limits:  models.ProductLimits{DailySpend: 50000, MonthlySpend: 250000, MaxBalance: 500000},
+	},
+}
+
+func init() {
+	// Every product is open to the same countries and ages
+	countries := make([]string, 0, len(countryMinAge))
+	for country := range countryMinAge {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+
+	ages := make([]string, len(countries))
+	for i, country := range countries {
+		ages[i] = fmt.Sprintf("%d in %s", countryMinAge[country], country)
+	}
+
+	for i := range products {
+		products[i].Eligibility = models.ProductEligibility{
+			Summary:    "Residents of " + strings.Join(countries, ", ") + " of at least the minimum age: " + strings.Join(ages, ", "),
+			Countries:  countries,
+			MinimumAge: countryMinAge,
+		}
+	}
+}
+
+// findProduct returns the product of a card type, if the issuer offers it
+func findProduct(cardType string) (models.Product, bool) {
+	for _, product := range products {
+		if product.Type == cardType {
+			return product, true
+		}
+	}
+	return models.Product{}, false
+}
+
+func (h *Handlers) ListProducts(c *gin.Context) {
+	c.JSON(http.StatusOK, models.ProductCatalog{Products: products})
+}
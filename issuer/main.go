@@ -1,9 +1,15 @@
 ﻿package main
 
 import (
+	"context"
+	"errors"
 	"issuer/handlers"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -22,14 +28,52 @@ func main() {
 		port = "8080"
 	}
 
+	webhookTimeout := 10 * time.Second
+	if value, err := time.ParseDuration(os.Getenv("WEBHOOK_TIMEOUT")); err == nil && value > 0 {
+		webhookTimeout = value
+	}
+
+	shutdownTimeout := 15 * time.Second
+	if value, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && value > 0 {
+		shutdownTimeout = value
+	}
+
 	// Setup routes
-	r := setupRoutes(handlers.NewHandlers(webhookURL))
+	h := handlers.NewHandlers(webhookURL, webhookTimeout)
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           setupRoutes(h),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	log.Printf("Starting Service on port %s", port)
 	// Start server
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	go func() {
+		log.Printf("Starting Service on port %s", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down, draining in-flight requests")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to drain requests: %v", err)
 	}
+
+	// Requests already answered still owe their webhook
+	if err := h.Wait(shutdownCtx); err != nil {
+		log.Printf("Shutdown timed out waiting for issue requests: %v", err)
+		return
+	}
+	log.Println("Shutdown complete")
 }
 
 func setupRoutes(h *handlers.Handlers) *gin.Engine {
@@ -45,5 +89,8 @@ func setupRoutes(h *handlers.Handlers) *gin.Engine {
 	// Card issue endpoint
 	v1.POST("/cards", h.IssueCard)
 
+	// Card product catalog
+	v1.GET("/products", h.ListProducts)
+
 	return r
 }
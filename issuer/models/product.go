@@ -0,0 +1,39 @@
+﻿package models
+
+// Product is a card product the issuer offers, amounts in USD cents
+type Product struct {
+	Type        string             `json:"type"`
+	Name        string             `json:"name"`
+	Network     string             `json:"network"`
+	Eligibility ProductEligibility `json:"eligibility"`
+	Fees        ProductFees        `json:"fees"`
+	Limits      ProductLimits      `json:"limits"`
+}
+
+// ProductEligibility tells who can get a product
+type ProductEligibility struct {
+	Summary    string         `json:"summary"`
+	Countries  []string       `json:"countries"`
+	MinimumAge map[string]int `json:"minimum_age"`
+}
+
+type ProductFees struct {
+	Currency                      string `json:"currency"`
+	Issuance                      int64  `json:"issuance"`
+	Annual                        int64  `json:"annual"`
+	ATMWithdrawal                 int64  `json:"atm_withdrawal"`
+	Replacement                   int64  `json:"replacement"`
+	ForeignTransactionBasisPoints int    `json:"foreign_transaction_basis_points"`
+}
+
+type ProductLimits struct {
+	DailySpend     int64 `json:"daily_spend"`
+	MonthlySpend   int64 `json:"monthly_spend"`
+	CreditLimitMin int64 `json:"credit_limit_min,omitempty"`
+	CreditLimitMax int64 `json:"credit_limit_max,omitempty"`
+	MaxBalance     int64 `json:"max_balance,omitempty"`
+}
+
+type ProductCatalog struct {
+	Products []Product `json:"products"`
+}
@@ -0,0 +1,75 @@
+﻿package main
+
+import (
+	"notifications/models"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultHistoryLimit = 100
+
+// HistoryIssuerResponse is the history type of issuance results
+const HistoryIssuerResponse = "issuer_response"
+
+// NotificationHistory keeps the latest notifications of each user in memory
+type NotificationHistory struct {
+	entries map[string][]models.HistoryEntry
+	limit   int
+	mutex   sync.RWMutex
+}
+
+func NewNotificationHistory() *NotificationHistory {
+	limit := defaultHistoryLimit
+	if value, err := strconv.Atoi(os.Getenv("NOTIFICATION_HISTORY_LIMIT")); err == nil && value > 0 {
+		limit = value
+	}
+
+	return &NotificationHistory{
+		entries: make(map[string][]models.HistoryEntry),
+		limit:   limit,
+	}
+}
+
+// Record adds a notification to the user's history, dropping the oldest past the limit
+func (h *NotificationHistory) Record(userToken string, req models.NotificationRequest, delivered bool) {
+	entry := models.HistoryEntry{
+		Delivered: delivered,
+		CreatedAt: time.Now(),
+	}
+	if req.Event != nil {
+		entry.Type = req.Event.Type
+	} else if req.IssuerResponse != nil {
+		entry.Type = HistoryIssuerResponse
+		entry.RequestUUID = req.IssuerResponse.RequestUUID
+		entry.Status = req.IssuerResponse.Status
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	entries := append(h.entries[userToken], entry)
+	if len(entries) > h.limit {
+		entries = entries[len(entries)-h.limit:]
+	}
+	h.entries[userToken] = entries
+}
+
+// Get returns the user's history, oldest first
+func (h *NotificationHistory) Get(userToken string) []models.HistoryEntry {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	entries := make([]models.HistoryEntry, len(h.entries[userToken]))
+	copy(entries, h.entries[userToken])
+	return entries
+}
+
+// Delete forgets the user's history
+func (h *NotificationHistory) Delete(userToken string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.entries, userToken)
+}
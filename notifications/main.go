@@ -1,13 +1,17 @@
 ﻿package main
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
 	"notifications/models"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -19,6 +23,8 @@ func main() {
 		log.Printf("Warning: .env file not found: %v", err)
 	}
 
+	history = NewNotificationHistory()
+
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -39,11 +45,43 @@ func main() {
 	// Register routes
 	registerRoutes(r)
 
+	shutdownTimeout := 15 * time.Second
+	if value, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && value > 0 {
+		shutdownTimeout = value
+	}
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Open SSE streams never go idle, they are told to close when the server shuts down
+	server.RegisterOnShutdown(connManager.Close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// Start server
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	go func() {
+		log.Println("running on port", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down, closing notification streams")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to drain connections: %v", err)
+		return
 	}
-	fmt.Println("running on port", port)
+	log.Println("Shutdown complete")
 }
 
 // registerRoutes sets up all the API routes
@@ -58,6 +96,10 @@ func registerRoutes(r *gin.Engine) {
 
 	// Endpoint to send notifications
 	r.POST("/notify", SendHandler)
+
+	// Notification history, used by the cards service for data subject requests
+	r.GET("/notifications/history", GetHistoryHandler)
+	r.DELETE("/notifications/history", DeleteHistoryHandler)
 }
 
 // StreamHandler handles SSE connections for real-time notifications
@@ -111,6 +153,13 @@ func StreamHandler(c *gin.Context) {
 		// Client disconnected
 		log.Printf("Client disconnected for user: %s", userToken)
 		return
+
+	case <-connManager.Closing():
+		// Server shutting down, the client reconnects once it is back
+		c.String(http.StatusOK, "retry: %d\ndata: {\"status\":\"closing\"}\n\n", streamRetryAfter.Milliseconds())
+		c.Writer.Flush()
+		log.Printf("SSE connection closed by shutdown for user: %s", userToken)
+		return
 	}
 }
 
@@ -131,10 +180,23 @@ func SendHandler(c *gin.Context) {
 		return
 	}
 
+	// Events take precedence, issuer responses are sent as they are for older clients
+	var notification interface{}
+	switch {
+	case req.Event != nil:
+		notification = *req.Event
+	case req.IssuerResponse != nil:
+		notification = *req.IssuerResponse
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "issuer_response or event is required"})
+		return
+	}
+
 	log.Printf("Received notification request for user: %s", req.UserToken)
 
 	// Try to send notification
-	success := connManager.SendNotification(req.UserToken, req.IssuerResponse)
+	success := connManager.SendNotification(req.UserToken, notification)
+	history.Record(req.UserToken, req, success)
 
 	if success {
 		c.JSON(http.StatusOK, gin.H{
@@ -149,19 +211,52 @@ func SendHandler(c *gin.Context) {
 	}
 }
 
+// GetHistoryHandler returns the notifications sent to a user
+func GetHistoryHandler(c *gin.Context) {
+	userToken := c.Query("user_token")
+	if userToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_token is required"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notifications": history.Get(userToken)})
+}
+
+// DeleteHistoryHandler forgets the notifications sent to a user
+func DeleteHistoryHandler(c *gin.Context) {
+	userToken := c.Query("user_token")
+	if userToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_token is required"})
+		return
+	}
+
+	history.Delete(userToken)
+	log.Printf("Notification history deleted for user: %s", userToken)
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
 // ConnectionManager manages active SSE connections
 type ConnectionManager struct {
-	connections map[string]chan models.IssuerResponse
+	connections map[string]chan interface{}
 	mutex       sync.RWMutex
+	closing     chan struct{}
+	closeOnce   sync.Once
 }
 
+// streamRetryAfter is how long clients wait before reconnecting to a stream closed by shutdown
+const streamRetryAfter = 5 * time.Second
+
 // Global connection manager instance
 var connManager = &ConnectionManager{
-	connections: make(map[string]chan models.IssuerResponse),
+	connections: make(map[string]chan interface{}),
+	closing:     make(chan struct{}),
 }
 
+// Global notification history instance, created once the environment is loaded
+var history *NotificationHistory
+
 // AddConnection adds a new connection for a user
-func (cm *ConnectionManager) AddConnection(userToken string) chan models.IssuerResponse {
+func (cm *ConnectionManager) AddConnection(userToken string) chan interface{} {
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
 
@@ -171,20 +266,20 @@ func (cm *ConnectionManager) AddConnection(userToken string) chan models.IssuerR
 	}
 
 	// Create new channel for this user
-	ch := make(chan models.IssuerResponse, 1)
+	ch := make(chan interface{}, 1)
 	cm.connections[userToken] = ch
 	log.Printf("Connection added for user: %s", userToken)
 	return ch
 }
 
 // SendNotification sends a notification to a user
-func (cm *ConnectionManager) SendNotification(userToken string, response models.IssuerResponse) bool {
+func (cm *ConnectionManager) SendNotification(userToken string, notification interface{}) bool {
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
 
 	if ch, exists := cm.connections[userToken]; exists {
 		select {
-		case ch <- response:
+		case ch <- notification:
 			log.Printf("Notification sent to user: %s", userToken)
 			return true
 		default:
@@ -197,6 +292,18 @@ func (cm *ConnectionManager) SendNotification(userToken string, response models.
 	return false
 }
 
+// Closing is closed once the server starts shutting down
+func (cm *ConnectionManager) Closing() <-chan struct{} {
+	return cm.closing
+}
+
+// Close tells every open stream to end
+func (cm *ConnectionManager) Close() {
+	cm.closeOnce.Do(func() {
+		close(cm.closing)
+	})
+}
+
 // RemoveConnection removes a connection for a user
 func (cm *ConnectionManager) RemoveConnection(userToken string) {
 	cm.mutex.Lock()
@@ -1,5 +1,7 @@
 ﻿package models
 
+import "time"
+
 type DeclineReason struct {
 	Reason string `json:"reason"`
 }
@@ -19,7 +21,24 @@ type IssuerResponse struct {
 	Status          string         `json:"status"`
 }
 
+// Event is a notification other than an issuance result, e.g. a one-time code
+type Event struct {
+	Type    string            `json:"type"`
+	Message string            `json:"message"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
 type NotificationRequest struct {
-	UserToken      string         `json:"user_token"`
-	IssuerResponse IssuerResponse `json:"issuer_response"`
+	UserToken      string          `json:"user_token"`
+	IssuerResponse *IssuerResponse `json:"issuer_response,omitempty"`
+	Event          *Event          `json:"event,omitempty"`
+}
+
+// HistoryEntry is a notification kept for a user's history, without codes or card details
+type HistoryEntry struct {
+	Type        string    `json:"type"`
+	RequestUUID string    `json:"request_uuid,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	Delivered   bool      `json:"delivered"`
+	CreatedAt   time.Time `json:"created_at"`
 }
@@ -37,7 +37,10 @@ class CardIssuanceApp extends StatelessWidget {
           }
           return CardSelectionScreen(userToken: userToken);
         },
-        '/waiting': (context) => const WaitingScreen(),
+        '/waiting': (context) {
+          final arguments = ModalRoute.of(context)!.settings.arguments as WaitingArguments;
+          return WaitingScreen(arguments: arguments);
+        },
         '/result-success': (context) {
           final issuedCard = ModalRoute.of(context)!.settings.arguments as IssuedCard;
           return ResultSuccessScreen(issuedCard: issuedCard);
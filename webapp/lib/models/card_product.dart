@@ -0,0 +1,46 @@
+class CardProduct {
+  final String type;
+  final String name;
+  final String network;
+  final String eligibility;
+  final String feeCurrency;
+  final int issuanceFee;
+  final int annualFee;
+  final int dailySpendLimit;
+  final int? creditLimitMax;
+  final int? maxBalance;
+
+  CardProduct({
+    required this.type,
+    required this.name,
+    required this.network,
+    required this.eligibility,
+    required this.feeCurrency,
+    required this.issuanceFee,
+    required this.annualFee,
+    required this.dailySpendLimit,
+    this.creditLimitMax,
+    this.maxBalance,
+  });
+
+  factory CardProduct.fromJson(Map<String, dynamic> json) {
+    final fees = json['fees'] as Map<String, dynamic>? ?? {};
+    final limits = json['limits'] as Map<String, dynamic>? ?? {};
+    return CardProduct(
+      type: json['type'] ?? '',
+      name: json['name'] ?? '',
+      network: json['network'] ?? '',
+      eligibility: json['eligibility']?['summary'] ?? '',
+      feeCurrency: fees['currency'] ?? '',
+      issuanceFee: fees['issuance'] ?? 0,
+      annualFee: fees['annual'] ?? 0,
+      dailySpendLimit: limits['daily_spend'] ?? 0,
+      creditLimitMax: limits['credit_limit_max'],
+      maxBalance: limits['max_balance'],
+    );
+  }
+
+  // Amounts come in minor units, e.g. cents
+  static String formatAmount(int amount, String currency) =>
+      '$currency ${(amount / 100).toStringAsFixed(2)}';
+}
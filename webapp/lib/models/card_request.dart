@@ -0,0 +1,25 @@
+class CardRequest {
+  final String requestUuid;
+  final String cardType;
+  final String status;
+  final String? issuedCardId;
+  final String? declineReason;
+
+  CardRequest({
+    required this.requestUuid,
+    required this.cardType,
+    required this.status,
+    this.issuedCardId,
+    this.declineReason,
+  });
+
+  bool get isPending => status == 'submitted' || status == 'forwarded';
+
+  factory CardRequest.fromJson(Map<String, dynamic> json) => CardRequest(
+        requestUuid: json['request_uuid'] ?? '',
+        cardType: json['card_type'] ?? '',
+        status: json['status'] ?? '',
+        issuedCardId: json['issued_card_id'],
+        declineReason: json['decline_reason'],
+      );
+}
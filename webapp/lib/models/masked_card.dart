@@ -0,0 +1,43 @@
+class MaskedCard {
+  final String cardId;
+  final String cardMaskedPan;
+  final String cardExpiry;
+  final String cardType;
+  final String cardStatus;
+  final String cardCreatedAt;
+
+  MaskedCard({
+    required this.cardId,
+    required this.cardMaskedPan,
+    required this.cardExpiry,
+    required this.cardType,
+    required this.cardStatus,
+    required this.cardCreatedAt,
+  });
+
+  factory MaskedCard.fromJson(Map<String, dynamic> json) => MaskedCard(
+        cardId: json['card_id'] ?? '',
+        cardMaskedPan: json['card_masked_pan'] ?? '',
+        cardExpiry: json['card_expiry'] ?? '',
+        cardType: json['card_type'] ?? '',
+        cardStatus: json['card_status'] ?? '',
+        cardCreatedAt: json['card_created_at'] ?? '',
+      );
+}
+
+class CardPage {
+  final List<MaskedCard> cards;
+  final String? nextCursor;
+
+  CardPage({
+    required this.cards,
+    this.nextCursor,
+  });
+
+  factory CardPage.fromJson(Map<String, dynamic> json) => CardPage(
+        cards: (json['cards'] as List<dynamic>? ?? [])
+            .map((card) => MaskedCard.fromJson(card))
+            .toList(),
+        nextCursor: json['next_cursor'],
+      );
+}
@@ -1,6 +1,6 @@
 import 'package:flutter/material.dart';
 import '../services/api_service.dart';
-import '../models/full_card.dart';
+import '../models/masked_card.dart';
 
 class CardSearchScreen extends StatefulWidget {
   const CardSearchScreen({super.key});
@@ -14,7 +14,9 @@ class _CardSearchScreenState extends State<CardSearchScreen>
   final _formKey = GlobalKey<FormState>();
   final _citizenIdController = TextEditingController();
   bool _isLoading = false;
-  List<FullCard> _cards = [];
+  bool _isLoadingMore = false;
+  List<MaskedCard> _cards = [];
+  String? _nextCursor;
   late AnimationController _animationController;
   late Animation<double> _fadeAnimation;
 
@@ -42,15 +44,17 @@ class _CardSearchScreenState extends State<CardSearchScreen>
       setState(() {
         _isLoading = true;
         _cards = [];
+        _nextCursor = null;
       });
 
       try {
-        final cards = await ApiService.getCardsByCitizenId(
+        final page = await ApiService.getCardsByCitizenId(
           citizenId: _citizenIdController.text,
         );
 
         setState(() {
-          _cards = cards;
+          _cards = page.cards;
+          _nextCursor = page.nextCursor;
         });
       } catch (e) {
         print('Error searching cards: $e');
@@ -69,9 +73,44 @@ class _CardSearchScreenState extends State<CardSearchScreen>
     }
   }
 
-  String _maskCardNumber(String pan) {
-    if (pan.length < 8) return pan;
-    return '${pan.substring(0, 4)} **** **** ${pan.substring(pan.length - 4)}';
+  Future<void> _loadMoreCards() async {
+    setState(() {
+      _isLoadingMore = true;
+    });
+
+    try {
+      final page = await ApiService.getCardsByCitizenId(
+        citizenId: _citizenIdController.text,
+        cursor: _nextCursor,
+      );
+
+      setState(() {
+        _cards = [..._cards, ...page.cards];
+        _nextCursor = page.nextCursor;
+      });
+    } catch (e) {
+      print('Error loading more cards: $e');
+      if (mounted) {
+        ScaffoldMessenger.of(context).showSnackBar(
+          SnackBar(content: Text('Error: $e')),
+        );
+      }
+    } finally {
+      if (mounted) {
+        setState(() {
+          _isLoadingMore = false;
+        });
+      }
+    }
+  }
+
+  String _formatCardNumber(String maskedPan) {
+    final groups = <String>[];
+    for (var i = 0; i < maskedPan.length; i += 4) {
+      final end = i + 4 < maskedPan.length ? i + 4 : maskedPan.length;
+      groups.add(maskedPan.substring(i, end));
+    }
+    return groups.join(' ');
   }
 
   Color _getCardTypeColor(String cardType) {
@@ -165,19 +204,19 @@ class _CardSearchScreenState extends State<CardSearchScreen>
                           const SizedBox(height: 24),
                           TextFormField(
                             controller: _citizenIdController,
-                            keyboardType: TextInputType.number,
+                            textCapitalization: TextCapitalization.characters,
                             decoration: const InputDecoration(
                               labelText: 'Citizen ID',
                               prefixIcon: Icon(Icons.badge),
                               border: OutlineInputBorder(),
-                              hintText: 'Enter your citizen ID (digits only)',
+                              hintText: 'SSN, SIN, CURP, cédula or national ID',
                             ),
                             validator: (value) {
                               if (value == null || value.isEmpty) {
                                 return 'Please enter your citizen ID';
                               }
-                              if (!RegExp(r'^\d+$').hasMatch(value)) {
-                                return 'Citizen ID must contain only digits';
+                              if (!RegExp(r'^[A-Za-z0-9 .-]+$').hasMatch(value)) {
+                                return 'Citizen ID must contain only letters and digits';
                               }
                               return null;
                             },
@@ -321,7 +360,7 @@ class _CardSearchScreenState extends State<CardSearchScreen>
                                           ),
                                         ),
                                         Text(
-                                          _maskCardNumber(card.cardPan),
+                                          _formatCardNumber(card.cardMaskedPan),
                                           style: theme.textTheme.titleMedium?.copyWith(
                                             fontWeight: FontWeight.bold,
                                             letterSpacing: 2,
@@ -359,13 +398,13 @@ class _CardSearchScreenState extends State<CardSearchScreen>
                                       crossAxisAlignment: CrossAxisAlignment.start,
                                       children: [
                                         Text(
-                                          'Cardholder',
+                                          'Card ID',
                                           style: theme.textTheme.bodySmall?.copyWith(
                                             color: Colors.grey[600],
                                           ),
                                         ),
                                         Text(
-                                          '${card.userName} ${card.userLastname}',
+                                          card.cardId.split('-')[0],
                                           style: theme.textTheme.bodyMedium?.copyWith(
                                             fontWeight: FontWeight.w500,
                                           ),
@@ -398,6 +437,16 @@ class _CardSearchScreenState extends State<CardSearchScreen>
                           ),
                         ),
                       )),
+                  if (_nextCursor != null)
+                    Center(
+                      child: _isLoadingMore
+                          ? const CircularProgressIndicator()
+                          : TextButton.icon(
+                              onPressed: _loadMoreCards,
+                              icon: const Icon(Icons.expand_more),
+                              label: const Text('Load More'),
+                            ),
+                    ),
                 ] else if (!_isLoading && _citizenIdController.text.isNotEmpty) ...[
                   Card(
                     elevation: 4,
@@ -2,6 +2,8 @@ import 'package:flutter/material.dart';
 import '../services/api_service.dart';
 import '../services/sse_service.dart';
 import '../models/issuer_response.dart';
+import '../models/card_product.dart';
+import 'waiting_screen.dart';
 
 class CardSelectionScreen extends StatefulWidget {
   final String userToken;
@@ -14,6 +16,7 @@ class CardSelectionScreen extends StatefulWidget {
 
 class _CardSelectionScreenState extends State<CardSelectionScreen> {
   final SseService _sseService = SseService();
+  late final Future<List<CardProduct>> _products = ApiService.getProducts();
   bool _isLoading = false;
 
   Future<void> _selectCardType(String cardType) async {
@@ -54,13 +57,20 @@ class _CardSelectionScreenState extends State<CardSelectionScreen> {
         },
       );
       
-      await ApiService.issueCard(
+      final requestUuid = await ApiService.issueCard(
         userToken: widget.userToken,
         cardType: cardType,
       );
 
       if (mounted) {
-        Navigator.pushReplacementNamed(context, '/waiting');
+        Navigator.pushReplacementNamed(
+          context,
+          '/waiting',
+          arguments: WaitingArguments(
+            requestUuid: requestUuid,
+            userToken: widget.userToken,
+          ),
+        );
       }
     } catch (e) {
       print('Error in card selection screen: $e');
@@ -100,28 +110,29 @@ class _CardSelectionScreenState extends State<CardSelectionScreen> {
             ),
             const SizedBox(height: 40),
             Expanded(
-              child: Column(
-                mainAxisAlignment: MainAxisAlignment.spaceEvenly,
-                children: [
-                  _buildCardOption(
-                    'Credit Card',
-                    Icons.credit_card,
-                    Colors.blue,
-                    'credit',
-                  ),
-                  _buildCardOption(
-                    'Debit Card',
-                    Icons.account_balance_wallet,
-                    Colors.green,
-                    'debit',
-                  ),
-                  _buildCardOption(
-                    'Prepaid Card',
-                    Icons.payment,
-                    Colors.orange,
-                    'prepaid',
-                  ),
-                ],
+              // The card types come from the issuer's product catalog
+              child: FutureBuilder<List<CardProduct>>(
+                future: _products,
+                builder: (context, snapshot) {
+                  if (snapshot.connectionState != ConnectionState.done) {
+                    return const Center(child: CircularProgressIndicator());
+                  }
+                  if (snapshot.hasError) {
+                    return Center(
+                      child: Text(
+                        'Could not load card products: ${snapshot.error}',
+                        textAlign: TextAlign.center,
+                      ),
+                    );
+                  }
+                  final products = snapshot.data ?? [];
+                  if (products.isEmpty) {
+                    return const Center(child: Text('No card products are available right now'));
+                  }
+                  return ListView(
+                    children: products.map(_buildCardOption).toList(),
+                  );
+                },
               ),
             ),
             if (_isLoading)
@@ -140,11 +151,38 @@ class _CardSelectionScreenState extends State<CardSelectionScreen> {
     );
   }
 
-  Widget _buildCardOption(String title, IconData icon, Color color, String cardType) {
+  static const Map<String, IconData> _productIcons = {
+    'credit': Icons.credit_card,
+    'debit': Icons.account_balance_wallet,
+    'prepaid': Icons.payment,
+  };
+
+  static const Map<String, Color> _productColors = {
+    'credit': Colors.blue,
+    'debit': Colors.green,
+    'prepaid': Colors.orange,
+  };
+
+  Widget _buildCardOption(CardProduct product) {
+    final icon = _productIcons[product.type] ?? Icons.credit_card;
+    final color = _productColors[product.type] ?? Colors.grey;
+
+    final details = <String>[
+      product.network.toUpperCase(),
+      'Annual fee ${CardProduct.formatAmount(product.annualFee, product.feeCurrency)}',
+      if (product.issuanceFee > 0)
+        'Issuance fee ${CardProduct.formatAmount(product.issuanceFee, product.feeCurrency)}',
+      if (product.creditLimitMax != null)
+        'Credit limit up to ${CardProduct.formatAmount(product.creditLimitMax!, product.feeCurrency)}',
+      if (product.maxBalance != null)
+        'Balance up to ${CardProduct.formatAmount(product.maxBalance!, product.feeCurrency)}',
+    ];
+
     return Card(
       elevation: 4,
+      margin: const EdgeInsets.symmetric(vertical: 8),
       child: InkWell(
-        onTap: _isLoading ? null : () => _selectCardType(cardType),
+        onTap: _isLoading ? null : () => _selectCardType(product.type),
         child: Container(
           padding: const EdgeInsets.all(24),
           child: Column(
@@ -157,12 +195,23 @@ class _CardSelectionScreenState extends State<CardSelectionScreen> {
               ),
               const SizedBox(height: 16),
               Text(
-                title,
+                product.name,
                 style: const TextStyle(
                   fontSize: 20,
                   fontWeight: FontWeight.bold,
                 ),
               ),
+              const SizedBox(height: 8),
+              Text(
+                details.join(' · '),
+                textAlign: TextAlign.center,
+              ),
+              const SizedBox(height: 4),
+              Text(
+                product.eligibility,
+                textAlign: TextAlign.center,
+                style: TextStyle(fontSize: 12, color: Colors.grey[600]),
+              ),
             ],
           ),
         ),
@@ -231,19 +231,19 @@ class _RegisterScreenState extends State<RegisterScreen>
                         const SizedBox(height: 16),
                         TextFormField(
                           controller: _citizenIdController,
-                          keyboardType: TextInputType.number,
+                          textCapitalization: TextCapitalization.characters,
                           decoration: const InputDecoration(
                             labelText: 'Citizen ID',
                             prefixIcon: Icon(Icons.badge),
                             border: OutlineInputBorder(),
-                            hintText: 'Enter your citizen ID (digits only)',
+                            hintText: 'SSN, SIN, CURP, cédula or national ID',
                           ),
                           validator: (value) {
                             if (value == null || value.isEmpty) {
                               return 'Please enter your citizen ID';
                             }
-                            if (!RegExp(r'^\d+$').hasMatch(value)) {
-                              return 'Citizen ID must contain only digits';
+                            if (!RegExp(r'^[A-Za-z0-9 .-]+$').hasMatch(value)) {
+                              return 'Citizen ID must contain only letters and digits';
                             }
                             return null;
                           },
@@ -1,9 +1,20 @@
+import 'dart:async';
 import 'package:flutter/material.dart';
+import '../services/api_service.dart';
 import '../services/sse_service.dart';
 import '../models/issuer_response.dart';
 
+class WaitingArguments {
+  final String requestUuid;
+  final String userToken;
+
+  WaitingArguments({required this.requestUuid, required this.userToken});
+}
+
 class WaitingScreen extends StatefulWidget {
-  const WaitingScreen({super.key});
+  final WaitingArguments arguments;
+
+  const WaitingScreen({super.key, required this.arguments});
 
   @override
   State<WaitingScreen> createState() => _WaitingScreenState();
@@ -13,6 +24,8 @@ class _WaitingScreenState extends State<WaitingScreen> with TickerProviderStateM
   late AnimationController _animationController;
   late Animation<double> _animation;
   final SseService _sseService = SseService();
+  Timer? _pollTimer;
+  bool _finished = false;
 
   @override
   void initState() {
@@ -31,10 +44,51 @@ class _WaitingScreenState extends State<WaitingScreen> with TickerProviderStateM
       onMessage: _handleNotification,
       onError: _handleError,
     );
+
+    // Poll the request status in case the notification is missed
+    _pollTimer = Timer.periodic(const Duration(seconds: 5), (_) => _pollRequest());
+  }
+
+  Future<void> _pollRequest() async {
+    try {
+      final request = await ApiService.getRequest(
+        requestUuid: widget.arguments.requestUuid,
+        userToken: widget.arguments.userToken,
+      );
+      if (!mounted || _finished || request.isPending) {
+        return;
+      }
+
+      _finished = true;
+      _pollTimer?.cancel();
+      if (request.status == 'declined') {
+        Navigator.pushReplacementNamed(
+          context,
+          '/result-declined',
+          arguments: request.declineReason ?? 'Declined',
+        );
+      } else if (request.status == 'expired') {
+        Navigator.pushReplacementNamed(
+          context,
+          '/result-declined',
+          arguments: 'The request could not be processed in time',
+        );
+      } else if (request.status == 'issued') {
+        // Card details are only sent in the notification, the card can be found by citizen ID
+        ScaffoldMessenger.of(context).showSnackBar(
+          const SnackBar(content: Text('Your card was issued. Search by citizen ID to see it.')),
+        );
+        Navigator.pushReplacementNamed(context, '/card-search');
+      }
+    } catch (e) {
+      print('Error polling request status: $e');
+    }
   }
   
   void _handleNotification(IssuerResponse response) {
-    if (mounted) {
+    if (mounted && !_finished) {
+      _finished = true;
+      _pollTimer?.cancel();
       if (response.declineReason != null) {
         Navigator.pushReplacementNamed(
           context,
@@ -56,6 +110,7 @@ class _WaitingScreenState extends State<WaitingScreen> with TickerProviderStateM
 
   @override
   void dispose() {
+    _pollTimer?.cancel();
     _animationController.dispose();
     // Don't disconnect SSE here - it might be needed for result screens
     super.dispose();
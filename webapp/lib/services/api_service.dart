@@ -1,7 +1,9 @@
 import 'dart:convert';
 import 'package:http/http.dart' as http;
 import '../env/env.dart';
-import '../models/full_card.dart';
+import '../models/masked_card.dart';
+import '../models/card_request.dart';
+import '../models/card_product.dart';
 
 class ApiService {
   static const String _registerEndpoint = '/v1/register';
@@ -36,12 +38,20 @@ class ApiService {
       final decodedResponse = jsonDecode(response.body);
       print('Decoded registration response: $decodedResponse');
       return decodedResponse;
+    } else if (response.statusCode == 400) {
+      // Invalid fields are all listed together, e.g. country_code: must be an ISO 3166-1 alpha-2 country code
+      final body = jsonDecode(response.body);
+      final fields = body['fields'] as List<dynamic>?;
+      if (fields != null && fields.isNotEmpty) {
+        throw Exception(fields.map((field) => '${field['field']}: ${field['message']}').join('\n'));
+      }
+      throw Exception(body['error'] ?? 'Invalid registration data');
     } else {
       throw Exception('Failed to register user: ${response.statusCode} - ${response.body}');
     }
   }
 
-  static Future<void> issueCard({
+  static Future<String> issueCard({
     required String userToken,
     required String cardType,
   }) async {
@@ -57,16 +67,64 @@ class ApiService {
     );
 
     if (response.statusCode == 202) {
-      return;
+      final decodedResponse = jsonDecode(response.body);
+      return decodedResponse['request_uuid'];
+    } else if (response.statusCode == 409 || response.statusCode == 429) {
+      // Issuance policy violation, the message explains which limit was reached
+      final decodedResponse = jsonDecode(response.body);
+      throw Exception(decodedResponse['violation']?['message'] ?? decodedResponse['error']);
+    } else if (response.statusCode == 400 || response.statusCode == 503) {
+      // Card type missing from the product catalog, or the catalog could not be loaded
+      throw Exception(jsonDecode(response.body)['error']);
     } else {
       throw Exception('Failed to issue card: ${response.statusCode}');
     }
   }
 
-  static Future<List<FullCard>> getCardsByCitizenId({
+  static Future<List<CardProduct>> getProducts() async {
+    final url = Uri.parse('${Env.issueServiceUrl}/v1/products');
+
+    final response = await http.get(
+      url,
+      headers: {'Content-Type': 'application/json'},
+    );
+
+    if (response.statusCode == 200) {
+      final decodedResponse = jsonDecode(response.body);
+      return (decodedResponse['products'] as List<dynamic>? ?? [])
+          .map((product) => CardProduct.fromJson(product))
+          .toList();
+    } else {
+      throw Exception('Failed to get card products: ${response.statusCode} - ${response.body}');
+    }
+  }
+
+  static Future<CardRequest> getRequest({
+    required String requestUuid,
+    required String userToken,
+  }) async {
+    final url = Uri.parse('${Env.issueServiceUrl}/v1/requests/$requestUuid')
+        .replace(queryParameters: {'user_token': userToken});
+
+    final response = await http.get(
+      url,
+      headers: {'Content-Type': 'application/json'},
+    );
+
+    if (response.statusCode == 200) {
+      return CardRequest.fromJson(jsonDecode(response.body));
+    } else {
+      throw Exception('Failed to get request: ${response.statusCode} - ${response.body}');
+    }
+  }
+
+  static Future<CardPage> getCardsByCitizenId({
     required String citizenId,
+    String? cursor,
   }) async {
-    final url = Uri.parse('${Env.issueServiceUrl}/v1/$citizenId/cards');
+    final url = Uri.parse('${Env.issueServiceUrl}/v1/${Uri.encodeComponent(citizenId)}/cards').replace(
+      queryParameters: cursor != null ? {'cursor': cursor} : null,
+    );
     print('Get cards URL: $url');
     
     final response = await http.get(
@@ -78,8 +136,7 @@ class ApiService {
     print('Get cards API Response Body: ${response.body}');
     
     if (response.statusCode == 200) {
-      final List<dynamic> jsonList = jsonDecode(response.body);
-      return jsonList.map((json) => FullCard.fromJson(json)).toList();
+      return CardPage.fromJson(jsonDecode(response.body));
     } else {
       throw Exception('Failed to get cards: ${response.statusCode} - ${response.body}');
     }
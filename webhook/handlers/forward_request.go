@@ -7,14 +7,24 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-type ForwardRequestHandler struct{}
+type ForwardRequestHandler struct {
+	client *http.Client
+}
 
 func NewForwardRequestHandler() *ForwardRequestHandler {
-	return &ForwardRequestHandler{}
+	timeout := 10 * time.Second
+	if value, err := time.ParseDuration(os.Getenv("ISSUER_TIMEOUT")); err == nil && value > 0 {
+		timeout = value
+	}
+
+	return &ForwardRequestHandler{
+		client: &http.Client{Timeout: timeout},
+	}
 }
 
 func (h *ForwardRequestHandler) HandleForwardRequest(c *gin.Context) {
@@ -35,7 +45,15 @@ func (h *ForwardRequestHandler) HandleForwardRequest(c *gin.Context) {
 	}
 
 	// Forward the request to the issuer
-	resp, err := http.Post(issuerURL, "application/json", bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, issuerURL, bytes.NewBuffer(body))
+	if err != nil {
+		log.Printf("Error creating issuer request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward request to issuer"})
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
 	if err != nil {
 		log.Printf("Error forwarding request to issuer: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward request to issuer"})
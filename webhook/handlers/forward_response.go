@@ -2,11 +2,17 @@ package handlers
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
 	"webhook/internal"
@@ -18,11 +24,18 @@ import (
 
 type ForwardResponseHandler struct {
 	redisService *internal.RedisService
+	client       *http.Client
 }
 
 func NewForwardResponseHandler(redisService *internal.RedisService) *ForwardResponseHandler {
+	timeout := 10 * time.Second
+	if value, err := time.ParseDuration(os.Getenv("CALLBACK_TIMEOUT")); err == nil && value > 0 {
+		timeout = value
+	}
+
 	return &ForwardResponseHandler{
 		redisService: redisService,
+		client:       &http.Client{Timeout: timeout},
 	}
 }
 
@@ -51,7 +64,7 @@ func (h *ForwardResponseHandler) HandleForwardResponse(c *gin.Context) {
 	}
 
 	// Look up suscriptor info in Redis
-	suscriptor, err := h.redisService.GetSuscriptor(issuerResponse.SuscriptorToken)
+	suscriptor, err := h.redisService.GetSuscriptor(c.Request.Context(), issuerResponse.SuscriptorToken)
 	if err != nil {
 		log.Printf("Error retrieving suscriptor %s: %v", issuerResponse.SuscriptorToken, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Suscriptor not found"})
@@ -69,7 +82,7 @@ func (h *ForwardResponseHandler) HandleForwardResponse(c *gin.Context) {
 	webhookEvent := h.createWebhookEvent(issuerResponse, suscriptor["name"])
 
 	// Forward the webhook event to the suscriptor
-	if err := h.forwardWebhookEvent(callbackURL, webhookEvent); err != nil {
+	if err := h.forwardWebhookEvent(c.Request.Context(), callbackURL, suscriptor["signing_secret"], webhookEvent); err != nil {
 		log.Printf("Error forwarding webhook event to %s: %v", callbackURL, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward webhook event"})
 		return
@@ -122,15 +135,30 @@ func (h *ForwardResponseHandler) createWebhookEvent(issuerResponse models.Issuer
 	}
 }
 
-func (h *ForwardResponseHandler) forwardWebhookEvent(callbackURL string, event models.WebhookEvent) error {
+func (h *ForwardResponseHandler) forwardWebhookEvent(ctx context.Context, callbackURL, signingSecret string, event models.WebhookEvent) error {
 	// Marshal the webhook event to JSON
 	eventJSON, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal webhook event: %w", err)
 	}
 
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewBuffer(eventJSON))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Sign the event, suscriptors registered before signing was added have no secret
+	if signingSecret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", signWebhookEvent(signingSecret, timestamp, eventJSON))
+	} else {
+		log.Printf("Suscriptor at %s has no signing secret, sending event %s unsigned", callbackURL, event.ID)
+	}
+
 	// Forward the webhook event to the suscriptor
-	resp, err := http.Post(callbackURL, "application/json", bytes.NewBuffer(eventJSON))
+	resp, err := h.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send webhook event: %w", err)
 	}
@@ -145,3 +173,11 @@ func (h *ForwardResponseHandler) forwardWebhookEvent(callbackURL string, event m
 
 	return nil
 }
+
+// signWebhookEvent returns the signature header value, an HMAC-SHA256 of "<timestamp>.<body>"
+func signWebhookEvent(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
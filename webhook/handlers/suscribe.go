@@ -37,13 +37,22 @@ func (h *SuscribeHandler) HandleSuscribe(c *gin.Context) {
 		return
 	}
 
+	// Generate the secret used to sign the events sent to the suscriptor
+	signingSecret, err := generateSecureToken()
+	if err != nil {
+		log.Printf("Error generating signing secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate signing secret"})
+		return
+	}
+
 	// Store suscriptor info in Redis
 	suscriptor := map[string]string{
-		"name":         req.Name,
-		"callback_url": req.CallbackURL,
+		"name":           req.Name,
+		"callback_url":   req.CallbackURL,
+		"signing_secret": signingSecret,
 	}
 
-	if err := h.redisService.StoreSuscriptor(token, suscriptor); err != nil {
+	if err := h.redisService.StoreSuscriptor(c.Request.Context(), token, suscriptor); err != nil {
 		log.Printf("Error storing suscriptor: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store suscriptor"})
 		return
@@ -53,6 +62,7 @@ func (h *SuscribeHandler) HandleSuscribe(c *gin.Context) {
 
 	response := models.SuscribeResponse{
 		SuscriptorToken: token,
+		SigningSecret:   signingSecret,
 	}
 
 	c.JSON(http.StatusOK, response)
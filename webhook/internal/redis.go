@@ -17,9 +17,7 @@ func NewRedisService(client *redis.Client) *RedisService {
 	}
 }
 
-func (r *RedisService) StoreSuscriptor(token string, suscriptor map[string]string) error {
-	ctx := context.Background()
-
+func (r *RedisService) StoreSuscriptor(ctx context.Context, token string, suscriptor map[string]string) error {
 	jsonData, err := json.Marshal(suscriptor)
 	if err != nil {
 		return err
@@ -29,9 +27,7 @@ func (r *RedisService) StoreSuscriptor(token string, suscriptor map[string]strin
 	return r.client.Set(ctx, key, jsonData, 0).Err()
 }
 
-func (r *RedisService) GetSuscriptor(token string) (map[string]string, error) {
-	ctx := context.Background()
-
+func (r *RedisService) GetSuscriptor(ctx context.Context, token string) (map[string]string, error) {
 	key := "suscriptor:" + token
 	val, err := r.client.Get(ctx, key).Result()
 	if err != nil {
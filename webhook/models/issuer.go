@@ -6,11 +6,17 @@ type DeclineReason struct {
 	Reason string `json:"reason"`
 }
 
+type CreditLine struct {
+	Limit          int64 `json:"limit"`
+	APRBasisPoints int   `json:"apr_basis_points"`
+}
+
 type IssuedCard struct {
-	PAN        string `json:"pan"`
-	CVV        string `json:"cvv"`
-	ExpiryDate string `json:"expiry_date"`
-	CardType   string `json:"card_type"`
+	PAN        string      `json:"pan"`
+	CVV        string      `json:"cvv"`
+	ExpiryDate string      `json:"expiry_date"`
+	CardType   string      `json:"card_type"`
+	CreditLine *CreditLine `json:"credit_line,omitempty"`
 }
 
 type IssuerResponse struct {
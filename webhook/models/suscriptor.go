@@ -7,4 +7,6 @@ type SuscribeRequest struct {
 
 type SuscribeResponse struct {
 	SuscriptorToken string `json:"suscriptor_token"`
+	// Secret used to verify the X-Webhook-Signature header of forwarded events
+	SigningSecret string `json:"signing_secret"`
 }